@@ -0,0 +1,156 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/fatih/color"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// bundleCommand writes the jsonnetfile, the lockfile and the vendored
+// packages of the project at dir to the archive out
+func bundleCommand(dir, jsonnetHome, out string) int {
+	if dir == "" {
+		dir = "."
+	}
+	if _, _, ok := findWorkspace(dir); ok {
+		kingpin.Fatalf("bundles of workspaces are not supported")
+	}
+
+	lockFile := filepath.Join(dir, jsonnetfile.LockFile)
+	locks, err := jsonnetfile.Load(lockFile)
+	if os.IsNotExist(err) {
+		kingpin.Fatalf("%s not found, run jb install first", jsonnetfile.LockFile)
+	}
+	kingpin.FatalIfError(err, "failed to load lockfile")
+
+	names := make([]string, 0, len(locks.Dependencies))
+	for name := range locks.Dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var bundled []string
+	for _, name := range names {
+		if src := locks.Dependencies[name].FetchSource().LocalSource; src != nil && !src.Copied() {
+			installerOptions.Observer.Observe(pkg.Event{
+				Type:    pkg.EventWarn,
+				Package: name,
+				Message: fmt.Sprintf("%s is linked and not bundled, set its mode to `copy` to bundle it", name),
+			})
+			continue
+		}
+		bundled = append(bundled, name)
+	}
+
+	// written next to the destination first, so that no partial archive
+	// is left behind
+	f, err := ioutil.TempFile(filepath.Dir(out), ".jb-bundle")
+	kingpin.FatalIfError(err, "creating %s", out)
+	defer os.Remove(f.Name())
+
+	manifest, err := jsonnetfile.Manifest(dir)
+	kingpin.FatalIfError(err, "")
+	err = pkg.WriteBundle(f, manifest, lockFile, filepath.Join(dir, jsonnetHome), locks.Dependencies)
+	if err != nil {
+		f.Close()
+		kingpin.FatalIfError(err, "failed to bundle packages")
+	}
+	kingpin.FatalIfError(f.Close(), "writing %s", out)
+	kingpin.FatalIfError(os.Chmod(f.Name(), 0644), "writing %s", out)
+	kingpin.FatalIfError(os.Rename(f.Name(), out), "writing %s", out)
+
+	for _, name := range bundled {
+		l := locks.Dependencies[name]
+		installerOptions.Observer.Observe(pkg.Event{Type: pkg.EventResult, Package: name, Version: l.Version, Sum: l.Sum})
+	}
+	if jsonOut == nil {
+		color.Green("bundled %d packages into %s", len(bundled), out)
+	}
+	return 0
+}
+
+// installFromBundleCommand restores the vendor directory of the project at
+// dir from the archive bundle, verifying the packages against the lockfile of
+// the project, or the bundled one if there is none. The packages are
+// installed as usual afterwards, which only retrieves those that are not
+// part of the bundle, like linked local ones.
+func installFromBundleCommand(dir, jsonnetHome, bundle string) int {
+	if dir == "" {
+		dir = "."
+	}
+	if _, _, ok := findWorkspace(dir); ok {
+		kingpin.Fatalf("bundles of workspaces are not supported")
+	}
+
+	manifest, err := jsonnetfile.Manifest(dir)
+	kingpin.FatalIfError(err, "")
+	jsonnetFile, err := jsonnetfile.Load(manifest)
+	kingpin.FatalIfError(err, "failed to load jsonnetfile")
+
+	lockPath := filepath.Join(dir, jsonnetfile.LockFile)
+	jblockfilebytes, err := ioutil.ReadFile(lockPath)
+	if !os.IsNotExist(err) {
+		kingpin.FatalIfError(err, "failed to load lockfile")
+	}
+
+	// nil makes RestoreBundle use the bundled lockfile
+	var locks map[string]deps.Dependency
+	if jblockfilebytes != nil {
+		lockFile, err := jsonnetfile.UnmarshalLock(jblockfilebytes)
+		kingpin.FatalIfError(err, "")
+		locks = lockFile.Dependencies
+	}
+
+	f, err := os.Open(bundle)
+	kingpin.FatalIfError(err, "failed to open bundle")
+	defer f.Close()
+
+	locks, err = pkg.RestoreBundle(f, filepath.Join(dir, jsonnetHome), locks)
+	kingpin.FatalIfError(err, "failed to restore %s", bundle)
+	oldLocks := copyLocks(locks)
+
+	// pruned packages are only intact as long as pruning
+	for _, l := range locks {
+		if l.PrunedFrom != "" {
+			installerOptions.Prune = true
+		}
+	}
+
+	kingpin.FatalIfError(
+		os.MkdirAll(filepath.Join(dir, jsonnetHome, ".tmp"), os.ModePerm),
+		"creating vendor folder")
+
+	locked, err := newInstaller(dir, jsonnetHome).Ensure(jsonnetFile, locks)
+	kingpin.FatalIfError(err, "failed to install packages")
+	reportChanges(oldLocks, locked)
+
+	kingpin.FatalIfError(
+		writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked, Lock: true}, lockPath),
+		"updating jsonnetfile.lock.json")
+
+	return 0
+}
@@ -0,0 +1,127 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestBundleRoundTrip(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmp, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, name), []byte(content), 0644))
+	}
+
+	write("lib/main.libsonnet", `{}`)
+	write("project/"+jsonnetfile.File, `{"version": 1, "dependencies": [{"source": {"local": {"directory": "../lib", "mode": "copy"}}, "version": ""}], "legacyImports": false}`)
+
+	project := filepath.Join(tmp, "project")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(project))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, installCommand(project, "vendor", nil, false, "", "", false))
+	lock, err := ioutil.ReadFile(filepath.Join(project, jsonnetfile.LockFile))
+	require.NoError(t, err)
+
+	archive := filepath.Join(tmp, "deps.tar.gz")
+	assert.Equal(t, 0, bundleCommand(project, "vendor", archive))
+
+	// the bundle is all that is needed
+	require.NoError(t, os.RemoveAll(filepath.Join(tmp, "lib")))
+	require.NoError(t, os.RemoveAll(filepath.Join(project, "vendor")))
+	require.NoError(t, os.Remove(filepath.Join(project, jsonnetfile.LockFile)))
+
+	assert.Equal(t, 0, installFromBundleCommand(project, "vendor", archive))
+
+	_, err = os.Stat(filepath.Join(project, "vendor", "lib", "main.libsonnet"))
+	assert.NoError(t, err)
+	restored, err := ioutil.ReadFile(filepath.Join(project, jsonnetfile.LockFile))
+	require.NoError(t, err)
+	assert.JSONEq(t, string(lock), string(restored))
+}
+
+func TestBundleJSONOutput(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(tmp, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(tmp, name), []byte(content), 0644))
+	}
+
+	write("linked/main.libsonnet", `{}`)
+	write("copied/main.libsonnet", `{}`)
+	write("project/"+jsonnetfile.File, `{"version": 1, "dependencies": [
+		{"source": {"local": {"directory": "../linked"}}, "version": ""},
+		{"source": {"local": {"directory": "../copied", "mode": "copy"}}, "version": ""}
+	], "legacyImports": false}`)
+
+	project := filepath.Join(tmp, "project")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(project))
+	defer os.Chdir(wd)
+
+	require.Equal(t, 0, installCommand(project, "vendor", nil, false, "", "", false))
+
+	var buf bytes.Buffer
+	o := useJSONOutput(&buf, "bundle")
+	defer func() {
+		jsonOut = nil
+		installerOptions.Observer = pkg.ObserverFunc(printEvent)
+		kingpin.CommandLine.ErrorWriter(os.Stderr).Terminate(os.Exit)
+	}()
+
+	o.finish(bundleCommand(project, "vendor", filepath.Join(tmp, "deps.tar.gz")))
+
+	var events []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]interface{}
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, "warn", events[0]["type"])
+	assert.Equal(t, "linked", events[0]["package"])
+	assert.Equal(t, "result", events[1]["type"])
+	assert.Equal(t, "copied", events[1]["package"])
+
+	summary := events[2]
+	assert.Equal(t, "summary", summary["type"])
+	assert.Equal(t, true, summary["success"])
+	assert.Equal(t, float64(1), summary["warnings"])
+	assert.Equal(t, float64(1), summary["packages"])
+}
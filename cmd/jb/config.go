@@ -0,0 +1,122 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/config"
+)
+
+// configListCommand prints the effective settings and the layer each one
+// comes from
+func configListCommand(layers []config.Layer) int {
+	type setting struct {
+		value  string
+		source string
+	}
+
+	settings := make(map[string]setting)
+	for _, l := range layers {
+		for k, v := range l.Config.Values() {
+			settings[k] = setting{value: v, source: l.Source}
+		}
+	}
+
+	keys := make([]string, 0, len(settings))
+	for k := range settings {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var buf bytes.Buffer
+	w := tabwriter.NewWriter(&buf, 0, 0, 2, ' ', 0)
+	for _, k := range keys {
+		s := settings[k]
+		if config.Secret(k) {
+			s.value = "********"
+		}
+		if s.source == config.SourceEnv {
+			name, _ := config.EnvVar(k)
+			s.source = "$" + name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\n", k, s.value, s.source)
+	}
+	w.Flush()
+
+	for _, l := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+		if l != "" {
+			printLine(l)
+		}
+	}
+	return 0
+}
+
+// configGetCommand prints the effective setting of key. It fails if the
+// setting is not set.
+func configGetCommand(layers []config.Layer, key string) int {
+	// rejects unknown keys
+	kingpin.FatalIfError((&config.Config{}).Set(key, ""), "")
+
+	v, ok := config.Merge(layers).Get(key)
+	if !ok {
+		return 1
+	}
+	printLine(v)
+	return 0
+}
+
+// configSetCommand changes key in the .jbrc of the project, or the user
+// configuration if global is set. Secrets always go to the user
+// configuration, as .jbrc is usually committed.
+func configSetCommand(dir, key, value string, global bool) int {
+	path := config.FindProjectFile(dir)
+	if path == "" {
+		path = filepath.Join(dir, config.ProjectFile)
+	}
+	if global || config.Secret(key) {
+		var err error
+		path, err = config.UserFile()
+		kingpin.FatalIfError(err, "locating the user configuration")
+	}
+
+	c, err := config.Read(path)
+	kingpin.FatalIfError(err, "")
+
+	kingpin.FatalIfError(c.Set(key, value), "")
+	if !global {
+		kingpin.FatalIfError(config.CheckProject(c), "")
+	}
+	kingpin.FatalIfError(config.Write(path, c), "writing %s", path)
+
+	return 0
+}
+
+// firstOf returns the first non-empty value
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
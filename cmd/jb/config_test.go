@@ -0,0 +1,60 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/config"
+)
+
+func TestConfigSetSecret(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-config")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// the user configuration directory is derived from these
+	for _, env := range []string{"XDG_CONFIG_HOME", "HOME", "AppData"} {
+		defer os.Setenv(env, os.Getenv(env))
+		require.NoError(t, os.Setenv(env, filepath.Join(tmp, "user")))
+	}
+
+	project := filepath.Join(tmp, "project")
+	require.NoError(t, os.Mkdir(project, os.ModePerm))
+
+	assert.Equal(t, 0, configSetCommand(project, "concurrency", "4", false))
+	assert.Equal(t, 0, configSetCommand(project, "auth.example.com.username", "jb", false))
+	assert.Equal(t, 0, configSetCommand(project, "auth.example.com.token", "secret", false))
+
+	c, err := config.Read(filepath.Join(project, config.ProjectFile))
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"concurrency":               "4",
+		"auth.example.com.username": "jb",
+	}, c.Values())
+
+	// tokens never end up in .jbrc
+	userFile, err := config.UserFile()
+	require.NoError(t, err)
+	u, err := config.Read(userFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"auth.example.com.token": "secret"}, u.Values())
+}
@@ -0,0 +1,59 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	"github.com/jsonnet-bundler/jsonnet-bundler/tool/imports"
+)
+
+// checkImportsCommand prints imports of packages that are not direct
+// dependencies, imports that cannot be resolved and unused dependencies
+func checkImportsCommand(dir, vendorDir string, jpath []string) int {
+	manifest, err := jsonnetfile.Manifest(dir)
+	kingpin.FatalIfError(err, "")
+	jsonnetFile, err := jsonnetfile.Load(manifest)
+	kingpin.FatalIfError(err, "failed to load %s", manifest)
+
+	lockFile, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		kingpin.Fatalf("Failed to load lockFile: %s.\nThe locks are required to map imports to packages. Make sure to run `jb install` first.", err)
+	}
+
+	problems, err := imports.Check(dir, vendorDir, jpath, jsonnetFile, lockFile)
+	kingpin.FatalIfError(err, "")
+
+	for _, p := range problems {
+		if p.File == "" {
+			p.File = filepath.Base(manifest)
+		}
+		if jsonOut != nil {
+			jsonOut.Observe(pkg.Event{Type: pkg.EventProblem, Path: p.File, Kind: p.Kind, Package: p.Package, Message: p.String()})
+		} else {
+			fmt.Println(p)
+		}
+	}
+
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
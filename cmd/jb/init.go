@@ -21,22 +21,25 @@ import (
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
 	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
 	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
 )
 
-func initCommand(dir string) int {
-	exists, err := jsonnetfile.Exists(jsonnetfile.File)
-	kingpin.FatalIfError(err, "Failed to check for jsonnetfile.json")
+func initCommand(dir string, legacyImports bool) int {
+	for _, f := range []string{jsonnetfile.File, jsonnetfile.FileJsonnet} {
+		exists, err := jsonnetfile.Exists(f)
+		kingpin.FatalIfError(err, "Failed to check for %s", f)
 
-	if exists {
-		kingpin.Errorf("jsonnetfile.json already exists")
-		return 1
+		if exists {
+			kingpin.Errorf("%s already exists", f)
+			return 1
+		}
 	}
 
 	s := v1.New()
 	// TODO: disable them by default eventually
-	// s.LegacyImports = false
+	s.LegacyImports = legacyImports
 
 	contents, err := json.MarshalIndent(s, "", "  ")
 	kingpin.FatalIfError(err, "formatting jsonnetfile contents as json")
@@ -44,8 +47,12 @@ func initCommand(dir string) int {
 
 	filename := filepath.Join(dir, jsonnetfile.File)
 
-	ioutil.WriteFile(filename, contents, 0644)
+	err = ioutil.WriteFile(filename, contents, 0644)
 	kingpin.FatalIfError(err, "Failed to write new jsonnetfile.json")
 
+	if jsonOut != nil {
+		jsonOut.Observe(pkg.Event{Type: pkg.EventInit, Path: filename})
+	}
+
 	return 0
 }
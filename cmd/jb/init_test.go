@@ -31,6 +31,6 @@ func TestInitCommand(t *testing.T) {
 	}
 	defer os.Remove(tempDir)
 
-	code := initCommand(tempDir)
+	code := initCommand(tempDir, true)
 	assert.Equal(t, 0, code)
 }
@@ -16,12 +16,14 @@ package main
 
 import (
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path/filepath"
 	"reflect"
 
+	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"gopkg.in/alecthomas/kingpin.v2"
 
@@ -31,13 +33,20 @@ import (
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
-func installCommand(dir, jsonnetHome string, uris []string, single bool, legacyName string) int {
+func installCommand(dir, jsonnetHome string, uris []string, single bool, legacyName, alias string, dryRun bool) int {
 	if dir == "" {
 		dir = "."
 	}
 
-	jbfilebytes, err := ioutil.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	if root, ws, ok := findWorkspace(dir); ok {
+		return workspaceInstallCommand(root, ws, dir, jsonnetHome, uris, single, legacyName, alias, dryRun)
+	}
+
+	manifest, err := jsonnetfile.Manifest(dir)
+	kingpin.FatalIfError(err, "")
+	jbfilebytes, err := jsonnetfile.Read(manifest)
 	kingpin.FatalIfError(err, "failed to load jsonnetfile")
+	warnUnknownFields(manifest, jbfilebytes)
 
 	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
 	kingpin.FatalIfError(err, "")
@@ -47,21 +56,65 @@ func installCommand(dir, jsonnetHome string, uris []string, single bool, legacyN
 		kingpin.FatalIfError(err, "failed to load lockfile")
 	}
 
-	lockFile, err := jsonnetfile.Unmarshal(jblockfilebytes)
+	lockFile, err := jsonnetfile.UnmarshalLock(jblockfilebytes)
 	kingpin.FatalIfError(err, "")
 
+	oldLocks := copyLocks(lockFile.Dependencies)
+	added := addDependencies(dir, &jsonnetFile, lockFile.Dependencies, uris, single, legacyName, alias)
+
+	in := newInstaller(dir, jsonnetHome)
+	if dryRun {
+		locked, err := in.Plan(jsonnetFile, lockFile.Dependencies)
+		kingpin.FatalIfError(err, "failed to resolve packages")
+
+		kingpin.FatalIfError(printPlan(jsonnetfile.LockFile, jblockfilebytes, oldLocks, locked), "")
+		return 0
+	}
+
+	if len(added) > 0 && jsonnetfile.IsJsonnet(manifest) {
+		return printDependencies(manifest, added)
+	}
+
 	kingpin.FatalIfError(
 		os.MkdirAll(filepath.Join(dir, jsonnetHome, ".tmp"), os.ModePerm),
 		"creating vendor folder")
 
+	locked, err := in.Ensure(jsonnetFile, lockFile.Dependencies)
+	kingpin.FatalIfError(err, "failed to install packages")
+	reportChanges(oldLocks, locked)
+
+	pkg.CleanLegacyName(jsonnetFile.Dependencies)
+
+	kingpin.FatalIfError(
+		writeChangedJsonnetFile(jbfilebytes, &jsonnetFile, manifest),
+		"updating jsonnetfile.json")
+
+	kingpin.FatalIfError(
+		writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked, Lock: true}, filepath.Join(dir, jsonnetfile.LockFile)),
+		"updating jsonnetfile.lock.json")
+
+	return 0
+}
+
+// addDependencies adds the packages passed on the command line to
+// jsonnetFile and returns the ones that changed it. Changed packages are
+// removed from the locks, so that the passed version is installed.
+func addDependencies(dir string, jsonnetFile *v1.JsonnetFile, locks map[string]deps.Dependency, uris []string, single bool, legacyName, alias string) []deps.Dependency {
 	if len(uris) > 1 && legacyName != "" {
 		log.Fatal("Cannot use --legacy-name with mutliple uris")
 	}
+	if len(uris) > 1 && alias != "" {
+		log.Fatal("Cannot use --as with mutliple uris")
+	}
+	if alias != "" {
+		kingpin.FatalIfError(deps.ValidateAlias(alias), "")
+	}
 
+	var added []deps.Dependency
 	for _, u := range uris {
-		d := deps.Parse(dir, u)
-		if d == nil {
-			kingpin.Fatalf("Unable to parse package URI `%s`", u)
+		d, err := deps.Parse(dir, u)
+		if err != nil {
+			kingpin.Fatalf("Unable to parse package URI `%s`: %s", u, err)
 		}
 
 		if single {
@@ -72,34 +125,60 @@ func installCommand(dir, jsonnetHome string, uris []string, single bool, legacyN
 			d.LegacyNameCompat = legacyName
 		}
 
+		if alias != "" {
+			d.Alias = alias
+		}
+
 		if !depEqual(jsonnetFile.Dependencies[d.Name()], *d) {
 			// the dep passed on the cli is different from the jsonnetFile
 			jsonnetFile.Dependencies[d.Name()] = *d
 
 			// we want to install the passed version (ignore the lock)
-			delete(lockFile.Dependencies, d.Name())
+			delete(locks, d.Name())
+
+			added = append(added, *d)
 		}
 	}
+	return added
+}
 
-	jsonnetPkgHomeDir := filepath.Join(dir, jsonnetHome)
-	locked, err := pkg.Ensure(jsonnetFile, jsonnetPkgHomeDir, lockFile.Dependencies)
-	kingpin.FatalIfError(err, "failed to install packages")
-
-	pkg.CleanLegacyName(jsonnetFile.Dependencies)
-
-	kingpin.FatalIfError(
-		writeChangedJsonnetFile(jbfilebytes, &jsonnetFile, filepath.Join(dir, jsonnetfile.File)),
-		"updating jsonnetfile.json")
+// copyLocks returns a copy of locks, which is left untouched when the copy is
+// modified
+func copyLocks(locks map[string]deps.Dependency) map[string]deps.Dependency {
+	c := make(map[string]deps.Dependency, len(locks))
+	for k, v := range locks {
+		c[k] = v
+	}
+	return c
+}
 
-	kingpin.FatalIfError(
-		writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked}, filepath.Join(dir, jsonnetfile.LockFile)),
-		"updating jsonnetfile.lock.json")
+// printDependencies prints the entries to add to a jsonnetfile.jsonnet, which
+// jb does not rewrite, as it can't tell which parts of it to change
+func printDependencies(manifest string, added []deps.Dependency) int {
+	if jsonOut != nil {
+		for _, d := range added {
+			b, err := json.Marshal(d)
+			kingpin.FatalIfError(err, "encoding json")
+			installerOptions.Observer.Observe(pkg.Event{
+				Type:    pkg.EventWarn,
+				Package: d.Name(),
+				Message: fmt.Sprintf("%s is not rewritten by jb, add %s to its dependencies instead", manifest, b),
+			})
+		}
+		return 1
+	}
 
-	return 0
+	color.Yellow("%s is not rewritten by jb, add the following to its dependencies instead:", manifest)
+	for _, d := range added {
+		b, err := json.MarshalIndent(d, "", "  ")
+		kingpin.FatalIfError(err, "encoding json")
+		fmt.Println(string(b))
+	}
+	return 1
 }
 
 func depEqual(d1, d2 deps.Dependency) bool {
-	name := d1.Name() == d2.Name()
+	name := d1.Name() == d2.Name() && d1.Alias == d2.Alias
 	version := d1.Version == d2.Version
 	source := reflect.DeepEqual(d1.Source, d2.Source)
 
@@ -117,6 +196,11 @@ func writeJSONFile(name string, d interface{}) error {
 }
 
 func writeChangedJsonnetFile(originalBytes []byte, modified *v1.JsonnetFile, path string) error {
+	// generated from jsonnet, which is left alone
+	if jsonnetfile.IsJsonnet(path) {
+		return nil
+	}
+
 	origJsonnetFile, err := jsonnetfile.Unmarshal(originalBytes)
 	if err != nil {
 		return err
@@ -98,11 +98,11 @@ func testInstallCommandWithJsonnetHome(t *testing.T, jsonnetHome string) {
 			assert.NoError(t, err)
 
 			// init + check it works correctly (legacyImports true, empty dependencies)
-			initCommand("")
+			initCommand("", true)
 			jsonnetFileContent(t, jsonnetfile.File, []byte(initContents))
 
 			// install something, check it writes only if required, etc.
-			installCommand("", jsonnetHome, tc.URIs, tc.single, "")
+			installCommand("", jsonnetHome, tc.URIs, tc.single, "", "", false)
 			jsonnetFileContent(t, jsonnetfile.File, tc.ExpectedJsonnetFile)
 			if tc.ExpectedJsonnetLockFile != nil {
 				jsonnetFileContent(t, jsonnetfile.LockFile, tc.ExpectedJsonnetLockFile)
@@ -0,0 +1,73 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"os"
+
+	"github.com/fatih/color"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+// installerOptions are shared by all installs, as configured by the global
+// flags
+var installerOptions = pkg.InstallerOptions{
+	Logger:   os.Stderr,
+	Observer: pkg.ObserverFunc(printEvent),
+}
+
+// newInstaller returns an Installer for the project at root, vendoring into
+// jsonnetHome below it
+func newInstaller(root, jsonnetHome string) *pkg.Installer {
+	opts := installerOptions
+	opts.RootDir = root
+	opts.VendorDir = jsonnetHome
+
+	in, err := pkg.NewInstaller(opts)
+	kingpin.FatalIfError(err, "")
+	return in
+}
+
+// warnUnknownFields warns about the fields of the jsonnetfile at path, given
+// its contents, that jb ignores. Broken files are left to be reported when
+// they are unmarshalled.
+func warnUnknownFields(path string, data []byte) {
+	unknown, _ := jsonnetfile.UnknownFields(path, data)
+	for _, u := range unknown {
+		installerOptions.Observer.Observe(pkg.Event{Type: pkg.EventWarn, Message: u.String()})
+	}
+}
+
+// printEvent prints events as colored text, omitting the ones that are only
+// of interest to machines
+func printEvent(e pkg.Event) {
+	switch e.Type {
+	case pkg.EventFetch:
+		color.Cyan("GET %s %d", e.URL, e.Status)
+	case pkg.EventClean:
+		color.Magenta("CLEAN %s", e.Path)
+	case pkg.EventLink:
+		if e.Kind == pkg.LinkLocal {
+			color.Magenta("LOCAL %s -> %s", e.Package, e.Target)
+		}
+	case pkg.EventCopy:
+		color.Magenta("LOCAL %s <- %s", e.Package, e.Target)
+	case pkg.EventWarn:
+		color.Yellow("WARN: %s", e.Message)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+const (
+	jpathLines  = "lines"
+	jpathFlags  = "flags"
+	jpathExport = "export"
+
+	jsonnetPathEnv = "JSONNET_PATH"
+)
+
+// jpathCommand prints the library search paths of the project, one per line,
+// as -J flags or as a shell command exporting JSONNET_PATH
+func jpathCommand(dir, vendorDir, format string, legacy bool) int {
+	paths := jpath(dir, vendorDir, legacy)
+
+	switch format {
+	case jpathFlags:
+		// the right-most -J takes precedence
+		flags := make([]string, 0, 2*len(paths))
+		for i := len(paths) - 1; i >= 0; i-- {
+			flags = append(flags, "-J", shellQuote(paths[i]))
+		}
+		printLine(strings.Join(flags, " "))
+	case jpathExport:
+		printLine(fmt.Sprintf("export %s=%s", jsonnetPathEnv, shellQuote(strings.Join(paths, string(os.PathListSeparator)))))
+	default:
+		for _, p := range paths {
+			printLine(p)
+		}
+	}
+	return 0
+}
+
+// execCommand runs args with JSONNET_PATH set to the library search paths of
+// the project, ahead of the ones already set. It returns the exit code of the
+// command.
+func execCommand(dir, vendorDir string, args []string, legacy bool) int {
+	paths := jpath(dir, vendorDir, legacy)
+	if existing := os.Getenv(jsonnetPathEnv); existing != "" {
+		paths = append(paths, existing)
+	}
+
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Env = append(os.Environ(), jsonnetPathEnv+"="+strings.Join(paths, string(os.PathListSeparator)))
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	err := cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		return exit.ExitCode()
+	}
+	kingpin.FatalIfError(err, "running %s", args[0])
+	return 0
+}
+
+// jpath returns the library search paths of the project in dir, warning
+// about packages that can't be imported by their legacy names through them
+func jpath(dir, vendorDir string, legacy bool) []string {
+	lockFile, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		kingpin.Fatalf("Failed to load lockFile: %s.\nThe locks are required to compute the search paths. Make sure to run `jb install` first.", err)
+	}
+
+	paths, unreachable := pkg.JPath(filepath.Join(dir, vendorDir), lockFile.Dependencies, legacy)
+	for _, name := range unreachable {
+		installerOptions.Observer.Observe(pkg.Event{
+			Type:    pkg.EventWarn,
+			Package: name,
+			Message: fmt.Sprintf("%s can only be imported by its legacy name `%s` using the symlinks of legacyImports", name, lockFile.Dependencies[name].LegacyName()),
+		})
+	}
+	return paths
+}
+
+// shellQuote quotes s for POSIX shells, unless it consists of safe characters
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@,+=") == "" {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
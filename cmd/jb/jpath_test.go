@@ -0,0 +1,54 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestExec(t *testing.T) {
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip("sh not installed")
+	}
+
+	root, err := ioutil.TempDir("", "jb-exec")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, jsonnetfile.LockFile), []byte(rewriteLock), 0644))
+
+	os.Setenv(jsonnetPathEnv, "/lib")
+	defer os.Unsetenv(jsonnetPathEnv)
+
+	want := filepath.Join(root, "vendor") + ":" + filepath.Join(root, "vendor", "github.com", "ksonnet", "ksonnet-lib") + ":/lib"
+	script := `test "$JSONNET_PATH" = "` + want + `" && exit 7`
+	assert.Equal(t, 7, execCommand(root, "vendor", []string{"sh", "-c", script}, true))
+
+	assert.Equal(t, 0, execCommand(root, "vendor", []string{"true"}, false))
+}
+
+func TestShellQuote(t *testing.T) {
+	assert.Equal(t, "/home/jb/vendor", shellQuote("/home/jb/vendor"))
+	assert.Equal(t, "'/home/j b/vendor'", shellQuote("/home/j b/vendor"))
+	assert.Equal(t, `'it'\''s'`, shellQuote("it's"))
+}
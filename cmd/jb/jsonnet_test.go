@@ -0,0 +1,71 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestInstallJsonnetManifest(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-jsonnet")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write("a/main.libsonnet", `{}`)
+	write("b/main.libsonnet", `{}`)
+	write(jsonnetfile.FileJsonnet, `
+local local_(dir) = { source: { 'local': { directory: dir } }, version: '' };
+{ version: 1, dependencies: [local_('a')], legacyImports: false }
+`)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, installCommand(root, "vendor", nil, false, "", "", false))
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.LockFile))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 2, "dependencies": [{"source": {"local": {"directory": "a"}}, "version": "", "parents": ["."]}], "legacyImports": false}`, string(lock))
+
+	_, err = os.Stat(filepath.Join(root, jsonnetfile.File))
+	assert.True(t, os.IsNotExist(err))
+
+	// new packages are not added to jsonnet, nor installed
+	assert.Equal(t, 1, installCommand(root, "vendor", []string{"b"}, false, "", "", false))
+
+	after, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.LockFile))
+	require.NoError(t, err)
+	assert.Equal(t, string(lock), string(after))
+	_, err = os.Stat(filepath.Join(root, "vendor", "b"))
+	assert.True(t, os.IsNotExist(err))
+
+	// already present ones are fine
+	assert.Equal(t, 0, installCommand(root, "vendor", []string{"a"}, false, "", "", false))
+}
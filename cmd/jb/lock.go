@@ -0,0 +1,168 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/pkg/errors"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// loadFunc loads the jsonnetfile a lockfile is resolved against
+type loadFunc func() (v1.JsonnetFile, error)
+
+// withLockfile runs f with the lockfile of the project or workspace at dir,
+// an installer for its vendor directory and the jsonnetfile belonging to it
+func withLockfile(dir, jsonnetHome string, f func(lockFile string, in *pkg.Installer, load loadFunc) int) int {
+	if root, ws, ok := findWorkspace(dir); ok {
+		return f(filepath.Join(root, jsonnetfile.WorkspaceLockFile), newInstaller(root, jsonnetHome), func() (v1.JsonnetFile, error) {
+			members, err := pkg.LoadWorkspaceMembers(root, ws)
+			if err != nil {
+				return v1.JsonnetFile{}, err
+			}
+			return pkg.MergeWorkspace(ws, members)
+		})
+	}
+
+	return f(filepath.Join(dir, jsonnetfile.LockFile), newInstaller(dir, jsonnetHome), func() (v1.JsonnetFile, error) {
+		manifest, err := jsonnetfile.Manifest(dir)
+		if err != nil {
+			return v1.New(), err
+		}
+		return jsonnetfile.Load(manifest)
+	})
+}
+
+func lockResolveCommand(dir, jsonnetHome string) int {
+	if dir == "" {
+		dir = "."
+	}
+
+	return withLockfile(dir, jsonnetHome, func(lockFile string, in *pkg.Installer, load loadFunc) int {
+		data, err := ioutil.ReadFile(lockFile)
+		kingpin.FatalIfError(err, "failed to load lockfile")
+
+		conflict, conflicted, err := jsonnetfile.ParseConflict(data)
+		kingpin.FatalIfError(err, "failed to parse conflict markers of %s", lockFile)
+
+		if !conflicted {
+			if jsonOut == nil {
+				color.Cyan("%s has no conflicts", lockFile)
+			}
+			return 0
+		}
+
+		locked, err := resolveLock(conflict, in, load)
+		kingpin.FatalIfError(err, "failed to resolve %s", lockFile)
+
+		kingpin.FatalIfError(writeJSONFile(lockFile, locked), "updating %s", lockFile)
+		return 0
+	})
+}
+
+// lockMergeDriverCommand merges lockfiles as a git merge driver. base, ours
+// and theirs are the %O, %A and %B placeholders, path is %P. The result is
+// left in ours. If the lockfiles can't be merged, ours receives both sides
+// with conflict markers around them, which `jb lock resolve` understands.
+func lockMergeDriverCommand(jsonnetHome, base, ours, theirs, path string) int {
+	var conflict jsonnetfile.Conflict
+	var err error
+
+	// git passes paths relative to the root of the repository, which is not
+	// the working directory inside of workspaces
+	ours, err = filepath.Abs(ours)
+	kingpin.FatalIfError(err, "")
+
+	for _, f := range []struct {
+		name string
+		dst  *[]byte
+	}{{base, &conflict.Base}, {ours, &conflict.Ours}, {theirs, &conflict.Theirs}} {
+		*f.dst, err = ioutil.ReadFile(f.name)
+		kingpin.FatalIfError(err, "reading %s", f.name)
+	}
+
+	return withLockfile(filepath.Dir(path), jsonnetHome, func(lockFile string, in *pkg.Installer, load loadFunc) int {
+		locked, err := resolveLock(conflict, in, load)
+		if err != nil {
+			kingpin.Errorf("failed to merge %s: %s", path, err)
+			kingpin.FatalIfError(
+				ioutil.WriteFile(ours, jsonnetfile.MarkConflict(conflict.Ours, conflict.Theirs), 0644),
+				"writing conflict to %s", ours)
+			return 1
+		}
+
+		kingpin.FatalIfError(writeJSONFile(ours, locked), "writing merged lockfile")
+		return 0
+	})
+}
+
+// resolveLock merges both sides of the conflict. Entries changed differently
+// on both sides are resolved again against the jsonnetfile. The vendor
+// directory is left untouched, so that merge drivers don't change it behind
+// git's back.
+func resolveLock(conflict jsonnetfile.Conflict, in *pkg.Installer, load loadFunc) (v1.JsonnetFile, error) {
+	ours, err := jsonnetfile.UnmarshalLock(conflict.Ours)
+	if err != nil {
+		return v1.JsonnetFile{}, errors.Wrap(err, "parsing our side")
+	}
+	theirs, err := jsonnetfile.UnmarshalLock(conflict.Theirs)
+	if err != nil {
+		return v1.JsonnetFile{}, errors.Wrap(err, "parsing their side")
+	}
+
+	// git passes an empty file if both sides added the lockfile, which has no
+	// ancestor to tell additions from removals
+	var base map[string]deps.Dependency
+	if len(bytes.TrimSpace(conflict.Base)) > 0 {
+		b, err := jsonnetfile.UnmarshalLock(conflict.Base)
+		if err != nil {
+			return v1.JsonnetFile{}, errors.Wrap(err, "parsing the common ancestor")
+		}
+		base = b.Dependencies
+	}
+
+	merged, conflicts := pkg.MergeLocks(base, ours.Dependencies, theirs.Dependencies)
+	for _, name := range conflicts {
+		installerOptions.Observer.Observe(pkg.Event{
+			Type:    pkg.EventWarn,
+			Package: name,
+			Message: fmt.Sprintf("CONFLICT %s, resolving again", name),
+		})
+	}
+
+	var jsonnetFile v1.JsonnetFile
+	if len(conflicts) > 0 {
+		if jsonnetFile, err = load(); err != nil {
+			return v1.JsonnetFile{}, errors.Wrap(err, "loading jsonnetfile")
+		}
+	}
+
+	locked, err := in.ResolveConflicts(jsonnetFile, merged, conflicts)
+	if err != nil {
+		return v1.JsonnetFile{}, err
+	}
+
+	return v1.JsonnetFile{Dependencies: locked, Lock: true}, nil
+}
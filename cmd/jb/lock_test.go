@@ -0,0 +1,189 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestLockResolve(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write("a/main.libsonnet", `{}`)
+	write("b/main.libsonnet", `{}`)
+	write(jsonnetfile.File, `{"version": 1, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": ""},
+  {"source": {"local": {"directory": "b"}}, "version": ""}
+]}`)
+
+	// both branches added a different dependency
+	write(jsonnetfile.LockFile, `{
+  "version": 2,
+  "dependencies": [
+<<<<<<< HEAD
+    {"source": {"local": {"directory": "a"}}, "version": "", "parents": ["."]}
+=======
+    {"source": {"local": {"directory": "b"}}, "version": "", "parents": ["."]}
+>>>>>>> feature
+  ],
+  "legacyImports": false
+}
+`)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, lockResolveCommand(root, "vendor"))
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.LockFile))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 2, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": "", "parents": ["."]},
+  {"source": {"local": {"directory": "b"}}, "version": "", "parents": ["."]}
+], "legacyImports": false}`, string(lock))
+
+	// nothing left to do
+	assert.Equal(t, 0, lockResolveCommand(root, "vendor"))
+}
+
+func TestLockMergeDriver(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write("a/main.libsonnet", `{}`)
+	write("b/main.libsonnet", `{}`)
+	write(jsonnetfile.File, `{"version": 1, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": ""},
+  {"source": {"local": {"directory": "b"}}, "version": ""}
+]}`)
+
+	// both branches added the lockfile, so the ancestor is empty. b was
+	// changed differently on both sides, a is the same on both.
+	write("base", ``)
+	write("ours", `{"version": 2, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": "", "sum": "unchecked", "parents": ["."]},
+  {"source": {"local": {"directory": "b"}}, "version": "", "sum": "ours", "parents": ["."]}
+], "legacyImports": false}`)
+	write("theirs", `{"version": 2, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": "", "sum": "unchecked", "parents": ["."]},
+  {"source": {"local": {"directory": "b"}}, "version": "", "sum": "theirs", "parents": ["."]}
+], "legacyImports": false}`)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, lockMergeDriverCommand("vendor", "base", "ours", "theirs", jsonnetfile.LockFile))
+
+	// only b is resolved again, a is taken as it is
+	lock, err := ioutil.ReadFile(filepath.Join(root, "ours"))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 2, "dependencies": [
+  {"source": {"local": {"directory": "a"}}, "version": "", "sum": "unchecked", "parents": ["."]},
+  {"source": {"local": {"directory": "b"}}, "version": "", "parents": ["."]}
+], "legacyImports": false}`, string(lock))
+
+	// vendor is left alone
+	_, err = os.Stat(filepath.Join(root, "vendor"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestLockResolveJSONOutput(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write("a/main.libsonnet", `{}`)
+	write(jsonnetfile.File, `{"version": 1, "dependencies": [{"source": {"local": {"directory": "a"}}, "version": ""}]}`)
+
+	// both branches changed the same dependency
+	write(jsonnetfile.LockFile, `{
+  "version": 2,
+  "dependencies": [
+<<<<<<< HEAD
+    {"source": {"local": {"directory": "a"}}, "version": "", "sum": "ours"}
+=======
+    {"source": {"local": {"directory": "a"}}, "version": "", "sum": "theirs"}
+>>>>>>> feature
+  ],
+  "legacyImports": false
+}
+`)
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	o := useJSONOutput(&buf, "lock resolve")
+	defer func() {
+		jsonOut = nil
+		installerOptions.Observer = pkg.ObserverFunc(printEvent)
+		kingpin.CommandLine.ErrorWriter(os.Stderr).Terminate(os.Exit)
+	}()
+
+	o.finish(lockResolveCommand(root, "vendor"))
+
+	var events []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]interface{}
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+
+	require.NotEmpty(t, events)
+	assert.Equal(t, "warn", events[0]["type"])
+	assert.Equal(t, "a", events[0]["package"])
+
+	summary := events[len(events)-1]
+	assert.Equal(t, "summary", summary["type"])
+	assert.Equal(t, true, summary["success"])
+	assert.Equal(t, float64(1), summary["warnings"])
+}
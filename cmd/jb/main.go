@@ -16,6 +16,7 @@ package main
 
 import (
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 
@@ -24,13 +25,24 @@ import (
 	"gopkg.in/alecthomas/kingpin.v2"
 
 	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/config"
+	"github.com/jsonnet-bundler/jsonnet-bundler/tool/sbom"
 )
 
 const (
-	installActionName = "install"
-	updateActionName  = "update"
-	initActionName    = "init"
-	rewriteActionName = "rewrite"
+	installActionName      = "install"
+	updateActionName       = "update"
+	initActionName         = "init"
+	rewriteActionName      = "rewrite"
+	serveActionName        = "serve"
+	lockActionName         = "lock"
+	validateActionName     = "validate"
+	configActionName       = "config"
+	checkImportsActionName = "check-imports"
+	jpathActionName        = "jpath"
+	execActionName         = "exec"
+	bundleActionName       = "bundle"
+	sbomActionName         = "sbom"
 )
 
 var Version = "dev"
@@ -42,6 +54,12 @@ func main() {
 func Main() int {
 	cfg := struct {
 		JsonnetHome string
+		GitBackend  string
+		GitCache    bool
+		CacheDir    string
+		Output      string
+		Quiet       bool
+		Proxy       string
 	}{}
 
 	color.Output = color.Error
@@ -49,10 +67,20 @@ func Main() int {
 	a := kingpin.New(filepath.Base(os.Args[0]), "A jsonnet package manager").Version(Version)
 	a.HelpFlag.Short('h')
 
-	a.Flag("jsonnetpkg-home", "The directory used to cache packages in.").
-		Default("vendor").StringVar(&cfg.JsonnetHome)
-	a.Flag("quiet", "Suppress any output from git command.").
-		Short('q').BoolVar(&pkg.GitQuiet)
+	a.Flag("jsonnetpkg-home", "The directory used to cache packages in. Defaults to `vendor`. Can also be set using $JB_VENDOR_DIR or `jb config set vendorDir`.").
+		StringVar(&cfg.JsonnetHome)
+	a.Flag("quiet", "Suppress any output from git command. Can also be set using $JB_QUIET or `jb config set quiet`.").
+		Short('q').BoolVar(&cfg.Quiet)
+	a.Flag("proxy", "Comma separated list of package proxies to retrieve git packages from. Use `direct` to fall back to the upstream repository. Can also be set using $JB_PROXY or `jb config set proxy`.").
+		StringVar(&cfg.Proxy)
+	a.Flag("git-backend", "Git implementation to use: `exec` invokes the git binary, `go` does not require it. Defaults to `exec`. Can also be set using $JB_GIT_BACKEND or `jb config set gitBackend`.").
+		EnumVar(&cfg.GitBackend, "exec", "go")
+	a.Flag("git-cache", "Keep a mirror of every git repository in the cache directory, so that updates only fetch new objects. Only supported by the exec git backend.").
+		Default("true").BoolVar(&cfg.GitCache)
+	a.Flag("cache-dir", "The directory jb caches downloaded data in. Defaults to the user cache directory. Can also be set using $JB_CACHE_DIR or `jb config set cacheDir`.").
+		StringVar(&cfg.CacheDir)
+	a.Flag("output", "Output format: `text` for humans, `json` for newline delimited JSON events on stdout.").
+		Default(outputText).EnumVar(&cfg.Output, outputText, outputJSON)
 
 	initCmd := a.Command(initActionName, "Initialize a new empty jsonnetfile")
 
@@ -60,11 +88,59 @@ func Main() int {
 	installCmdURIs := installCmd.Arg("uris", "URIs to packages to install, URLs or file paths").Strings()
 	installCmdSingle := installCmd.Flag("single", "install package without dependencies").Short('1').Bool()
 	installCmdLegacyName := installCmd.Flag("legacy-name", "set legacy name").String()
+	installCmdAlias := installCmd.Flag("as", "install package under a different vendor path and import name").String()
+	installCmdDryRun := installCmd.Flag("dry-run", "print the changes to the packages and lockfile without writing them").Bool()
+	installCmdPrune := installCmd.Flag("prune", "only keep the files of packages reachable from the entrypoints of the jsonnetfile, and licenses").Bool()
+	installCmdFromBundle := installCmd.Flag("from-bundle", "restore vendor from an archive of `jb bundle`, verifying the packages against the lockfile").String()
 
 	updateCmd := a.Command(updateActionName, "Update all or specific dependencies.")
 	updateCmdURIs := updateCmd.Arg("uris", "URIs to packages to update, URLs or file paths").Strings()
+	updateCmdDryRun := updateCmd.Flag("dry-run", "print the changes to the packages and lockfile without writing them").Bool()
+	updateCmdPrune := updateCmd.Flag("prune", "only keep the files of packages reachable from the entrypoints of the jsonnetfile, and licenses").Bool()
+
+	bundleCmd := a.Command(bundleActionName, "Write the jsonnetfile, the lockfile and the vendored packages to a reproducible archive, for `jb install --from-bundle`")
+	bundleCmdOut := bundleCmd.Flag("out", "Path of the archive").Short('o').Default("bundle.tar.gz").String()
 
 	rewriteCmd := a.Command(rewriteActionName, "Automatically rewrite legacy imports to absolute ones")
+	rewriteCmdDryRun := rewriteCmd.Flag("dry-run", "Print the changes as a diff instead of making them").Bool()
+	rewriteCmdCheck := rewriteCmd.Flag("check", "Fail if imports need to be rewritten, without rewriting them").Bool()
+
+	lockCmd := a.Command(lockActionName, "Manage jsonnetfile.lock.json")
+	lockResolveCmd := lockCmd.Command("resolve", "Resolve merge conflicts in jsonnetfile.lock.json")
+	lockResolveCmdDriver := lockResolveCmd.Flag("merge-driver", "Run as git merge driver, passing the %O %A %B %P placeholders as arguments").Bool()
+	lockResolveCmdFiles := lockResolveCmd.Arg("files", "Ancestor, current and other version of the lockfile and its path (merge driver only)").Strings()
+
+	validateCmd := a.Command(validateActionName, "Check jsonnetfiles and lockfiles for problems, like unknown fields")
+	validateCmdFiles := validateCmd.Arg("files", "Files to check. Defaults to the jsonnetfile and lockfile of the current directory").Strings()
+
+	checkImportsCmd := a.Command(checkImportsActionName, "Report imports of packages that are not direct dependencies, unresolved imports and unused dependencies")
+	checkImportsCmdJPath := checkImportsCmd.Flag("jpath", "Additional library search directory, like jsonnet's -J. The vendor directory is always searched.").Short('J').Strings()
+
+	jpathCmd := a.Command(jpathActionName, "Print the library search paths for the installed packages, which resolve legacy imports without symlinks")
+	jpathCmdFormat := jpathCmd.Flag("format", "Output format: `lines`, `flags` for jsonnet -J flags or `export` for a shell command setting $JSONNET_PATH").
+		Default(jpathLines).Enum(jpathLines, jpathFlags, jpathExport)
+	jpathCmdLegacy := jpathCmd.Flag("legacy-imports", "Include the directories resolving legacy imports").Default("true").Bool()
+
+	execCmd := a.Command(execActionName, "Run a command with $JSONNET_PATH set to the library search paths, e.g. `jb exec -- jsonnet main.jsonnet`")
+	execCmdLegacy := execCmd.Flag("legacy-imports", "Include the directories resolving legacy imports").Default("true").Bool()
+	execCmdArgs := execCmd.Arg("command", "Command to run and its arguments").Required().Strings()
+
+	sbomCmd := a.Command(sbomActionName, "Print a software bill of materials of the locked packages")
+	sbomCmdFormat := sbomCmd.Flag("format", "Document format: `cyclonedx` or `spdx`").
+		Default(sbom.FormatCycloneDX).Enum(sbom.FormatCycloneDX, sbom.FormatSPDX)
+
+	configCmd := a.Command(configActionName, "Show and change the settings of jb")
+	configListCmd := configCmd.Command("list", "Show all settings and where they are set")
+	configGetCmd := configCmd.Command("get", "Print a setting")
+	configGetCmdKey := configGetCmd.Arg("key", "Name of the setting").Required().String()
+	configSetCmd := configCmd.Command("set", "Change a setting of the project, in .jbrc. Passwords and tokens are stored in the user configuration.")
+	configSetCmdGlobal := configSetCmd.Flag("global", "Change the user configuration instead").Bool()
+	configSetCmdKey := configSetCmd.Arg("key", "Name of the setting").Required().String()
+	configSetCmdValue := configSetCmd.Arg("value", "New value, an empty one unsets the setting").Required().String()
+
+	serveCmd := a.Command(serveActionName, "Serve a caching package proxy")
+	serveCmdListen := serveCmd.Flag("listen", "Address to listen on").Default("127.0.0.1:8080").String()
+	serveCmdAllow := serveCmd.Flag("allow", "Only fetch packages from remotes of this host (e.g. `github.com`) or with this prefix (e.g. `https://github.com/grafana/`). Can be repeated.").Strings()
 
 	command, err := a.Parse(os.Args[1:])
 	if err != nil {
@@ -78,20 +154,92 @@ func Main() int {
 		return 1
 	}
 
-	cfg.JsonnetHome = filepath.Clean(cfg.JsonnetHome)
-
-	switch command {
-	case initCmd.FullCommand():
-		return initCommand(workdir)
-	case installCmd.FullCommand():
-		return installCommand(workdir, cfg.JsonnetHome, *installCmdURIs, *installCmdSingle, *installCmdLegacyName)
-	case updateCmd.FullCommand():
-		return updateCommand(workdir, cfg.JsonnetHome, *updateCmdURIs)
-	case rewriteCmd.FullCommand():
-		return rewriteCommand(workdir, cfg.JsonnetHome)
-	default:
-		installCommand(workdir, cfg.JsonnetHome, []string{}, false, "")
+	// flags take precedence over the configuration
+	layers, err := config.Load(workdir)
+	kingpin.FatalIfError(err, "loading configuration")
+	conf := config.Merge(layers)
+
+	cfg.JsonnetHome = filepath.Clean(firstOf(cfg.JsonnetHome, conf.VendorDir, "vendor"))
+	cfg.CacheDir = firstOf(cfg.CacheDir, conf.CacheDir, pkg.DefaultCacheDir())
+	cfg.GitBackend = firstOf(cfg.GitBackend, conf.GitBackend, "exec")
+
+	installerOptions.Proxy = firstOf(cfg.Proxy, conf.Proxy)
+	installerOptions.Mirrors = conf.Mirrors
+	installerOptions.Concurrency = conf.Concurrency
+	if len(conf.Auth) > 0 {
+		installerOptions.HTTPClient = &http.Client{Transport: config.Transport(nil, conf.Auth)}
+	}
+	installerOptions.GitBackend = pkg.GitBackends[cfg.GitBackend]
+	if cfg.GitCache && cfg.GitBackend == "exec" {
+		installerOptions.GitBackend = pkg.NewCachedGit(filepath.Join(cfg.CacheDir, "git"))
+	}
+	if cfg.Quiet || (conf.Quiet != nil && *conf.Quiet) {
+		installerOptions.Logger = nil
+	}
+	legacyImports := conf.LegacyImports == nil || *conf.LegacyImports
+
+	run := func() int {
+		switch command {
+		case initCmd.FullCommand():
+			return initCommand(workdir, legacyImports)
+		case installCmd.FullCommand():
+			installerOptions.Prune = *installCmdPrune
+			if *installCmdFromBundle != "" {
+				if len(*installCmdURIs) > 0 || *installCmdDryRun {
+					kingpin.Errorf("--from-bundle can't be combined with uris or --dry-run")
+					return 2
+				}
+				return installFromBundleCommand(workdir, cfg.JsonnetHome, *installCmdFromBundle)
+			}
+			return installCommand(workdir, cfg.JsonnetHome, *installCmdURIs, *installCmdSingle, *installCmdLegacyName, *installCmdAlias, *installCmdDryRun)
+		case updateCmd.FullCommand():
+			installerOptions.Prune = *updateCmdPrune
+			return updateCommand(workdir, cfg.JsonnetHome, *updateCmdURIs, *updateCmdDryRun)
+		case bundleCmd.FullCommand():
+			return bundleCommand(workdir, cfg.JsonnetHome, *bundleCmdOut)
+		case rewriteCmd.FullCommand():
+			return rewriteCommand(workdir, cfg.JsonnetHome, *rewriteCmdDryRun, *rewriteCmdCheck)
+		case lockResolveCmd.FullCommand():
+			if !*lockResolveCmdDriver {
+				return lockResolveCommand(workdir, cfg.JsonnetHome)
+			}
+			if len(*lockResolveCmdFiles) != 4 {
+				kingpin.Errorf("--merge-driver requires exactly 4 arguments: %%O %%A %%B %%P")
+				return 2
+			}
+			f := *lockResolveCmdFiles
+			return lockMergeDriverCommand(cfg.JsonnetHome, f[0], f[1], f[2], f[3])
+		case validateCmd.FullCommand():
+			return validateCommand(workdir, *validateCmdFiles)
+		case checkImportsCmd.FullCommand():
+			return checkImportsCommand(workdir, cfg.JsonnetHome, *checkImportsCmdJPath)
+		case jpathCmd.FullCommand():
+			return jpathCommand(workdir, cfg.JsonnetHome, *jpathCmdFormat, *jpathCmdLegacy)
+		case execCmd.FullCommand():
+			return execCommand(workdir, cfg.JsonnetHome, *execCmdArgs, *execCmdLegacy)
+		case sbomCmd.FullCommand():
+			return sbomCommand(workdir, cfg.JsonnetHome, *sbomCmdFormat)
+		case configListCmd.FullCommand():
+			return configListCommand(layers)
+		case configGetCmd.FullCommand():
+			return configGetCommand(layers, *configGetCmdKey)
+		case configSetCmd.FullCommand():
+			return configSetCommand(workdir, *configSetCmdKey, *configSetCmdValue, *configSetCmdGlobal)
+		case serveCmd.FullCommand():
+			return serveCommand(*serveCmdListen, cfg.CacheDir, *serveCmdAllow)
+		default:
+			installCommand(workdir, cfg.JsonnetHome, []string{}, false, "", "", false)
+		}
+
+		return 0
+	}
+
+	if cfg.Output == outputJSON {
+		o := useJSONOutput(os.Stdout, command)
+		code := run()
+		o.finish(code)
+		return code
 	}
 
-	return 0
+	return run()
 }
@@ -93,11 +93,13 @@ func TestParseDependency(t *testing.T) {
 	}
 	for _, tt := range tests {
 		_ = t.Run(tt.name, func(t *testing.T) {
-			dependency := deps.Parse("", tt.path)
+			dependency, err := deps.Parse("", tt.path)
 
-			if tt.path == "" {
+			if tt.want == nil {
+				assert.Error(t, err)
 				assert.Nil(t, dependency)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.want, dependency)
 			}
 		})
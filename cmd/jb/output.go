@@ -0,0 +1,156 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+const (
+	outputText = "text"
+	outputJSON = "json"
+
+	eventSummary = "summary"
+)
+
+// jsonOut is set when running with --output=json
+var jsonOut *jsonOutput
+
+// summary is the last object printed with --output=json
+type summary struct {
+	Type     string   `json:"type"`
+	Command  string   `json:"command"`
+	Success  bool     `json:"success"`
+	ExitCode int      `json:"exitCode"`
+	Errors   []string `json:"errors,omitempty"`
+
+	// number of events of each type
+	Fetched   int `json:"fetched"`
+	Cleaned   int `json:"cleaned"`
+	Linked    int `json:"linked"`
+	Warnings  int `json:"warnings"`
+	Packages  int `json:"packages"`
+	Installed int `json:"installed"`
+
+	// Changes to the lockfile, planned ones when using --dry-run
+	Changes []pkg.Change `json:"changes,omitempty"`
+}
+
+// jsonOutput prints events and the summary of a command as newline delimited
+// JSON
+type jsonOutput struct {
+	mu      sync.Mutex
+	enc     *json.Encoder
+	summary summary
+	errors  bytes.Buffer
+	done    bool
+}
+
+// useJSONOutput reports the events of command to w. Errors reported through
+// kingpin end up in the summary, which is printed when the command returns
+// or exits.
+func useJSONOutput(w io.Writer, command string) *jsonOutput {
+	o := &jsonOutput{
+		enc:     json.NewEncoder(w),
+		summary: summary{Type: eventSummary, Command: command},
+	}
+
+	installerOptions.Observer = o
+	kingpin.CommandLine.ErrorWriter(io.MultiWriter(os.Stderr, &o.errors))
+	kingpin.CommandLine.Terminate(func(code int) {
+		o.finish(code)
+		os.Exit(code)
+	})
+
+	jsonOut = o
+	return o
+}
+
+func (o *jsonOutput) Observe(e pkg.Event) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch e.Type {
+	case pkg.EventFetch:
+		o.summary.Fetched++
+	case pkg.EventClean:
+		o.summary.Cleaned++
+	case pkg.EventLink:
+		o.summary.Linked++
+	case pkg.EventWarn:
+		o.summary.Warnings++
+	case pkg.EventResult:
+		o.summary.Packages++
+		if e.Installed {
+			o.summary.Installed++
+		}
+	}
+	o.enc.Encode(e)
+}
+
+// finish prints the summary, once
+func (o *jsonOutput) finish(code int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.done {
+		return
+	}
+	o.done = true
+
+	prefix := kingpin.CommandLine.Name + ": error: "
+	for _, l := range strings.Split(strings.TrimSpace(o.errors.String()), "\n") {
+		if l != "" {
+			o.summary.Errors = append(o.summary.Errors, strings.TrimPrefix(l, prefix))
+		}
+	}
+
+	o.summary.ExitCode = code
+	o.summary.Success = code == 0
+	o.enc.Encode(o.summary)
+}
+
+// printLine prints s on stdout, or reports it as an output event when using
+// --output=json
+func printLine(s string) {
+	if jsonOut != nil {
+		jsonOut.Observe(pkg.Event{Type: pkg.EventOutput, Message: s})
+		return
+	}
+	fmt.Println(s)
+}
+
+// reportChanges adds the changes between the old and new locks to the summary
+// when using --output=json
+func reportChanges(old, new map[string]deps.Dependency) {
+	if jsonOut == nil {
+		return
+	}
+
+	jsonOut.mu.Lock()
+	defer jsonOut.mu.Unlock()
+	jsonOut.summary.Changes = pkg.CompareLocks(old, new)
+}
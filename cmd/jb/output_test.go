@@ -0,0 +1,130 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestJSONOutput(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "a", "main.libsonnet"), []byte(`{}`), 0644))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	var buf bytes.Buffer
+	o := useJSONOutput(&buf, "install")
+	defer func() {
+		jsonOut = nil
+		installerOptions.Observer = pkg.ObserverFunc(printEvent)
+		kingpin.CommandLine.ErrorWriter(os.Stderr).Terminate(os.Exit)
+	}()
+
+	require.Equal(t, 0, initCommand(root, true))
+	o.finish(installCommand(root, "vendor", []string{"a"}, false, "", "", false))
+
+	var events []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]interface{}
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+
+	require.Len(t, events, 4)
+	assert.Equal(t, map[string]interface{}{
+		"type": "init",
+		"path": filepath.Join(root, "jsonnetfile.json"),
+	}, events[0])
+	events = events[1:]
+	assert.Equal(t, map[string]interface{}{
+		"type":    "link",
+		"kind":    "local",
+		"package": "a",
+		"path":    filepath.Join(root, "vendor", "a"),
+		"target":  filepath.Join(root, "a"),
+	}, events[0])
+	assert.Equal(t, map[string]interface{}{
+		"type":      "result",
+		"package":   "a",
+		"installed": true,
+	}, events[1])
+
+	summary := events[2]
+	assert.Equal(t, "summary", summary["type"])
+	assert.Equal(t, "install", summary["command"])
+	assert.Equal(t, true, summary["success"])
+	assert.Equal(t, float64(1), summary["packages"])
+	assert.Equal(t, float64(1), summary["linked"])
+	require.Len(t, summary["changes"], 1)
+	assert.Equal(t, "add", summary["changes"].([]interface{})[0].(map[string]interface{})["action"])
+}
+
+func TestJSONOutputRewrite(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-output")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "vendor"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, jsonnetfile.LockFile), []byte(rewriteLock), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "main.jsonnet"), []byte(`import 'ksonnet.beta.4/k.libsonnet'`+"\n"), 0644))
+
+	var buf bytes.Buffer
+	o := useJSONOutput(&buf, "rewrite")
+	defer func() {
+		jsonOut = nil
+		installerOptions.Observer = pkg.ObserverFunc(printEvent)
+		kingpin.CommandLine.ErrorWriter(os.Stderr).Terminate(os.Exit)
+	}()
+
+	require.Equal(t, 0, rewriteCommand(root, "vendor", true, false))
+	require.Equal(t, 0, rewriteCommand(root, "vendor", false, false))
+	o.finish(0)
+
+	// nothing but events on stdout
+	var events []map[string]interface{}
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var e map[string]interface{}
+		require.NoError(t, dec.Decode(&e))
+		events = append(events, e)
+	}
+
+	require.Len(t, events, 3)
+	assert.Equal(t, "rewrite", events[0]["type"])
+	assert.Equal(t, "main.jsonnet", events[0]["path"])
+	assert.Contains(t, events[0]["diff"], "+import 'github.com/ksonnet/ksonnet-lib/ksonnet.beta.4/k.libsonnet'")
+	assert.Equal(t, map[string]interface{}{"type": "rewrite", "path": "main.jsonnet"}, events[1])
+	assert.Equal(t, "summary", events[2]["type"])
+}
@@ -0,0 +1,107 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// printPlan prints how the installed packages and the lockfile would change
+// when going from the old to the new locks
+func printPlan(lockFile string, oldBytes []byte, old, new map[string]deps.Dependency) error {
+	if jsonOut != nil {
+		reportChanges(old, new)
+		return nil
+	}
+
+	changes := pkg.CompareLocks(old, new)
+	if len(changes) == 0 {
+		fmt.Println("No packages would change.")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, c := range changes {
+		switch {
+		case c.Old == nil:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Action, c.Name, displayVersion(*c.New))
+		case c.New == nil:
+			fmt.Fprintf(w, "%s\t%s\t%s\n", c.Action, c.Name, displayVersion(*c.Old))
+		default:
+			fmt.Fprintf(w, "%s\t%s\t%s → %s\n", c.Action, c.Name, displayVersion(*c.Old), displayVersion(*c.New))
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	newBytes, err := json.MarshalIndent(v1.JsonnetFile{Dependencies: new, Lock: true}, "", "  ")
+	if err != nil {
+		return err
+	}
+	newBytes = append(newBytes, '\n')
+
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(string(oldBytes)),
+		B:        splitLines(string(newBytes)),
+		FromFile: lockFile,
+		ToFile:   lockFile,
+		Context:  3,
+	})
+	if err != nil {
+		return err
+	}
+	if diff != "" {
+		fmt.Println()
+		fmt.Print(diff)
+	}
+	return nil
+}
+
+// splitLines splits s into lines, keeping the line endings. Unlike
+// difflib.SplitLines, it adds no empty line to text ending in a newline.
+func splitLines(s string) []string {
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// displayVersion shortens commits, preferring the tag pointing at them
+func displayVersion(d deps.Dependency) string {
+	v := d.Version
+	if len(v) == 40 {
+		v = v[:7]
+	}
+	switch {
+	case v == "" && d.FetchSource().LocalSource != nil:
+		return "(local)"
+	case v == "":
+		return "-"
+	case d.Tag != "" && d.Tag != d.Version:
+		return fmt.Sprintf("%s (%s)", d.Tag, v)
+	}
+	return v
+}
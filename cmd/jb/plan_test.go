@@ -0,0 +1,56 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestInstallDryRun(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-dry-run")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "a"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, "a", "main.libsonnet"), []byte(`{}`), 0644))
+
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(root))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, initCommand(root, true))
+	jf, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.File))
+	require.NoError(t, err)
+
+	assert.Equal(t, 0, installCommand(root, "vendor", []string{"a"}, false, "", "", true))
+
+	after, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.File))
+	require.NoError(t, err)
+	assert.Equal(t, string(jf), string(after))
+
+	for _, name := range []string{jsonnetfile.LockFile, "vendor"} {
+		_, err = os.Stat(filepath.Join(root, name))
+		assert.True(t, os.IsNotExist(err), name)
+	}
+}
@@ -14,23 +14,85 @@
 package main
 
 import (
+	"fmt"
 	"path/filepath"
 
+	"github.com/pmezard/go-difflib/difflib"
+
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
 	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
 	"github.com/jsonnet-bundler/jsonnet-bundler/tool/rewrite"
 )
 
-func rewriteCommand(dir, vendorDir string) int {
+// rewriteCommand rewrites legacy imports. With dryRun, the changes are printed
+// as a diff instead. With check, the command fails if there are changes to be
+// made, without making them.
+func rewriteCommand(dir, vendorDir string, dryRun, check bool) int {
 	locks, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.LockFile))
 	if err != nil {
 		kingpin.Fatalf("Failed to load lockFile: %s.\nThe locks are required to compute the new import names. Make sure to run `jb install` first.", err)
 	}
 
-	if err := rewrite.Rewrite(dir, vendorDir, locks.Dependencies); err != nil {
+	changes, skipped, err := rewrite.Changes(dir, vendorDir, locks.Dependencies)
+	kingpin.FatalIfError(err, "")
+
+	// one broken file shouldn't keep the others from being rewritten
+	for _, s := range skipped {
+		installerOptions.Observer.Observe(pkg.Event{
+			Type:    pkg.EventWarn,
+			Message: fmt.Sprintf("skipping %s: %s", relName(dir, s.File), s.Err),
+		})
+	}
+
+	if !dryRun && !check {
+		kingpin.FatalIfError(rewrite.Apply(changes), "")
+		if jsonOut != nil {
+			for _, c := range changes {
+				jsonOut.Observe(pkg.Event{Type: pkg.EventRewrite, Path: relName(dir, c.File)})
+			}
+		}
+		return 0
+	}
+
+	for _, c := range changes {
+		name := relName(dir, c.File)
+
+		if !dryRun {
+			if jsonOut != nil {
+				jsonOut.Observe(pkg.Event{Type: pkg.EventRewrite, Path: name})
+			} else {
+				fmt.Println(name)
+			}
+			continue
+		}
+
+		diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines(string(c.Old)),
+			B:        splitLines(string(c.New)),
+			FromFile: "a/" + filepath.ToSlash(name),
+			ToFile:   "b/" + filepath.ToSlash(name),
+			Context:  3,
+		})
 		kingpin.FatalIfError(err, "")
+		if jsonOut != nil {
+			jsonOut.Observe(pkg.Event{Type: pkg.EventRewrite, Path: name, Diff: diff})
+		} else {
+			fmt.Print(diff)
+		}
 	}
 
+	if check && len(changes) > 0 {
+		return 1
+	}
 	return 0
 }
+
+// relName returns file relative to dir, if possible
+func relName(dir, file string) string {
+	if rel, err := filepath.Rel(dir, file); err == nil {
+		return rel
+	}
+	return file
+}
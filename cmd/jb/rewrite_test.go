@@ -0,0 +1,72 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+const rewriteLock = `{
+  "version": 1,
+  "dependencies": [
+    {
+      "source": {
+        "git": {
+          "remote": "https://github.com/ksonnet/ksonnet-lib.git",
+          "subdir": "ksonnet.beta.4"
+        }
+      },
+      "version": "0d2f82676817bbf9e4acf6495b2090205f323b9f"
+    }
+  ],
+  "legacyImports": false
+}
+`
+
+func TestRewriteCheck(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-rewrite")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	const main = `(import 'ksonnet.beta.4/k.libsonnet') + {}` + "\n"
+	const want = `(import 'github.com/ksonnet/ksonnet-lib/ksonnet.beta.4/k.libsonnet') + {}` + "\n"
+
+	name := filepath.Join(root, "main.jsonnet")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "vendor"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(root, jsonnetfile.LockFile), []byte(rewriteLock), 0644))
+	require.NoError(t, ioutil.WriteFile(name, []byte(main), 0644))
+
+	assert.Equal(t, 1, rewriteCommand(root, "vendor", false, true))
+	assert.Equal(t, 0, rewriteCommand(root, "vendor", true, false))
+
+	content, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, main, string(content))
+
+	assert.Equal(t, 0, rewriteCommand(root, "vendor", false, false))
+	content, err = ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(content))
+
+	assert.Equal(t, 0, rewriteCommand(root, "vendor", false, true))
+}
@@ -0,0 +1,54 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"time"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	"github.com/jsonnet-bundler/jsonnet-bundler/tool/sbom"
+)
+
+// sbomCommand prints the packages of the lockfile at dir as SBOM in format.
+// Licenses are detected in the vendor directory.
+func sbomCommand(dir, vendorDir, format string) int {
+	lockFile, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.LockFile))
+	if err != nil {
+		kingpin.Fatalf("Failed to load lockFile: %s.\nThe SBOM is generated from the locks. Make sure to run `jb install` first.", err)
+	}
+
+	doc, err := sbom.Generate(format, lockFile.Dependencies, sbom.Options{
+		Name:        filepath.Base(dir),
+		ToolVersion: Version,
+		Created:     time.Now(),
+		VendorDir:   filepath.Join(dir, vendorDir),
+	})
+	kingpin.FatalIfError(err, "generating SBOM")
+
+	// one line per event with --output=json
+	var b []byte
+	if jsonOut != nil {
+		b, err = json.Marshal(doc)
+	} else {
+		b, err = json.MarshalIndent(doc, "", "  ")
+	}
+	kingpin.FatalIfError(err, "encoding json")
+	printLine(string(b))
+	return 0
+}
@@ -0,0 +1,61 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/fatih/color"
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+)
+
+func serveCommand(listen, cacheDir string, allow []string) int {
+	if len(allow) == 0 && !loopback(listen) {
+		installerOptions.Observer.Observe(pkg.Event{
+			Type:    pkg.EventWarn,
+			Message: fmt.Sprintf("%s is reachable from other hosts, which can make the proxy fetch from any remote. Consider restricting them using --allow", listen),
+		})
+	}
+	color.Cyan("SERVE %s (cache: %s)", listen, cacheDir)
+
+	server := pkg.NewProxyServer(pkg.ProxyServerOptions{
+		CacheDir:   cacheDir,
+		HTTPClient: installerOptions.HTTPClient,
+		GitBackend: installerOptions.GitBackend,
+		Logger:     installerOptions.Logger,
+		Allow:      allow,
+	})
+	err := http.ListenAndServe(listen, server)
+	kingpin.FatalIfError(err, "serving package proxy")
+
+	return 0
+}
+
+// loopback returns whether the address only accepts connections from the
+// local host
+func loopback(listen string) bool {
+	host, _, err := net.SplitHostPort(listen)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
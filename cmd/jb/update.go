@@ -15,42 +15,51 @@
 package main
 
 import (
+	"io/ioutil"
 	"os"
 	"path/filepath"
 
 	"gopkg.in/alecthomas/kingpin.v2"
 
-	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
 	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
 	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
-func updateCommand(dir, jsonnetHome string, uris []string) int {
+func updateCommand(dir, jsonnetHome string, uris []string, dryRun bool) int {
 	if dir == "" {
 		dir = "."
 	}
 
+	if root, ws, ok := findWorkspace(dir); ok {
+		return workspaceUpdateCommand(root, ws, dir, jsonnetHome, uris, dryRun)
+	}
+
 	// load jsonnetfiles
-	jsonnetFile, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.File))
+	manifest, err := jsonnetfile.Manifest(dir)
+	kingpin.FatalIfError(err, "")
+	jbfilebytes, err := jsonnetfile.Read(manifest)
 	kingpin.FatalIfError(err, "failed to load jsonnetfile")
+	warnUnknownFields(manifest, jbfilebytes)
 
-	lockFile, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.LockFile))
+	jsonnetFile, err := jsonnetfile.Unmarshal(jbfilebytes)
+	kingpin.FatalIfError(err, "failed to load jsonnetfile")
+
+	jblockfilebytes, err := ioutil.ReadFile(filepath.Join(dir, jsonnetfile.LockFile))
 	kingpin.FatalIfError(err, "failed to load lockfile")
 
-	kingpin.FatalIfError(
-		os.MkdirAll(filepath.Join(dir, jsonnetHome, ".tmp"), os.ModePerm),
-		"creating vendor folder")
+	lockFile, err := jsonnetfile.UnmarshalLock(jblockfilebytes)
+	kingpin.FatalIfError(err, "failed to load lockfile")
 
-	locks := lockFile.Dependencies
+	locks := copyLocks(lockFile.Dependencies)
 
 	for _, u := range uris {
-		d := deps.Parse(dir, u)
-		if d == nil {
-			kingpin.Fatalf("Unable to parse package URI `%s`", u)
+		d, err := deps.Parse(dir, u)
+		if err != nil {
+			kingpin.Fatalf("Unable to parse package URI `%s`: %s", u, err)
 		}
 
-		delete(locks, d.Name())
+		forgetLocks(locks, d.Name())
 	}
 
 	// no uris: update all
@@ -58,12 +67,36 @@ func updateCommand(dir, jsonnetHome string, uris []string) int {
 		locks = make(map[string]deps.Dependency)
 	}
 
-	newLocks, err := pkg.Ensure(jsonnetFile, filepath.Join(dir, jsonnetHome), locks)
+	in := newInstaller(dir, jsonnetHome)
+	if dryRun {
+		newLocks, err := in.Plan(jsonnetFile, locks)
+		kingpin.FatalIfError(err, "failed to resolve packages")
+
+		kingpin.FatalIfError(printPlan(jsonnetfile.LockFile, jblockfilebytes, lockFile.Dependencies, newLocks), "")
+		return 0
+	}
+
+	kingpin.FatalIfError(
+		os.MkdirAll(filepath.Join(dir, jsonnetHome, ".tmp"), os.ModePerm),
+		"creating vendor folder")
+
+	newLocks, err := in.Ensure(jsonnetFile, locks)
 	kingpin.FatalIfError(err, "updating")
+	reportChanges(lockFile.Dependencies, newLocks)
 
 	kingpin.FatalIfError(
-		writeJSONFile(filepath.Join(dir, jsonnetfile.LockFile), v1.JsonnetFile{Dependencies: newLocks}),
+		writeJSONFile(filepath.Join(dir, jsonnetfile.LockFile), v1.JsonnetFile{Dependencies: newLocks, Lock: true}),
 		"updating jsonnetfile.lock.json")
 
 	return 0
 }
+
+// forgetLocks removes the locks of the named package, including the ones of
+// aliases of it, so that they are resolved again
+func forgetLocks(locks map[string]deps.Dependency, name string) {
+	for k, l := range locks {
+		if k == name || l.Source.Name() == name {
+			delete(locks, k)
+		}
+	}
+}
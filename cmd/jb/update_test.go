@@ -82,13 +82,13 @@ func (u UpdateCase) Run(t *testing.T) {
 	defer os.RemoveAll(dir)
 
 	if u.before == nil {
-		initCommand(dir)
+		initCommand(dir, true)
 	} else {
 		err = u.before.Write(dir)
 		require.NoError(t, err)
 	}
 
-	ret := updateCommand(dir, "vendor", u.uris)
+	ret := updateCommand(dir, "vendor", u.uris, false)
 	assert.Equal(t, ret, 0)
 
 	if u.after != nil {
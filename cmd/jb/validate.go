@@ -0,0 +1,71 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+// validateCommand prints a diagnostic for every problem in the given files,
+// in the file:line:column format understood by editors
+func validateCommand(dir string, files []string) int {
+	if dir == "" {
+		dir = "."
+	}
+
+	defaults := len(files) == 0
+	if defaults {
+		manifest, err := jsonnetfile.Manifest(dir)
+		kingpin.FatalIfError(err, "")
+		files = []string{manifest}
+
+		lock := filepath.Join(dir, jsonnetfile.LockFile)
+		exists, err := jsonnetfile.Exists(lock)
+		kingpin.FatalIfError(err, "failed to check for %s", lock)
+		if exists {
+			files = append(files, lock)
+		}
+	}
+
+	code := 0
+	for _, f := range files {
+		diags, err := jsonnetfile.Validate(f)
+		if err != nil {
+			kingpin.Errorf("%s", err)
+			code = 1
+			continue
+		}
+
+		for _, d := range diags {
+			// the default files are shown relative to the project
+			if rel, err := filepath.Rel(dir, d.File); err == nil && defaults {
+				d.File = rel
+			}
+			if jsonOut != nil {
+				jsonOut.Observe(pkg.Event{Type: pkg.EventProblem, Path: d.File, Message: d.String()})
+			} else {
+				fmt.Println(d)
+			}
+			code = 1
+		}
+	}
+	return code
+}
@@ -0,0 +1,189 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/alecthomas/kingpin.v2"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg"
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// findWorkspace looks for a jsonnetworkspace.json in dir and its parents. It
+// only reports a workspace if dir is its root or one of its members.
+func findWorkspace(dir string) (string, v1.Workspace, bool) {
+	abs, err := filepath.Abs(dir)
+	kingpin.FatalIfError(err, "")
+
+	for root := abs; ; root = filepath.Dir(root) {
+		exists, err := jsonnetfile.Exists(filepath.Join(root, jsonnetfile.WorkspaceFile))
+		kingpin.FatalIfError(err, "Failed to check for %s", jsonnetfile.WorkspaceFile)
+
+		if exists {
+			ws, err := jsonnetfile.LoadWorkspace(filepath.Join(root, jsonnetfile.WorkspaceFile))
+			kingpin.FatalIfError(err, "failed to load %s", jsonnetfile.WorkspaceFile)
+
+			if _, member := pkg.WorkspaceMember(root, ws, abs); root == abs || member {
+				return root, ws, true
+			}
+			return "", ws, false
+		}
+
+		if filepath.Dir(root) == root {
+			return "", v1.Workspace{}, false
+		}
+	}
+}
+
+func workspaceInstallCommand(root string, ws v1.Workspace, dir, jsonnetHome string, uris []string, single bool, legacyName, alias string, dryRun bool) int {
+	abs, err := filepath.Abs(dir)
+	kingpin.FatalIfError(err, "")
+	lockPath := filepath.Join(root, jsonnetfile.WorkspaceLockFile)
+
+	members, err := pkg.LoadWorkspaceMembers(root, ws)
+	kingpin.FatalIfError(err, "failed to load workspace members")
+
+	jblockfilebytes, err := ioutil.ReadFile(lockPath)
+	if !os.IsNotExist(err) {
+		kingpin.FatalIfError(err, "failed to load workspace lockfile")
+	}
+
+	lockFile, err := jsonnetfile.UnmarshalLock(jblockfilebytes)
+	kingpin.FatalIfError(err, "")
+
+	oldLocks := copyLocks(lockFile.Dependencies)
+
+	// new packages are added to the member jb was invoked in
+	var member, manifest string
+	var jbfilebytes []byte
+	if len(uris) > 0 {
+		var ok bool
+		member, ok = pkg.WorkspaceMember(root, ws, abs)
+		if !ok {
+			kingpin.Fatalf("cannot install packages into the workspace root, run `jb install` in one of its members instead")
+		}
+
+		manifest, err = jsonnetfile.Manifest(filepath.Join(root, member))
+		kingpin.FatalIfError(err, "")
+		jbfilebytes, err = jsonnetfile.Read(manifest)
+		kingpin.FatalIfError(err, "failed to load jsonnetfile")
+		warnUnknownFields(manifest, jbfilebytes)
+
+		jsonnetFile := members[member]
+		added := addDependencies(filepath.Join(root, member), &jsonnetFile, lockFile.Dependencies, uris, single, legacyName, alias)
+		if len(added) > 0 && !dryRun && jsonnetfile.IsJsonnet(manifest) {
+			return printDependencies(manifest, added)
+		}
+		members[member] = jsonnetFile
+	}
+
+	merged, err := pkg.MergeWorkspace(ws, members)
+	kingpin.FatalIfError(err, "failed to resolve workspace")
+
+	if dryRun {
+		locked, err := newInstaller(root, jsonnetHome).Plan(merged, lockFile.Dependencies)
+		kingpin.FatalIfError(err, "failed to resolve packages")
+
+		kingpin.FatalIfError(printPlan(jsonnetfile.WorkspaceLockFile, jblockfilebytes, oldLocks, locked), "")
+		return 0
+	}
+
+	kingpin.FatalIfError(
+		os.MkdirAll(filepath.Join(root, jsonnetHome, ".tmp"), os.ModePerm),
+		"creating vendor folder")
+
+	locked, err := newInstaller(root, jsonnetHome).Ensure(merged, lockFile.Dependencies)
+	kingpin.FatalIfError(err, "failed to install packages")
+	reportChanges(oldLocks, locked)
+
+	if member != "" {
+		jsonnetFile := members[member]
+		pkg.CleanLegacyName(jsonnetFile.Dependencies)
+
+		kingpin.FatalIfError(
+			writeChangedJsonnetFile(jbfilebytes, &jsonnetFile, manifest),
+			"updating jsonnetfile.json")
+	}
+
+	kingpin.FatalIfError(
+		writeChangedJsonnetFile(jblockfilebytes, &v1.JsonnetFile{Dependencies: locked, Lock: true}, lockPath),
+		"updating jsonnetworkspace.lock.json")
+
+	return 0
+}
+
+func workspaceUpdateCommand(root string, ws v1.Workspace, dir, jsonnetHome string, uris []string, dryRun bool) int {
+	abs, err := filepath.Abs(dir)
+	kingpin.FatalIfError(err, "")
+	lockPath := filepath.Join(root, jsonnetfile.WorkspaceLockFile)
+
+	members, err := pkg.LoadWorkspaceMembers(root, ws)
+	kingpin.FatalIfError(err, "failed to load workspace members")
+
+	jblockfilebytes, err := ioutil.ReadFile(lockPath)
+	if !os.IsNotExist(err) {
+		kingpin.FatalIfError(err, "failed to load workspace lockfile")
+	}
+
+	lockFile, err := jsonnetfile.UnmarshalLock(jblockfilebytes)
+	kingpin.FatalIfError(err, "")
+
+	locks := copyLocks(lockFile.Dependencies)
+
+	for _, u := range uris {
+		d, err := deps.Parse(abs, u)
+		if err != nil {
+			kingpin.Fatalf("Unable to parse package URI `%s`: %s", u, err)
+		}
+
+		forgetLocks(locks, d.Name())
+	}
+
+	// no uris: update all
+	if len(uris) == 0 {
+		locks = make(map[string]deps.Dependency)
+	}
+
+	merged, err := pkg.MergeWorkspace(ws, members)
+	kingpin.FatalIfError(err, "failed to resolve workspace")
+
+	if dryRun {
+		newLocks, err := newInstaller(root, jsonnetHome).Plan(merged, locks)
+		kingpin.FatalIfError(err, "failed to resolve packages")
+
+		kingpin.FatalIfError(printPlan(jsonnetfile.WorkspaceLockFile, jblockfilebytes, lockFile.Dependencies, newLocks), "")
+		return 0
+	}
+
+	kingpin.FatalIfError(
+		os.MkdirAll(filepath.Join(root, jsonnetHome, ".tmp"), os.ModePerm),
+		"creating vendor folder")
+
+	newLocks, err := newInstaller(root, jsonnetHome).Ensure(merged, locks)
+	kingpin.FatalIfError(err, "updating")
+	reportChanges(lockFile.Dependencies, newLocks)
+
+	kingpin.FatalIfError(
+		writeJSONFile(lockPath, v1.JsonnetFile{Dependencies: newLocks, Lock: true}),
+		"updating jsonnetworkspace.lock.json")
+
+	return 0
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestWorkspaceInstall(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write(jsonnetfile.WorkspaceFile, `{"version": 1, "members": ["environments/prod", "lib/common"]}`)
+	write("lib/common/jsonnetfile.json", `{"version": 1, "dependencies": []}`)
+	write("lib/common/main.libsonnet", `{}`)
+	write("environments/prod/jsonnetfile.json", `{"version": 1, "dependencies": []}`)
+
+	// install the other member from within a member
+	member := filepath.Join(root, "environments", "prod")
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(member))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, installCommand(member, "vendor", []string{"../../lib/common"}, false, "", "", false))
+
+	jf, err := ioutil.ReadFile(filepath.Join(member, jsonnetfile.File))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 1, "dependencies": [{"source": {"local": {"directory": "../../lib/common"}}, "version": ""}], "legacyImports": true}`, string(jf))
+
+	lock, err := ioutil.ReadFile(filepath.Join(root, jsonnetfile.WorkspaceLockFile))
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 2, "dependencies": [{"source": {"local": {"directory": "lib/common"}}, "version": "", "parents": ["."]}], "legacyImports": false}`, string(lock))
+
+	// vendored once, at the root of the workspace
+	_, err = os.Stat(filepath.Join(root, "vendor", "common", "main.libsonnet"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(member, "vendor"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWorkspaceInstallOutside(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-workspace")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	write := func(name, content string) {
+		require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	}
+
+	write(jsonnetfile.WorkspaceFile, `{"version": 1, "members": ["environments/prod", "lib/common"]}`)
+	write("lib/common/jsonnetfile.json", `{"version": 1, "dependencies": []}`)
+	write("lib/common/main.libsonnet", `{}`)
+	write("environments/prod/jsonnetfile.json", `{"version": 1, "dependencies": [{"source": {"local": {"directory": "../../lib/common"}}, "version": ""}]}`)
+
+	// invoked from outside of the workspace, which stays the working directory
+	outside := filepath.Join(root, "outside")
+	require.NoError(t, os.Mkdir(outside, os.ModePerm))
+	wd, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(outside))
+	defer os.Chdir(wd)
+
+	assert.Equal(t, 0, installCommand(filepath.Join(root, "environments", "prod"), "vendor", nil, false, "", "", false))
+
+	cwd, err := os.Getwd()
+	require.NoError(t, err)
+	assert.Equal(t, outside, cwd)
+
+	_, err = os.Stat(filepath.Join(root, jsonnetfile.WorkspaceLockFile))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, "vendor", "common", "main.libsonnet"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(outside, "vendor"))
+	assert.True(t, os.IsNotExist(err))
+}
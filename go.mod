@@ -1,17 +1,17 @@
 module github.com/jsonnet-bundler/jsonnet-bundler
 
-go 1.12
+go 1.16
 
 require (
 	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751 // indirect
 	github.com/alecthomas/units v0.0.0-20211218093645-b94a6e3cc137 // indirect
 	github.com/fatih/color v1.13.0
-	github.com/kr/pretty v0.3.0 // indirect
+	github.com/go-git/go-git/v5 v5.8.1
+	github.com/google/go-jsonnet v0.20.0
 	github.com/mattn/go-colorable v0.1.12 // indirect
 	github.com/pkg/errors v0.9.1
-	github.com/rogpeppe/go-internal v1.8.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0
 	github.com/stretchr/testify v1.7.4
-	golang.org/x/sys v0.0.0-20220615213510-4f61da869c0c // indirect
+	golang.org/x/mod v0.8.0
 	gopkg.in/alecthomas/kingpin.v2 v2.2.6
-	gopkg.in/check.v1 v1.0.0-20201130134442-10cb98267c6c // indirect
 )
@@ -0,0 +1,277 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// bundleVendor is the directory of bundles holding the vendored packages,
+// regardless of the vendor directory of the project
+const bundleVendor = "vendor"
+
+// WriteBundle writes a gzipped tar archive of the jsonnetfile manifest, the
+// lockfile and the packages of locks installed in vendorDir to w. All
+// packages must match their sums. Linked local packages are left out, as
+// they are no part of vendor, and so are the symlinks of legacy names, which
+// are created on install.
+//
+// The archive is reproducible: entries are sorted and have neither
+// modification times nor owners.
+func WriteBundle(w io.Writer, manifest, lockFile, vendorDir string, locks map[string]deps.Dependency) error {
+	owners := make(map[string]string, len(locks))
+	for name, l := range locks {
+		if linked(l) {
+			continue
+		}
+		if !check(l, vendorDir) {
+			return fmt.Errorf("%s does not match its sum in the lockfile, run jb install first", name)
+		}
+		owners[name] = name
+	}
+
+	var files []string
+	err := filepath.Walk(vendorDir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || owner(vendorDir, p, owners) == "" {
+			return nil
+		}
+		rel, err := filepath.Rel(vendorDir, p)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	sort.Strings(files)
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	for _, f := range []string{manifest, lockFile} {
+		if err := addBundleFile(tw, filepath.Base(f), f); err != nil {
+			return err
+		}
+	}
+	for _, f := range files {
+		if err := addBundleFile(tw, path.Join(bundleVendor, f), filepath.Join(vendorDir, filepath.FromSlash(f))); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// addBundleFile adds the file or symlink at p to tw as name
+func addBundleFile(tw *tar.Writer, name, p string) error {
+	info, err := os.Lstat(p)
+	if err != nil {
+		return err
+	}
+
+	hdr := &tar.Header{
+		Name:    name,
+		Mode:    0644,
+		ModTime: time.Unix(0, 0),
+		Format:  tar.FormatPAX,
+	}
+	if info.Mode()&0111 != 0 {
+		hdr.Mode = 0755
+	}
+
+	if info.Mode()&os.ModeSymlink != 0 {
+		hdr.Typeflag = tar.TypeSymlink
+		hdr.Mode = 0777
+		if hdr.Linkname, err = os.Readlink(p); err != nil {
+			return err
+		}
+		return tw.WriteHeader(hdr)
+	}
+
+	hdr.Typeflag = tar.TypeReg
+	hdr.Size = info.Size()
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(tw, f)
+	return err
+}
+
+// RestoreBundle replaces vendorDir with the packages of the bundle read from
+// r, once all of them match their sums in locks. If locks is nil, the
+// lockfile of the bundle is used instead. The locks the packages were
+// verified against are returned.
+func RestoreBundle(r io.Reader, vendorDir string, locks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	vendorDir = filepath.Clean(vendorDir)
+
+	// next to vendor, so that it can be renamed into its place
+	if err := os.MkdirAll(filepath.Dir(vendorDir), os.ModePerm); err != nil {
+		return nil, err
+	}
+	tmp, err := ioutil.TempDir(filepath.Dir(vendorDir), ".jb-bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+
+	lockData, err := extractBundle(r, tmp)
+	if err != nil {
+		return nil, errors.Wrap(err, "extracting bundle")
+	}
+
+	if locks == nil {
+		if lockData == nil {
+			return nil, fmt.Errorf("bundle has no %s", jsonnetfile.LockFile)
+		}
+		lockFile, err := jsonnetfile.UnmarshalLock(lockData)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bundled %s", jsonnetfile.LockFile)
+		}
+		locks = lockFile.Dependencies
+	}
+
+	names := make([]string, 0, len(locks))
+	for name := range locks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		l := locks[name]
+		if linked(l) {
+			continue
+		}
+		if !check(l, tmp) {
+			return nil, fmt.Errorf("%s in the bundle does not match its sum in the lockfile", name)
+		}
+	}
+
+	if err := os.RemoveAll(vendorDir); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(tmp, vendorDir); err != nil {
+		return nil, err
+	}
+	return locks, nil
+}
+
+// extractBundle writes the vendored packages of the bundle read from r to
+// vendorDir and returns the contents of its lockfile, if any
+func extractBundle(r io.Reader, vendorDir string) ([]byte, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	var lockData []byte
+	symlinks := make(map[string]bool)
+
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch hdr.Name {
+		case jsonnetfile.LockFile:
+			if lockData, err = ioutil.ReadAll(tr); err != nil {
+				return nil, err
+			}
+			continue
+		case jsonnetfile.File, jsonnetfile.FileJsonnet:
+			continue
+		}
+
+		name := path.Clean(hdr.Name)
+		if !strings.HasPrefix(name, bundleVendor+"/") {
+			return nil, fmt.Errorf("unexpected entry %s", hdr.Name)
+		}
+		name = strings.TrimPrefix(name, bundleVendor+"/")
+
+		// neither leave the vendor directory, nor write through symlinks
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			return nil, fmt.Errorf("entry %s is outside of vendor", hdr.Name)
+		}
+		for dir := path.Dir(name); dir != "."; dir = path.Dir(dir) {
+			if symlinks[dir] {
+				return nil, fmt.Errorf("entry %s is inside of a symlink", hdr.Name)
+			}
+		}
+
+		target := filepath.Join(vendorDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+			return nil, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			symlinks[name] = true
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return nil, err
+			}
+		case tar.TypeReg:
+			f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_EXCL, os.FileMode(hdr.Mode).Perm())
+			if err != nil {
+				return nil, err
+			}
+			if _, err := io.Copy(f, tr); err != nil {
+				f.Close()
+				return nil, err
+			}
+			if err := f.Close(); err != nil {
+				return nil, err
+			}
+		default:
+			return nil, fmt.Errorf("entry %s has unsupported type %c", hdr.Name, hdr.Typeflag)
+		}
+	}
+
+	return lockData, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestBundle(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	project := filepath.Join(tmp, "project")
+	vendorDir := filepath.Join(project, "vendor")
+	name := "github.com/jsonnet-bundler/lib"
+	writeFile(t, filepath.Join(vendorDir, name, "main.libsonnet"), "{}")
+	writeFile(t, filepath.Join(vendorDir, name, "util", "util.libsonnet"), "{}")
+	require.NoError(t, os.Symlink(name, filepath.Join(vendorDir, "lib")))
+	require.NoError(t, os.Symlink("../local", filepath.Join(vendorDir, "local")))
+
+	locks := map[string]deps.Dependency{
+		name: {
+			Source: deps.Source{GitSource: &deps.Git{Scheme: deps.GitSchemeHTTPS, Host: "github.com", User: "jsonnet-bundler", Repo: "lib"}},
+			Sum:    hashDir(filepath.Join(vendorDir, name)),
+		},
+		"local": {Source: deps.Source{LocalSource: &deps.Local{Directory: "local"}}},
+	}
+	writeFile(t, filepath.Join(project, jsonnetfile.File), `{"version": 1, "dependencies": []}`)
+	writeFile(t, filepath.Join(project, jsonnetfile.LockFile), `{"version": 1, "dependencies": []}`)
+
+	bundle := func() []byte {
+		var buf bytes.Buffer
+		err := WriteBundle(&buf, filepath.Join(project, jsonnetfile.File), filepath.Join(project, jsonnetfile.LockFile), vendorDir, locks)
+		require.NoError(t, err)
+		return buf.Bytes()
+	}
+
+	// modification times don't matter
+	first := bundle()
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(vendorDir, name, "main.libsonnet"), later, later))
+	data := bundle()
+	assert.Equal(t, first, data)
+
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+	var entries []string
+	for {
+		hdr, err := tr.Next()
+		if err != nil {
+			break
+		}
+		entries = append(entries, hdr.Name)
+		assert.Equal(t, int64(0), hdr.ModTime.Unix())
+	}
+	assert.Equal(t, []string{
+		jsonnetfile.File,
+		jsonnetfile.LockFile,
+		"vendor/" + name + "/main.libsonnet",
+		"vendor/" + name + "/util/util.libsonnet",
+	}, entries)
+
+	// restore into another project
+	other := filepath.Join(tmp, "other", "vendor")
+	writeFile(t, filepath.Join(other, "stale", "main.libsonnet"), "{}")
+	restored, err := RestoreBundle(bytes.NewReader(data), other, locks)
+	require.NoError(t, err)
+	assert.Equal(t, locks, restored)
+	assert.True(t, check(locks[name], other))
+	_, err = os.Stat(filepath.Join(other, "stale"))
+	assert.True(t, os.IsNotExist(err))
+
+	// without locks, the bundled lockfile applies
+	restored, err = RestoreBundle(bytes.NewReader(data), other, nil)
+	require.NoError(t, err)
+	assert.Equal(t, v1.New().Dependencies, restored)
+
+	// packages not matching the lock are rejected and vendor is left alone
+	tampered := locks[name]
+	tampered.Sum = hashDir(filepath.Join(vendorDir, name, "util"))
+	_, err = RestoreBundle(bytes.NewReader(data), other, map[string]deps.Dependency{name: tampered})
+	assert.Error(t, err)
+	assert.True(t, check(locks[name], other))
+
+	// and so are packages missing from vendor when bundling
+	require.NoError(t, os.Remove(filepath.Join(vendorDir, name, "util", "util.libsonnet")))
+	err = WriteBundle(ioutil.Discard, filepath.Join(project, jsonnetfile.File), filepath.Join(project, jsonnetfile.LockFile), vendorDir, locks)
+	assert.Error(t, err)
+}
+
+func TestRestoreBundleOutside(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-bundle")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	for _, entries := range [][]tar.Header{
+		{{Name: "vendor/../../evil", Typeflag: tar.TypeReg}},
+		{{Name: "evil", Typeflag: tar.TypeReg}},
+		{
+			{Name: "vendor/lib", Typeflag: tar.TypeSymlink, Linkname: tmp},
+			{Name: "vendor/lib/evil", Typeflag: tar.TypeReg},
+		},
+	} {
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		tw := tar.NewWriter(gz)
+		for _, hdr := range entries {
+			hdr := hdr
+			require.NoError(t, tw.WriteHeader(&hdr))
+		}
+		require.NoError(t, tw.Close())
+		require.NoError(t, gz.Close())
+
+		_, err := RestoreBundle(&buf, filepath.Join(tmp, "project", "vendor"), map[string]deps.Dependency{})
+		assert.Error(t, err, entries[len(entries)-1].Name)
+		_, err = os.Stat(filepath.Join(tmp, "evil"))
+		assert.True(t, os.IsNotExist(err))
+	}
+}
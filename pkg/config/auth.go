@@ -0,0 +1,56 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"net/http"
+)
+
+// Transport returns a RoundTripper adding the credentials of auth to the
+// requests to their host, using base for the actual requests. Hosts may
+// include a port.
+func Transport(base http.RoundTripper, auth map[string]Auth) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &authTransport{base: base, auth: auth}
+}
+
+type authTransport struct {
+	base http.RoundTripper
+	auth map[string]Auth
+}
+
+func (t *authTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	a, ok := t.auth[req.URL.Host]
+	if !ok {
+		a, ok = t.auth[req.URL.Hostname()]
+	}
+	if !ok {
+		return t.base.RoundTrip(req)
+	}
+
+	// RoundTrippers must not modify the request
+	req = req.Clone(req.Context())
+	switch {
+	case a.Token != "" && a.Header != "":
+		req.Header.Set(a.Header, a.Token)
+	case a.Token != "":
+		req.Header.Set("Authorization", "Bearer "+a.Token)
+	default:
+		req.SetBasicAuth(a.Username, a.Password)
+	}
+	return t.base.RoundTrip(req)
+}
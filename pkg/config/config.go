@@ -0,0 +1,453 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package config reads the settings of jb from the user configuration, the
+// project's .jbrc and the environment
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+const (
+	// ProjectFile holds the settings of a project. It is looked up in the
+	// working directory and its parents, up to the root of the project.
+	ProjectFile = ".jbrc"
+
+	// SourceEnv is the Layer of environment variables
+	SourceEnv = "env"
+)
+
+// Keys of the scalar settings. Auth and Mirrors are addressed as
+// `auth.<host>.<field>` and `mirrors.<prefix>`.
+const (
+	KeyVendorDir     = "vendorDir"
+	KeyCacheDir      = "cacheDir"
+	KeyProxy         = "proxy"
+	KeyGitBackend    = "gitBackend"
+	KeyQuiet         = "quiet"
+	KeyConcurrency   = "concurrency"
+	KeyLegacyImports = "legacyImports"
+
+	keyAuth    = "auth"
+	keyMirrors = "mirrors"
+)
+
+// env are the environment variables of the scalar settings
+var env = map[string]string{
+	KeyVendorDir:     "JB_VENDOR_DIR",
+	KeyCacheDir:      "JB_CACHE_DIR",
+	KeyProxy:         "JB_PROXY",
+	KeyGitBackend:    "JB_GIT_BACKEND",
+	KeyQuiet:         "JB_QUIET",
+	KeyConcurrency:   "JB_CONCURRENCY",
+	KeyLegacyImports: "JB_LEGACY_IMPORTS",
+}
+
+// Config holds the settings of jb. Unset fields are left to the next layer or
+// the defaults.
+type Config struct {
+	VendorDir     string `json:"vendorDir,omitempty"`
+	CacheDir      string `json:"cacheDir,omitempty"`
+	Proxy         string `json:"proxy,omitempty"`
+	GitBackend    string `json:"gitBackend,omitempty"`
+	Quiet         *bool  `json:"quiet,omitempty"`
+	Concurrency   int    `json:"concurrency,omitempty"`
+	LegacyImports *bool  `json:"legacyImports,omitempty"`
+
+	// Auth holds the credentials for HTTP requests by host
+	Auth map[string]Auth `json:"auth,omitempty"`
+	// Mirrors replace prefixes of git remotes, see pkg.InstallerOptions
+	Mirrors map[string]string `json:"mirrors,omitempty"`
+}
+
+// Auth are credentials for the requests to a host. A Token is sent in Header,
+// by default as `Authorization: Bearer <token>`. Otherwise, basic auth is
+// used.
+type Auth struct {
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Token    string `json:"token,omitempty"`
+	Header   string `json:"header,omitempty"`
+}
+
+// Layer is a source of settings
+type Layer struct {
+	// Source is the path of the file or SourceEnv
+	Source string
+	Config Config
+}
+
+// UserFile returns the path of the user configuration, usually
+// ~/.config/jb/config.json
+func UserFile() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "jb", "config.json"), nil
+}
+
+// FindProjectFile returns the ProjectFile in dir or the closest of its
+// parents up to the root of the project, which is the closest directory with a
+// jsonnetfile or, inside of a workspace, the root of the workspace. If dir is
+// part of no project, only dir itself is considered. An empty string is
+// returned if there is none.
+func FindProjectFile(dir string) string {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return ""
+	}
+
+	root := projectRoot(dir)
+	for {
+		path := filepath.Join(dir, ProjectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// projectRoot returns the root of the project the absolute directory dir is
+// part of, or dir itself if there is none
+func projectRoot(dir string) string {
+	root := ""
+	for d := dir; ; d = filepath.Dir(d) {
+		if exists(filepath.Join(d, jsonnetfile.WorkspaceFile)) {
+			return d
+		}
+		if root == "" && (exists(filepath.Join(d, jsonnetfile.File)) || exists(filepath.Join(d, jsonnetfile.FileJsonnet))) {
+			root = d
+		}
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	if root == "" {
+		return dir
+	}
+	return root
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// CheckProject reports settings a ProjectFile must not have. As it usually
+// comes with the project, it must not point jb at directories outside of it,
+// which are cleaned up when installing.
+func CheckProject(c Config) error {
+	dirs := []struct{ key, dir string }{
+		{KeyVendorDir, c.VendorDir},
+		{KeyCacheDir, c.CacheDir},
+	}
+	for _, d := range dirs {
+		if d.dir == "" {
+			continue
+		}
+		clean := filepath.Clean(d.dir)
+		if filepath.IsAbs(clean) || filepath.VolumeName(clean) != "" || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+			return fmt.Errorf("%s `%s` must be a relative path inside of the project", d.key, d.dir)
+		}
+	}
+	return nil
+}
+
+// Read reads the config at path. A missing file is an empty config.
+func Read(path string) (Config, error) {
+	var c Config
+
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return c, err
+	}
+
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, errors.Wrapf(err, "parsing %s", path)
+	}
+
+	// catch invalid values early, they are not checked by Unmarshal
+	for k, v := range c.Values() {
+		if err := (&Config{}).Set(k, v); err != nil {
+			return c, errors.Wrapf(err, "%s", path)
+		}
+	}
+	return c, nil
+}
+
+// Write writes c to path, creating its directory if required
+func Write(path string, c Config) error {
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(b, '\n'), 0600)
+}
+
+// Env returns the settings given by environment variables
+func Env() (Config, error) {
+	var c Config
+	for key, name := range env {
+		v, ok := os.LookupEnv(name)
+		if !ok || v == "" {
+			continue
+		}
+		if err := c.Set(key, v); err != nil {
+			return c, errors.Wrapf(err, "$%s", name)
+		}
+	}
+	return c, nil
+}
+
+// Load returns the layers of settings for the working directory dir, from the
+// lowest to the highest precedence: the user configuration, the ProjectFile
+// and the environment.
+func Load(dir string) ([]Layer, error) {
+	var layers []Layer
+
+	user, err := UserFile()
+	if err == nil {
+		c, err := Read(user)
+		if err != nil {
+			return nil, err
+		}
+		layers = append(layers, Layer{Source: user, Config: c})
+	}
+
+	if project := FindProjectFile(dir); project != "" {
+		c, err := Read(project)
+		if err != nil {
+			return nil, err
+		}
+		if err := CheckProject(c); err != nil {
+			return nil, errors.Wrapf(err, "%s", project)
+		}
+		layers = append(layers, Layer{Source: project, Config: c})
+	}
+
+	c, err := Env()
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, Layer{Source: SourceEnv, Config: c})
+
+	return layers, nil
+}
+
+// Merge returns the settings of all layers, later ones taking precedence
+func Merge(layers []Layer) Config {
+	var c Config
+	for _, l := range layers {
+		for k, v := range l.Config.Values() {
+			// values of layers are valid
+			_ = c.Set(k, v)
+		}
+	}
+	return c
+}
+
+// Values returns all settings that are set, by key
+func (c Config) Values() map[string]string {
+	values := make(map[string]string)
+	set := func(k, v string) {
+		if v != "" {
+			values[k] = v
+		}
+	}
+
+	set(KeyVendorDir, c.VendorDir)
+	set(KeyCacheDir, c.CacheDir)
+	set(KeyProxy, c.Proxy)
+	set(KeyGitBackend, c.GitBackend)
+	if c.Quiet != nil {
+		set(KeyQuiet, strconv.FormatBool(*c.Quiet))
+	}
+	if c.Concurrency != 0 {
+		set(KeyConcurrency, strconv.Itoa(c.Concurrency))
+	}
+	if c.LegacyImports != nil {
+		set(KeyLegacyImports, strconv.FormatBool(*c.LegacyImports))
+	}
+
+	for host, a := range c.Auth {
+		prefix := keyAuth + "." + host + "."
+		set(prefix+"username", a.Username)
+		set(prefix+"password", a.Password)
+		set(prefix+"token", a.Token)
+		set(prefix+"header", a.Header)
+	}
+	for prefix, mirror := range c.Mirrors {
+		set(keyMirrors+"."+prefix, mirror)
+	}
+
+	return values
+}
+
+// Get returns the setting of key, if set
+func (c Config) Get(key string) (string, bool) {
+	v, ok := c.Values()[key]
+	return v, ok
+}
+
+// Set changes the setting of key. An empty value unsets it.
+func (c *Config) Set(key, value string) error {
+	switch key {
+	case KeyVendorDir:
+		c.VendorDir = value
+	case KeyCacheDir:
+		c.CacheDir = value
+	case KeyProxy:
+		c.Proxy = value
+	case KeyGitBackend:
+		if value != "" && value != "exec" && value != "go" {
+			return fmt.Errorf("invalid %s `%s`, must be `exec` or `go`", key, value)
+		}
+		c.GitBackend = value
+	case KeyQuiet:
+		b, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.Quiet = b
+	case KeyConcurrency:
+		if value == "" {
+			c.Concurrency = 0
+			return nil
+		}
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid %s `%s`, must be a positive number", key, value)
+		}
+		c.Concurrency = n
+	case KeyLegacyImports:
+		b, err := parseBool(key, value)
+		if err != nil {
+			return err
+		}
+		c.LegacyImports = b
+	default:
+		return c.setNested(key, value)
+	}
+	return nil
+}
+
+// setNested sets `auth.<host>.<field>` and `mirrors.<prefix>` keys
+func (c *Config) setNested(key, value string) error {
+	switch {
+	case strings.HasPrefix(key, keyMirrors+"."):
+		prefix := strings.TrimPrefix(key, keyMirrors+".")
+		if value == "" {
+			delete(c.Mirrors, prefix)
+			return nil
+		}
+		if c.Mirrors == nil {
+			c.Mirrors = make(map[string]string)
+		}
+		c.Mirrors[prefix] = value
+		return nil
+
+	case strings.HasPrefix(key, keyAuth+"."):
+		rest := strings.TrimPrefix(key, keyAuth+".")
+		i := strings.LastIndex(rest, ".")
+		if i <= 0 {
+			return fmt.Errorf("invalid key `%s`, expected auth.<host>.<field>", key)
+		}
+		host, field := rest[:i], rest[i+1:]
+
+		a := c.Auth[host]
+		switch field {
+		case "username":
+			a.Username = value
+		case "password":
+			a.Password = value
+		case "token":
+			a.Token = value
+		case "header":
+			a.Header = value
+		default:
+			return fmt.Errorf("unknown auth field `%s`, expected one of username, password, token, header", field)
+		}
+
+		if c.Auth == nil {
+			c.Auth = make(map[string]Auth)
+		}
+		c.Auth[host] = a
+		if a == (Auth{}) {
+			delete(c.Auth, host)
+		}
+		return nil
+	}
+
+	return fmt.Errorf("unknown key `%s`, expected one of %s", key, strings.Join(Keys(), ", "))
+}
+
+// Keys returns the keys of all settings. Auth and mirrors are listed by
+// their pattern.
+func Keys() []string {
+	keys := make([]string, 0, len(env)+2)
+	for k := range env {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return append(keys, keyAuth+".<host>.<field>", keyMirrors+".<prefix>")
+}
+
+// EnvVar returns the environment variable of key, if there is one
+func EnvVar(key string) (string, bool) {
+	name, ok := env[key]
+	return name, ok
+}
+
+// Secret returns whether the setting of key should not be shown
+func Secret(key string) bool {
+	return strings.HasPrefix(key, keyAuth+".") &&
+		(strings.HasSuffix(key, ".password") || strings.HasSuffix(key, ".token"))
+}
+
+func parseBool(key, value string) (*bool, error) {
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s `%s`, must be true or false", key, value)
+	}
+	return &b, nil
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package config
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSet(t *testing.T) {
+	var c Config
+	require.NoError(t, c.Set(KeyVendorDir, "lib"))
+	require.NoError(t, c.Set(KeyQuiet, "true"))
+	require.NoError(t, c.Set(KeyConcurrency, "8"))
+	require.NoError(t, c.Set("mirrors.https://github.com/", "https://git.example.com/gh/"))
+	require.NoError(t, c.Set("auth.git.example.com.token", "secret"))
+
+	assert.Equal(t, map[string]string{
+		"vendorDir":                   "lib",
+		"quiet":                       "true",
+		"concurrency":                 "8",
+		"mirrors.https://github.com/": "https://git.example.com/gh/",
+		"auth.git.example.com.token":  "secret",
+	}, c.Values())
+	assert.Equal(t, Auth{Token: "secret"}, c.Auth["git.example.com"])
+
+	// empty values unset
+	require.NoError(t, c.Set(KeyQuiet, ""))
+	require.NoError(t, c.Set("auth.git.example.com.token", ""))
+	assert.Nil(t, c.Quiet)
+	assert.Empty(t, c.Auth)
+
+	for key, value := range map[string]string{
+		KeyGitBackend:          "svn",
+		KeyConcurrency:         "0",
+		KeyLegacyImports:       "maybe",
+		"auth.example.com.pin": "1234",
+		"auth.example":         "x",
+		"unknown":              "x",
+	} {
+		assert.Error(t, c.Set(key, value), key)
+	}
+}
+
+func TestMerge(t *testing.T) {
+	f := false
+	layers := []Layer{
+		{Source: "user", Config: Config{VendorDir: "lib", Proxy: "https://proxy.example.com", Mirrors: map[string]string{"a": "b"}}},
+		{Source: "project", Config: Config{VendorDir: "vendor", LegacyImports: &f}},
+		{Source: SourceEnv, Config: Config{Proxy: "direct"}},
+	}
+
+	assert.Equal(t, Config{
+		VendorDir:     "vendor",
+		Proxy:         "direct",
+		LegacyImports: &f,
+		Mirrors:       map[string]string{"a": "b"},
+	}, Merge(layers))
+}
+
+func TestLoad(t *testing.T) {
+	home, err := ioutil.TempDir("", "jbconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(home)
+
+	// os.UserConfigDir honors XDG_CONFIG_HOME on unix only
+	os.Setenv("XDG_CONFIG_HOME", filepath.Join(home, "config"))
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+	os.Setenv("JB_CONCURRENCY", "3")
+	defer os.Unsetenv("JB_CONCURRENCY")
+
+	user, err := UserFile()
+	require.NoError(t, err)
+	require.NoError(t, Write(user, Config{VendorDir: "lib", CacheDir: "/cache"}))
+
+	project := filepath.Join(home, "project")
+	sub := filepath.Join(project, "sub")
+	require.NoError(t, os.MkdirAll(sub, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, "jsonnetfile.json"), []byte(`{}`), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, ProjectFile), []byte(`{"vendorDir": "vendor"}`), 0644))
+
+	layers, err := Load(sub)
+	require.NoError(t, err)
+	require.Len(t, layers, 3)
+	assert.Equal(t, filepath.Join(project, ProjectFile), layers[1].Source)
+	assert.Equal(t, Config{VendorDir: "vendor", CacheDir: "/cache", Concurrency: 3}, Merge(layers))
+
+	// the search ends at the root of the project
+	require.NoError(t, ioutil.WriteFile(filepath.Join(home, ProjectFile), []byte(`{"vendorDir": ".."}`), 0644))
+	require.NoError(t, os.Remove(filepath.Join(project, ProjectFile)))
+	assert.Equal(t, "", FindProjectFile(sub))
+	require.NoError(t, os.Remove(filepath.Join(home, ProjectFile)))
+
+	// it must not point outside of the project
+	for _, dir := range []string{"..", "../lib", "/tmp/vendor", "lib/../.."} {
+		c, err := json.Marshal(Config{VendorDir: dir})
+		require.NoError(t, err)
+		require.NoError(t, ioutil.WriteFile(filepath.Join(project, ProjectFile), c, 0644))
+		_, err = Load(sub)
+		assert.Error(t, err, dir)
+	}
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, ProjectFile), []byte(`{"cacheDir": "/cache"}`), 0644))
+	_, err = Load(sub)
+	assert.Error(t, err)
+
+	// invalid values are reported with the file
+	require.NoError(t, ioutil.WriteFile(filepath.Join(project, ProjectFile), []byte(`{"gitBackend": "svn"}`), 0644))
+	_, err = Load(sub)
+	assert.Error(t, err)
+
+	os.Setenv("JB_CONCURRENCY", "many")
+	_, err = Env()
+	assert.Error(t, err)
+}
+
+func TestTransport(t *testing.T) {
+	var got http.Header
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header
+	}))
+	defer srv.Close()
+
+	host := srv.Listener.Addr().String()
+	get := func(auth map[string]Auth) {
+		client := &http.Client{Transport: Transport(nil, auth)}
+		resp, err := client.Get(srv.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+	}
+
+	get(map[string]Auth{host: {Token: "abc"}})
+	assert.Equal(t, "Bearer abc", got.Get("Authorization"))
+
+	get(map[string]Auth{host: {Token: "abc", Header: "Private-Token"}})
+	assert.Equal(t, "abc", got.Get("Private-Token"))
+	assert.Empty(t, got.Get("Authorization"))
+
+	get(map[string]Auth{"127.0.0.1": {Username: "jb", Password: "pw"}})
+	user, pass, ok := (&http.Request{Header: got}).BasicAuth()
+	assert.True(t, ok)
+	assert.Equal(t, "jb", user)
+	assert.Equal(t, "pw", pass)
+
+	get(map[string]Auth{"example.com": {Token: "abc"}})
+	assert.Empty(t, got.Get("Authorization"))
+}
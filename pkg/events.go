@@ -0,0 +1,93 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+const (
+	// EventFetch is an HTTP request for a package archive
+	EventFetch = "fetch"
+	// EventClean is the removal of an unknown directory from vendor
+	EventClean = "clean"
+	// EventLink is the creation of a symlink in vendor
+	EventLink = "link"
+	// EventCopy is the copy of a local package into vendor
+	EventCopy = "copy"
+	// EventWarn is a problem jb worked around
+	EventWarn = "warn"
+	// EventResult is a package settled on by the installation
+	EventResult = "result"
+
+	// EventInit is the creation of a jsonnetfile by jb init
+	EventInit = "init"
+	// EventRewrite is a file whose legacy imports are (or would be) rewritten
+	EventRewrite = "rewrite"
+	// EventProblem is a problem found by jb check-imports or jb validate
+	EventProblem = "problem"
+	// EventOutput is a line of output of commands without dedicated events,
+	// e.g. a search path printed by jb jpath
+	EventOutput = "output"
+)
+
+const (
+	// LinkLocal links a local package to its directory
+	LinkLocal = "local"
+	// LinkLegacy links the legacy name of a package to its vendor path
+	LinkLegacy = "legacy"
+)
+
+// Event describes a step of an installation or of another command. Only the
+// fields relevant to the Type are set.
+type Event struct {
+	Type string `json:"type"`
+
+	// Package is the name of the package concerned
+	Package string `json:"package,omitempty"`
+
+	// URL and Status of fetch events
+	URL    string `json:"url,omitempty"`
+	Status int    `json:"status,omitempty"`
+
+	// Path is the cleaned directory of clean events, the symlink of link
+	// events, pointing at Target, and the copy of copy events, copied from
+	// Target. Kind is either LinkLocal or LinkLegacy. Path is also the file
+	// of init, rewrite and problem events, Kind the one of problems found by
+	// jb check-imports.
+	Path   string `json:"path,omitempty"`
+	Target string `json:"target,omitempty"`
+	Kind   string `json:"kind,omitempty"`
+
+	// Message of warn, problem and output events
+	Message string `json:"message,omitempty"`
+
+	// Diff of rewrite events with --dry-run
+	Diff string `json:"diff,omitempty"`
+
+	// Version and Sum of result events. Installed is false if the package
+	// was already present in vendor.
+	Version   string `json:"version,omitempty"`
+	Sum       string `json:"sum,omitempty"`
+	Installed bool   `json:"installed,omitempty"`
+}
+
+// Observer is notified of the events of installations
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is an Observer calling itself
+type ObserverFunc func(Event)
+
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
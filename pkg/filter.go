@@ -0,0 +1,134 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// filtered returns whether d limits the files it vendors
+func filtered(d deps.Dependency) bool {
+	return len(d.Include) > 0 || len(d.Exclude) > 0
+}
+
+// filtersChanged returns whether the locked and the requested dependency
+// differ in the files they vendor
+func filtersChanged(l, d deps.Dependency) bool {
+	return !reflect.DeepEqual(l.Include, d.Include) || !reflect.DeepEqual(l.Exclude, d.Exclude)
+}
+
+// filter removes the files from the package in dir that are not included or
+// are excluded, along with the directories left empty
+func filter(dir string, include, exclude []string) error {
+	var dirs []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == dir {
+			return nil
+		}
+		if info.IsDir() {
+			dirs = append(dirs, p)
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		ok, err := included(filepath.ToSlash(rel), include, exclude)
+		if err != nil {
+			return err
+		}
+		if !ok && !keep(info.Name()) {
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// innermost first, non-empty ones fail to be removed
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return nil
+}
+
+// included returns whether the file name is matched by any of the include
+// patterns, if there are some, and none of the exclude ones
+func included(name string, include, exclude []string) (bool, error) {
+	if len(include) > 0 {
+		ok, err := matchAny(include, name)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+
+	ok, err := matchAny(exclude, name)
+	return !ok, err
+}
+
+// matchAny returns whether any of the patterns matches name or one of the
+// directories containing it
+func matchAny(patterns []string, name string) (bool, error) {
+	for _, pattern := range patterns {
+		pattern := strings.Split(strings.Trim(pattern, "/"), "/")
+		for n := name; n != "."; n = path.Dir(n) {
+			ok, err := matchGlob(pattern, strings.Split(n, "/"))
+			if err != nil {
+				return false, errors.Wrapf(err, "pattern `%s`", strings.Join(pattern, "/"))
+			}
+			if ok {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// matchGlob matches the segments of a path against those of a pattern, like
+// path.Match does. `**` matches any number of segments.
+func matchGlob(pattern, name []string) (bool, error) {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if ok, err := matchGlob(pattern[1:], name[i:]); err != nil || ok {
+					return ok, err
+				}
+			}
+			return false, nil
+		}
+
+		if len(name) == 0 {
+			return false, nil
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false, err
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0, nil
+}
@@ -0,0 +1,149 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestIncluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		want    bool
+	}{
+		{name: "main.libsonnet", want: true},
+		{name: "main.libsonnet", include: []string{"*.libsonnet"}, want: true},
+		{name: "lib/main.libsonnet", include: []string{"*.libsonnet"}, want: false},
+		{name: "lib/main.libsonnet", include: []string{"**/*.libsonnet"}, want: true},
+		{name: "lib/main.libsonnet", include: []string{"lib"}, want: true},
+		{name: "lib/main.libsonnet", include: []string{"lib/"}, want: true},
+		{name: "tests/a.jsonnet", exclude: []string{"tests"}, want: false},
+		{name: "a/tests/b/c.jsonnet", exclude: []string{"**/tests/**"}, want: false},
+		{name: "a/tests/b/c.jsonnet", exclude: []string{"tests"}, want: true},
+		{name: "docs/a.md", include: []string{"**"}, exclude: []string{"docs"}, want: false},
+	}
+
+	for _, tc := range tests {
+		got, err := included(tc.name, tc.include, tc.exclude)
+		require.NoError(t, err)
+		assert.Equal(t, tc.want, got, "%s %v %v", tc.name, tc.include, tc.exclude)
+	}
+
+	_, err := included("a", []string{"["}, nil)
+	assert.Error(t, err)
+}
+
+func TestEnsureFilter(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "jb-filter")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare := filepath.Join(tmp, "repo.git")
+	dependency := func(subdir string) deps.Dependency {
+		d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/"+subdir+"@v1")
+		require.NoError(t, err)
+		return *d
+	}
+
+	// lib depends on a and b, which live in the same repository
+	nested := v1.New()
+	for _, subdir := range []string{"a", "b"} {
+		d := dependency(subdir)
+		nested.Dependencies[d.Name()] = d
+	}
+	manifest, err := json.Marshal(nested)
+	require.NoError(t, err)
+
+	work := filepath.Join(tmp, "work")
+	for name, content := range map[string]string{
+		"lib/jsonnetfile.json":        string(manifest),
+		"lib/main.libsonnet":          "{}",
+		"lib/LICENSE":                 "Apache-2.0",
+		"lib/docs/index.md":           "docs",
+		"lib/tests/main_test.jsonnet": "{}",
+		"lib/examples/a.jsonnet":      "{}",
+		"a/main.libsonnet":            "{}",
+		"b/main.libsonnet":            "{}",
+	} {
+		writeFile(t, filepath.Join(work, name), content)
+	}
+	testGit(t, work, "init", "-q")
+	testGit(t, work, "add", ".")
+	testGit(t, work, "commit", "-q", "-m", "initial")
+	testGit(t, work, "tag", "v1")
+	testGit(t, tmp, "clone", "-q", "--bare", work, bare)
+
+	root := filepath.Join(tmp, "project")
+	lib := dependency("lib")
+	lib.Include = []string{"**/*.libsonnet", "examples"}
+	lib.Exclude = []string{"examples/*.jsonnet"}
+	lib.ExcludeDependencies = []string{dependency("b").Name()}
+
+	jf := v1.New()
+	jf.Dependencies[lib.Name()] = lib
+
+	in, err := NewInstaller(InstallerOptions{RootDir: root})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+	locks, err := in.Ensure(jf, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	vendored := filepath.Join(root, "vendor", lib.Name())
+	for name, want := range map[string]bool{
+		"jsonnetfile.json": true,
+		"main.libsonnet":   true,
+		"LICENSE":          true,
+		"docs":             false,
+		"tests":            false,
+		"examples":         false,
+	} {
+		_, err := os.Stat(filepath.Join(vendored, name))
+		assert.Equal(t, want, err == nil, name)
+	}
+
+	assert.Contains(t, locks, dependency("a").Name())
+	assert.NotContains(t, locks, dependency("b").Name())
+	assert.Equal(t, hashDir(vendored), locks[lib.Name()].Sum)
+	assert.Equal(t, lib.Include, locks[lib.Name()].Include)
+
+	// changing the patterns installs the package again
+	jf.Dependencies[lib.Name()] = dependency("lib")
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+	locks, err = in.Ensure(jf, locks)
+	require.NoError(t, err)
+
+	_, err = os.Stat(filepath.Join(vendored, "docs", "index.md"))
+	assert.NoError(t, err)
+	assert.Contains(t, locks, dependency("b").Name())
+	assert.Equal(t, hashDir(vendored), locks[lib.Name()].Sum)
+}
@@ -15,20 +15,15 @@
 package pkg
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
-	"io/ioutil"
-	"net/http"
 	"os"
-	"os/exec"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 
-	"github.com/fatih/color"
 	"github.com/pkg/errors"
 
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
@@ -36,6 +31,17 @@ import (
 
 type GitPackage struct {
 	Source *deps.Git
+
+	// Backend performs the git operations. DefaultGitBackend is used if unset.
+	Backend GitBackend
+
+	// Remote is retrieved from instead of the remote of Source, e.g. a
+	// mirror of it
+	Remote string
+
+	Env
+
+	resolved Resolved
 }
 
 func NewGitPackage(source *deps.Git) Interface {
@@ -44,52 +50,18 @@ func NewGitPackage(source *deps.Git) Interface {
 	}
 }
 
-var GitQuiet = false
-
-func downloadGitHubArchive(filepath string, url string) error {
-	// Get the data
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-	if !GitQuiet {
-		color.Cyan("GET %s %d", url, resp.StatusCode)
-	}
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
-	}
-
-	defer resp.Body.Close()
-
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
-
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return err
+func (p *GitPackage) backend() GitBackend {
+	if p.Backend != nil {
+		return p.Backend
 	}
-
-	return nil
+	return DefaultGitBackend
 }
 
-func remoteResolveRef(ctx context.Context, remote string, ref string) (string, error) {
-	b := &bytes.Buffer{}
-	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", "--refs", "--quiet", remote, ref)
-	cmd.Stdin = os.Stdin
-	cmd.Stdout = b
-	cmd.Stderr = os.Stderr
-	err := cmd.Run()
-	if err != nil {
-		return "", err
+func (p *GitPackage) remote() string {
+	if p.Remote != "" {
+		return p.Remote
 	}
-	commitShaPattern := regexp.MustCompile("^([0-9a-f]{40,})\\b")
-	commitSha := commitShaPattern.FindString(b.String())
-	return commitSha, nil
+	return p.Source.Remote()
 }
 
 func (p *GitPackage) Install(ctx context.Context, name, dir, version string) (string, error) {
@@ -102,12 +74,21 @@ func (p *GitPackage) Install(ctx context.Context, name, dir, version string) (st
 	defer os.RemoveAll(tmpDir)
 
 	// Optimization for GitHub sources: download a tarball archive of the requested
-	// version instead of cloning the entire
-	isGitHubRemote, err := regexp.MatchString(`^(https|ssh)://github\.com/.+$`, p.Source.Remote())
-	if isGitHubRemote {
+	// version instead of cloning the entire repository. Not needed if a
+	// mirror is kept anyway, fetching into it is cheaper, at the price of
+	// leaving the archiveDigest of the lock empty. Archives include neither
+	// submodules nor LFS files.
+	_, cached := p.backend().(*CachedGit)
+	isGitHubRemote, err := regexp.MatchString(`^(https|ssh)://github\.com/.+$`, p.remote())
+	if isGitHubRemote && !cached && !p.Source.Submodules && !p.Source.LFS {
 		// Let git ls-remote decide if "version" is a ref or a commit SHA in the unlikely
 		// but possible event that a ref is comprised of 40 or more hex characters
-		commitSha, err := remoteResolveRef(ctx, p.Source.Remote(), version)
+		var commitSha, ref string
+		if r, ok := p.backend().(refResolver); ok {
+			commitSha, ref, err = r.resolveRef(ctx, p.remote(), version)
+		} else {
+			commitSha, err = p.backend().ResolveRef(ctx, p.remote(), version)
+		}
 
 		// If the ref resolution failed and "version" looks like a SHA,
 		// assume it is one and proceed.
@@ -116,11 +97,11 @@ func (p *GitPackage) Install(ctx context.Context, name, dir, version string) (st
 			commitSha = version
 		}
 
-		archiveUrl := fmt.Sprintf("%s/archive/%s.tar.gz", strings.TrimSuffix(p.Source.Remote(), ".git"), commitSha)
+		archiveUrl := fmt.Sprintf("%s/archive/%s.tar.gz", strings.TrimSuffix(p.remote(), ".git"), commitSha)
 		archiveFilepath := fmt.Sprintf("%s.tar.gz", tmpDir)
 
 		defer os.Remove(archiveFilepath)
-		err = downloadGitHubArchive(archiveFilepath, archiveUrl)
+		err = p.downloadFile(ctx, archiveFilepath, archiveUrl)
 		if err == nil {
 			var ar *os.File
 			ar, err = os.Open(archiveFilepath)
@@ -143,87 +124,30 @@ func (p *GitPackage) Install(ctx context.Context, name, dir, version string) (st
 		}
 
 		if err == nil {
+			digest, err := hashFile(archiveFilepath)
+			if err != nil {
+				return "", err
+			}
+			// only a tag requested by name is known without listing all of them
+			var tags []string
+			if strings.HasPrefix(ref, "refs/tags/") {
+				tags = []string{strings.TrimPrefix(ref, "refs/tags/")}
+			}
+			p.resolved = Resolved{Tag: tagOf(version, tags), ArchiveDigest: digest}
 			return commitSha, nil
 		}
 
 		// The repository may be private or the archive download may not work
 		// for other reasons. In any case, fall back to the slower git-based installation.
-		color.Yellow("archive install failed: %s", err)
-		color.Yellow("retrying with git...")
-	}
-
-	gitCmd := func(args ...string) *exec.Cmd {
-		cmd := exec.CommandContext(ctx, "git", args...)
-		cmd.Stdin = os.Stdin
-		if GitQuiet {
-			cmd.Stdout = nil
-			cmd.Stderr = nil
-		} else {
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-		}
-		cmd.Dir = tmpDir
-		return cmd
-	}
-
-	cmd := gitCmd("init")
-	err = cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	cmd = gitCmd("remote", "add", "origin", p.Source.Remote())
-	err = cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	// Attempt shallow fetch at specific revision
-	cmd = gitCmd("fetch", "--tags", "--depth", "1", "origin", version)
-	err = cmd.Run()
-	if err != nil {
-		// Fall back to normal fetch (all revisions)
-		cmd = gitCmd("fetch", "origin")
-		err = cmd.Run()
-		if err != nil {
-			return "", err
-		}
-	}
-
-	// Sparse checkout optimization: if a Subdir is specified,
-	// there is no need to do a full checkout
-	if p.Source.Subdir != "" {
-		cmd = gitCmd("config", "core.sparsecheckout", "true")
-		err = cmd.Run()
-		if err != nil {
-			return "", err
-		}
-
-		glob := []byte(p.Source.Subdir + "/*\n")
-		err = ioutil.WriteFile(filepath.Join(tmpDir, ".git", "info", "sparse-checkout"), glob, 0644)
-		if err != nil {
-			return "", err
-		}
-	}
-
-	cmd = gitCmd("-c", "advice.detachedHead=false", "checkout", version)
-	err = cmd.Run()
-	if err != nil {
-		return "", err
+		p.emit(Event{Type: EventWarn, Package: name, Message: fmt.Sprintf("archive install failed: %s, retrying with git", err)})
 	}
 
-	b := bytes.NewBuffer(nil)
-	cmd = exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
-	cmd.Stdout = b
-	cmd.Dir = tmpDir
-	err = cmd.Run()
-	if err != nil {
-		return "", err
-	}
-
-	commitHash := strings.TrimSpace(b.String())
-
-	err = os.RemoveAll(path.Join(tmpDir, ".git"))
+	checkout, err := p.backend().Checkout(ctx, p.remote(), version, tmpDir, GitCheckoutOptions{
+		Subdir:     p.Source.Subdir,
+		Submodules: p.Source.Submodules,
+		LFS:        p.Source.LFS,
+		Output:     p.Logger,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -243,5 +167,33 @@ func (p *GitPackage) Install(ctx context.Context, name, dir, version string) (st
 		return "", errors.Wrap(err, "failed to move package")
 	}
 
-	return commitHash, nil
+	p.resolved = Resolved{Tag: tagOf(version, checkout.Tags)}
+	return checkout.Commit, nil
+}
+
+func (p *GitPackage) Resolved() Resolved {
+	return p.resolved
+}
+
+// refResolver is implemented by backends that can tell the full name of the
+// ref a version resolves to, e.g. refs/tags/v1
+type refResolver interface {
+	resolveRef(ctx context.Context, remote, ref string) (string, string, error)
+}
+
+// tagOf picks one of the tags pointing at the installed commit, preferring
+// the requested version over others
+func tagOf(version string, tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	for _, t := range tags {
+		if t == version {
+			return version
+		}
+	}
+
+	names := append([]string(nil), tags...)
+	sort.Strings(names)
+	return names[0]
 }
@@ -0,0 +1,282 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// GitBackend performs the git operations required for installing git
+// packages
+type GitBackend interface {
+	// ListRefs returns the names of all branches and tags of the remote
+	ListRefs(ctx context.Context, remote string) ([]string, error)
+
+	// ResolveRef returns the commit ref (a branch or tag) points to at the
+	// remote. An empty string is returned if there is no such ref.
+	ResolveRef(ctx context.Context, remote, ref string) (string, error)
+
+	// Checkout retrieves version (a ref or commit sha) from the remote and
+	// writes the files of that commit into dest, which must exist. The
+	// resolved commit sha is returned, along with the tags pointing at it.
+	Checkout(ctx context.Context, remote, version, dest string, opts GitCheckoutOptions) (GitCheckout, error)
+}
+
+// GitCheckout is the commit written by GitBackend.Checkout
+type GitCheckout struct {
+	// Commit is the sha of the commit
+	Commit string
+	// Tags point at Commit. Only the tags learned while fetching are
+	// included, the remote is not asked again, so this may be incomplete.
+	Tags []string
+}
+
+// GitCheckoutOptions control which files GitBackend.Checkout writes
+type GitCheckoutOptions struct {
+	// Subdir is the only directory required to be written, if set
+	Subdir string
+	// Submodules checks out all submodules, recursively
+	Submodules bool
+	// LFS replaces Git LFS pointers with the actual file contents
+	LFS bool
+	// Output receives the progress of git. It is discarded if nil.
+	Output io.Writer
+}
+
+// GitBackends are all available git backends by name
+var GitBackends = map[string]GitBackend{
+	"exec": ExecGit{},
+	"go":   GoGit{},
+}
+
+// DefaultGitBackend is used by git packages that don't set one explicitly
+var DefaultGitBackend GitBackend = ExecGit{}
+
+// ExecGit is a GitBackend invoking the `git` binary
+type ExecGit struct{}
+
+func (ExecGit) ListRefs(ctx context.Context, remote string) ([]string, error) {
+	b := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", "--refs", "--quiet", remote)
+	cmd.Stdout = b
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return nil, err
+	}
+
+	refs := []string{}
+	for _, line := range strings.Split(b.String(), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		ref := strings.TrimPrefix(fields[1], "refs/heads/")
+		ref = strings.TrimPrefix(ref, "refs/tags/")
+		refs = append(refs, ref)
+	}
+	sort.Strings(refs)
+	return refs, nil
+}
+
+func (g ExecGit) ResolveRef(ctx context.Context, remote, ref string) (string, error) {
+	commit, _, err := g.resolveRef(ctx, remote, ref)
+	return commit, err
+}
+
+// resolveRef is like ResolveRef, but also returns the full name of the
+// matching ref, e.g. refs/tags/v1
+func (ExecGit) resolveRef(ctx context.Context, remote, ref string) (string, string, error) {
+	b := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", "ls-remote", "--heads", "--tags", "--refs", "--quiet", remote, ref)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = b
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if err != nil {
+		return "", "", err
+	}
+	commitShaPattern := regexp.MustCompile("^([0-9a-f]{40,})\\s+(\\S+)")
+	m := commitShaPattern.FindStringSubmatch(b.String())
+	if m == nil {
+		return "", "", nil
+	}
+	return m[1], m[2], nil
+}
+
+// gitCommand prepares invoking git in dir, passing its output to out
+func gitCommand(ctx context.Context, dir string, out io.Writer, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = out
+	cmd.Stderr = out
+	cmd.Dir = dir
+	return cmd
+}
+
+// tagsAt returns the tags of the repository at dir pointing at rev. Tags are
+// informational only, failing to list them is no error.
+func tagsAt(ctx context.Context, dir, rev string) []string {
+	b := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", "tag", "--points-at", rev)
+	cmd.Stdout = b
+	cmd.Dir = dir
+	if err := cmd.Run(); err != nil {
+		return nil
+	}
+	return strings.Fields(b.String())
+}
+
+func (ExecGit) Checkout(ctx context.Context, remote, version, dest string, opts GitCheckoutOptions) (GitCheckout, error) {
+	subdir := opts.Subdir
+	gitCmd := func(args ...string) *exec.Cmd {
+		return gitCommand(ctx, dest, opts.Output, args...)
+	}
+
+	cmd := gitCmd("init")
+	err := cmd.Run()
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	cmd = gitCmd("remote", "add", "origin", remote)
+	err = cmd.Run()
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	// Attempt shallow fetch at specific revision
+	cmd = gitCmd("fetch", "--tags", "--depth", "1", "origin", version)
+	err = cmd.Run()
+	if err != nil {
+		// Fall back to normal fetch (all revisions)
+		cmd = gitCmd("fetch", "origin")
+		err = cmd.Run()
+		if err != nil {
+			return GitCheckout{}, err
+		}
+	}
+
+	// Sparse checkout optimization: if a Subdir is specified,
+	// there is no need to do a full checkout
+	if subdir != "" {
+		cmd = gitCmd("config", "core.sparsecheckout", "true")
+		err = cmd.Run()
+		if err != nil {
+			return GitCheckout{}, err
+		}
+
+		glob := []byte(subdir + "/*\n")
+		err = ioutil.WriteFile(filepath.Join(dest, ".git", "info", "sparse-checkout"), glob, 0644)
+		if err != nil {
+			return GitCheckout{}, err
+		}
+	}
+
+	cmd = gitCmd("-c", "advice.detachedHead=false", "checkout", version)
+	err = cmd.Run()
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	b := bytes.NewBuffer(nil)
+	cmd = exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Stdout = b
+	cmd.Dir = dest
+	err = cmd.Run()
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	if err := checkoutExtras(ctx, remote, dest, opts); err != nil {
+		return GitCheckout{}, err
+	}
+
+	// all tags were fetched above, no need to ask the remote again
+	checkout := GitCheckout{
+		Commit: strings.TrimSpace(b.String()),
+		Tags:   tagsAt(ctx, dest, "HEAD"),
+	}
+	return checkout, removeGitDirs(dest)
+}
+
+// checkoutExtras materializes submodules and LFS files in the work tree at
+// dir, as requested by opts
+func checkoutExtras(ctx context.Context, remote, dir string, opts GitCheckoutOptions) error {
+	subdir := strings.Trim(filepath.ToSlash(opts.Subdir), "/")
+
+	if opts.Submodules {
+		args := []string{"submodule", "update", "--init", "--recursive"}
+
+		// git refuses local submodules by default, as they might leak files
+		// of the machine. They are fine if the repository is local as well.
+		if strings.HasPrefix(remote, deps.GitSchemeFile) {
+			args = append([]string{"-c", "protocol.file.allow=always"}, args...)
+		}
+		if subdir != "" {
+			args = append(args, "--", subdir)
+		}
+
+		if err := gitCommand(ctx, dir, opts.Output, args...).Run(); err != nil {
+			return errors.Wrap(err, "updating submodules")
+		}
+	}
+
+	if opts.LFS {
+		args := []string{"lfs", "pull"}
+		if subdir != "" {
+			args = append(args, "--include", subdir)
+		}
+
+		if err := gitCommand(ctx, dir, opts.Output, args...).Run(); err != nil {
+			return errors.Wrap(err, "pulling Git LFS files (is git-lfs installed?)")
+		}
+	}
+
+	return nil
+}
+
+// removeGitDirs removes all .git directories and files below dir, including
+// the ones of submodules
+func removeGitDirs(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() != ".git" {
+			return nil
+		}
+
+		if err := os.RemoveAll(path); err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
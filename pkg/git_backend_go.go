@@ -0,0 +1,352 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport/client"
+	"github.com/go-git/go-git/v5/plumbing/transport/server"
+	"github.com/go-git/go-git/v5/storage/memory"
+	"github.com/pkg/errors"
+)
+
+// GoGit is a GitBackend implemented in pure Go, which does not require the
+// `git` binary. Objects of shallow fetches are kept in memory, full fetches go
+// to a temporary directory. Only the checked out files remain on disk.
+type GoGit struct{}
+
+var installFileTransport sync.Once
+
+func newGoGitRemote(remote string) *git.Remote {
+	// by default, go-git invokes git-upload-pack for file:// remotes
+	installFileTransport.Do(func() {
+		client.InstallProtocol("file", server.DefaultServer)
+	})
+
+	return git.NewRemote(memory.NewStorage(), &config.RemoteConfig{
+		Name: git.DefaultRemoteName,
+		URLs: []string{remote},
+	})
+}
+
+// listRefs returns all branches and tags of the remote
+func (GoGit) listRefs(ctx context.Context, remote string) ([]*plumbing.Reference, error) {
+	all, err := newGoGitRemote(remote).ListContext(ctx, &git.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	refs := make([]*plumbing.Reference, 0, len(all))
+	for _, r := range all {
+		if r.Name().IsBranch() || r.Name().IsTag() {
+			refs = append(refs, r)
+		}
+	}
+
+	// branches take precedence over tags of the same name, like git does
+	sort.SliceStable(refs, func(i, j int) bool {
+		return refs[i].Name().IsBranch() && !refs[j].Name().IsBranch()
+	})
+	return refs, nil
+}
+
+func (g GoGit) ListRefs(ctx context.Context, remote string) ([]string, error) {
+	refs, err := g.listRefs(ctx, remote)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(refs))
+	for _, r := range refs {
+		names = append(names, r.Name().Short())
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (g GoGit) ResolveRef(ctx context.Context, remote, ref string) (string, error) {
+	commit, _, err := g.resolveRef(ctx, remote, ref)
+	return commit, err
+}
+
+// resolveRef is like ResolveRef, but also returns the full name of the
+// matching ref, e.g. refs/tags/v1
+func (g GoGit) resolveRef(ctx context.Context, remote, ref string) (string, string, error) {
+	refs, err := g.listRefs(ctx, remote)
+	if err != nil {
+		return "", "", err
+	}
+
+	for _, r := range refs {
+		if r.Name().Short() == ref || r.Name().String() == ref {
+			return r.Hash().String(), r.Name().String(), nil
+		}
+	}
+	return "", "", nil
+}
+
+func (g GoGit) Checkout(ctx context.Context, remote, version, dest string, opts GitCheckoutOptions) (GitCheckout, error) {
+	if opts.LFS {
+		return GitCheckout{}, errors.New("Git LFS is not supported by the go git backend, use the exec one instead")
+	}
+
+	repo, err := git.Init(memory.NewStorage(), nil)
+	if err != nil {
+		return GitCheckout{}, err
+	}
+	if err := addOrigin(repo, remote); err != nil {
+		return GitCheckout{}, err
+	}
+
+	progress := opts.Output
+
+	const want = "refs/jb/want"
+
+	// Attempt shallow fetch at specific revision. Commits are fetched using
+	// a ref pointing at them if possible, not all servers allow asking for
+	// them directly.
+	refs, err := g.listRefs(ctx, remote)
+	if err != nil {
+		return GitCheckout{}, err
+	}
+	src := version
+	for _, r := range refs {
+		if r.Name().Short() == version || r.Name().String() == version {
+			src = r.Name().String()
+			break
+		}
+	}
+	if src == version && commitShaRegex.MatchString(version) {
+		for _, r := range refs {
+			if r.Hash().String() == version {
+				src = r.Name().String()
+				break
+			}
+		}
+	}
+
+	err = repo.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("+%s:%s", src, want))},
+		Depth:    1,
+		Tags:     git.NoTags,
+		Progress: progress,
+	})
+
+	var hash plumbing.Hash
+	if err == nil {
+		ref, err := repo.Reference(want, true)
+		if err != nil {
+			return GitCheckout{}, err
+		}
+		hash = ref.Hash()
+	} else {
+		// Fall back to normal fetch (all revisions), which is kept on disk
+		// rather than in memory
+		dir, err := ioutil.TempDir("", "jb-gogit")
+		if err != nil {
+			return GitCheckout{}, err
+		}
+		defer os.RemoveAll(dir)
+
+		if repo, err = git.PlainInit(dir, true); err != nil {
+			return GitCheckout{}, err
+		}
+		if err := addOrigin(repo, remote); err != nil {
+			return GitCheckout{}, err
+		}
+
+		err = repo.FetchContext(ctx, &git.FetchOptions{
+			RefSpecs: []config.RefSpec{
+				"+refs/heads/*:refs/remotes/origin/*",
+				"+refs/tags/*:refs/tags/*",
+			},
+			Tags:     git.AllTags,
+			Progress: progress,
+		})
+		if err != nil && err != git.NoErrAlreadyUpToDate {
+			return GitCheckout{}, err
+		}
+
+		h, err := repo.ResolveRevision(plumbing.Revision(version))
+		if err != nil {
+			return GitCheckout{}, errors.Wrapf(err, "resolving `%s`", version)
+		}
+		hash = *h
+	}
+
+	commit, err := peelCommit(repo, hash)
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	tree, err := commit.Tree()
+	if err != nil {
+		return GitCheckout{}, err
+	}
+
+	subdir := strings.Trim(filepath.ToSlash(opts.Subdir), "/")
+	if subdir != "" {
+		if tree, err = tree.Tree(subdir); err != nil {
+			return GitCheckout{}, errors.Wrapf(err, "subdirectory `%s` not found at %s", subdir, commit.Hash)
+		}
+	}
+
+	err = tree.Files().ForEach(func(f *object.File) error {
+		return writeGitFile(f, filepath.Join(dest, filepath.FromSlash(path.Join(subdir, f.Name))))
+	})
+	if err != nil {
+		return GitCheckout{}, errors.Wrap(err, "writing files")
+	}
+
+	if opts.Submodules {
+		if err := g.checkoutSubmodules(ctx, remote, commit, subdir, dest); err != nil {
+			return GitCheckout{}, err
+		}
+	}
+
+	// the refs listed above are all tags known without asking the remote
+	// again. Annotated tags point at their tag object instead of the commit.
+	checkout := GitCheckout{Commit: commit.Hash.String()}
+	for _, r := range refs {
+		if r.Name().IsTag() && (r.Hash() == commit.Hash || r.Hash() == hash) {
+			checkout.Tags = append(checkout.Tags, r.Name().Short())
+		}
+	}
+	return checkout, nil
+}
+
+// addOrigin configures remote as the origin of repo
+func addOrigin(repo *git.Repository, remote string) error {
+	_, err := repo.CreateRemote(&config.RemoteConfig{Name: git.DefaultRemoteName, URLs: []string{remote}})
+	return err
+}
+
+// checkoutSubmodules writes the submodules of commit below subdir into dest,
+// like `git submodule update --init --recursive` does
+func (g GoGit) checkoutSubmodules(ctx context.Context, remote string, commit *object.Commit, subdir, dest string) error {
+	root, err := commit.Tree()
+	if err != nil {
+		return err
+	}
+
+	f, err := root.File(".gitmodules")
+	if err == object.ErrFileNotFound {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	contents, err := f.Contents()
+	if err != nil {
+		return err
+	}
+
+	modules := config.NewModules()
+	if err := modules.Unmarshal([]byte(contents)); err != nil {
+		return errors.Wrap(err, "parsing .gitmodules")
+	}
+
+	for _, m := range modules.Submodules {
+		if subdir != "" && m.Path != subdir && !strings.HasPrefix(m.Path, subdir+"/") {
+			continue
+		}
+
+		// .gitmodules might list submodules that were removed since
+		entry, err := root.FindEntry(m.Path)
+		if err != nil || entry.Mode != filemode.Submodule {
+			continue
+		}
+
+		target := filepath.Join(dest, filepath.FromSlash(m.Path))
+		if err := os.MkdirAll(target, os.ModePerm); err != nil {
+			return err
+		}
+
+		_, err = g.Checkout(ctx, submoduleURL(remote, m.URL), entry.Hash.String(), target, GitCheckoutOptions{Submodules: true})
+		if err != nil {
+			return errors.Wrapf(err, "checking out submodule `%s`", m.Path)
+		}
+	}
+
+	return nil
+}
+
+// submoduleURL resolves the url of a submodule, which may be relative to the
+// remote of the superproject
+func submoduleURL(remote, sub string) string {
+	if !strings.HasPrefix(sub, "./") && !strings.HasPrefix(sub, "../") {
+		return sub
+	}
+
+	u, err := url.Parse(remote)
+	if err != nil {
+		return sub
+	}
+	u.Path = path.Join(u.Path, sub)
+	return u.String()
+}
+
+// peelCommit returns the commit hash points to, resolving annotated tags
+func peelCommit(repo *git.Repository, hash plumbing.Hash) (*object.Commit, error) {
+	obj, err := repo.Object(plumbing.AnyObject, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	switch o := obj.(type) {
+	case *object.Commit:
+		return o, nil
+	case *object.Tag:
+		return o.Commit()
+	default:
+		return nil, fmt.Errorf("%s is not a commit", hash)
+	}
+}
+
+func writeGitFile(f *object.File, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+
+	contents, err := f.Contents()
+	if err != nil {
+		return err
+	}
+
+	if f.Mode == filemode.Symlink {
+		return os.Symlink(contents, target)
+	}
+
+	mode, err := f.Mode.ToOSFileMode()
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, []byte(contents), mode)
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// CachedGit is a GitBackend invoking the `git` binary, which keeps a bare
+// mirror of every remote in Dir. Subsequent checkouts only fetch objects that
+// are not yet present in the mirror, commits already in it are not fetched at
+// all.
+type CachedGit struct {
+	ExecGit
+
+	// Dir holds one bare repository per remote
+	Dir string
+
+	// git does not like concurrent fetches into the same repository
+	mu sync.Mutex
+}
+
+func NewCachedGit(dir string) *CachedGit {
+	return &CachedGit{Dir: dir}
+}
+
+// mirror returns the location of the bare repository of remote
+func (c *CachedGit) mirror(remote string) string {
+	sum := sha256.Sum256([]byte(remote))
+	return filepath.Join(c.Dir, hex.EncodeToString(sum[:]))
+}
+
+// init creates the bare mirror of remote, unless it already exists
+func (c *CachedGit) init(ctx context.Context, remote, mirror string, out io.Writer) error {
+	if _, err := os.Stat(mirror); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	if err := os.MkdirAll(c.Dir, os.ModePerm); err != nil {
+		return err
+	}
+
+	// set up in a temporary location, so that an interrupted init does not
+	// leave a broken mirror behind
+	tmp, err := ioutil.TempDir(c.Dir, ".init")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	if err := gitCommand(ctx, tmp, out, "init", "--quiet", "--bare").Run(); err != nil {
+		return errors.Wrap(err, "initializing mirror")
+	}
+	if err := gitCommand(ctx, tmp, out, "remote", "add", "origin", remote).Run(); err != nil {
+		return errors.Wrap(err, "initializing mirror")
+	}
+
+	return os.Rename(tmp, mirror)
+}
+
+// resolve returns the commit version points to in the mirror, or an empty
+// string if the mirror does not know about it
+func (c *CachedGit) resolve(ctx context.Context, mirror, version string) string {
+	b := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "--verify", "--quiet", version+"^{commit}")
+	cmd.Stdout = b
+	cmd.Dir = mirror
+	if err := cmd.Run(); err != nil {
+		return ""
+	}
+	return strings.TrimSpace(b.String())
+}
+
+func (c *CachedGit) Checkout(ctx context.Context, remote, version, dest string, opts GitCheckoutOptions) (GitCheckout, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	mirror := c.mirror(remote)
+	if err := c.init(ctx, remote, mirror, opts.Output); err != nil {
+		return GitCheckout{}, err
+	}
+
+	// commits never change, but refs might have moved upstream
+	var commit string
+	if commitShaRegex.MatchString(version) {
+		commit = c.resolve(ctx, mirror, version)
+	}
+
+	if commit == "" {
+		err := gitCommand(ctx, mirror, opts.Output, "fetch", "--prune", "--tags", "origin", "+refs/heads/*:refs/heads/*").Run()
+		if err != nil {
+			return GitCheckout{}, errors.Wrap(err, "updating mirror")
+		}
+		commit = c.resolve(ctx, mirror, version)
+	}
+
+	// commits not reachable from any branch or tag need to be fetched
+	// explicitly, if the remote allows it
+	if commit == "" && commitShaRegex.MatchString(version) {
+		if err := gitCommand(ctx, mirror, opts.Output, "fetch", "origin", version).Run(); err == nil {
+			commit = c.resolve(ctx, mirror, version)
+		}
+	}
+
+	if commit == "" {
+		return GitCheckout{}, fmt.Errorf("unknown revision `%s` of %s", version, remote)
+	}
+
+	// the mirror has all tags as of the last fetch
+	checkout := GitCheckout{Commit: commit, Tags: tagsAt(ctx, mirror, commit)}
+
+	// archives contain neither submodules nor LFS files
+	if opts.Submodules || opts.LFS {
+		return checkout, c.exportWorktree(ctx, remote, mirror, commit, dest, opts)
+	}
+	return checkout, c.export(ctx, mirror, commit, opts.Subdir, dest)
+}
+
+// exportWorktree checks out commit into dest using a temporary worktree of
+// the mirror
+func (c *CachedGit) exportWorktree(ctx context.Context, remote, mirror, commit, dest string, opts GitCheckoutOptions) error {
+	defer gitCommand(ctx, mirror, opts.Output, "worktree", "prune").Run()
+
+	if err := gitCommand(ctx, mirror, opts.Output, "worktree", "add", "--detach", dest, commit).Run(); err != nil {
+		return errors.Wrap(err, "creating worktree")
+	}
+
+	if err := checkoutExtras(ctx, remote, dest, opts); err != nil {
+		return err
+	}
+	return removeGitDirs(dest)
+}
+
+// export writes the files of commit below subdir into dest
+func (c *CachedGit) export(ctx context.Context, mirror, commit, subdir, dest string) error {
+	args := []string{"archive", "--format=tar.gz", "--prefix=package/", commit}
+	if subdir = strings.Trim(filepath.ToSlash(subdir), "/"); subdir != "" {
+		args = append(args, "--", subdir)
+	}
+
+	stderr := &bytes.Buffer{}
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = mirror
+	cmd.Stderr = stderr
+
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	if err := GzipUntar(dest, out, ""); err != nil {
+		cmd.Wait()
+		return errors.Wrap(err, "extracting archive")
+	}
+
+	if err := cmd.Wait(); err != nil {
+		return errors.Wrapf(err, "archiving %s: %s", commit, strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
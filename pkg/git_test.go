@@ -0,0 +1,321 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// testGit runs git in dir and returns its output
+func testGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_AUTHOR_NAME=jb", "GIT_AUTHOR_EMAIL=jb@example.com",
+		"GIT_COMMITTER_NAME=jb", "GIT_COMMITTER_EMAIL=jb@example.com",
+	)
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+	return strings.TrimSpace(string(out))
+}
+
+// testGitRepo creates a bare repository containing lib/main.libsonnet, tagged
+// as v1, and returns its path and the commit of the tag
+func testGitRepo(t *testing.T, dir string) (string, string) {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	work := filepath.Join(dir, "work")
+	bare := filepath.Join(dir, "repo.git")
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "lib"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(work, "lib", "main.libsonnet"), []byte("{}"), 0644))
+
+	git := func(dir string, args ...string) string {
+		return testGit(t, dir, args...)
+	}
+
+	git(work, "init", "-q")
+	git(work, "add", ".")
+	git(work, "commit", "-q", "-m", "initial")
+	git(work, "tag", "v1")
+	commit := git(work, "rev-parse", "HEAD")
+	git(dir, "clone", "-q", "--bare", work, bare)
+
+	return bare, commit
+}
+
+func TestGitInstallFile(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+
+	backends := map[string]GitBackend{"cached": NewCachedGit(filepath.Join(tmp, "cache"))}
+	for name, backend := range GitBackends {
+		backends[name] = backend
+	}
+
+	// both refs and commits can be installed, using any backend
+	for backendName, backend := range backends {
+		for _, version := range []string{"v1", commit} {
+			t.Run(backendName+"@"+version, func(t *testing.T) {
+				d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@"+version)
+				require.NoError(t, err)
+				require.Equal(t, deps.GitSchemeFile, d.Source.GitSource.Scheme)
+
+				vendorDir := filepath.Join(tmp, "vendor-"+backendName+"-"+version)
+				require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+				p := &GitPackage{Source: d.Source.GitSource, Backend: backend}
+				locked, err := p.Install(context.TODO(), d.Name(), vendorDir, d.Version)
+				require.NoError(t, err)
+				assert.Equal(t, commit, locked)
+				assert.Equal(t, "v1", p.Resolved().Tag)
+
+				_, err = os.Stat(filepath.Join(vendorDir, d.Name(), "main.libsonnet"))
+				assert.NoError(t, err)
+			})
+		}
+	}
+}
+
+func TestGitBackendResolveRef(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+	remote := "file://" + filepath.ToSlash(bare)
+
+	for name, backend := range GitBackends {
+		t.Run(name, func(t *testing.T) {
+			refs, err := backend.ListRefs(context.TODO(), remote)
+			require.NoError(t, err)
+			assert.Contains(t, refs, "v1")
+
+			got, err := backend.ResolveRef(context.TODO(), remote, "v1")
+			require.NoError(t, err)
+			assert.Equal(t, commit, got)
+
+			got, err = backend.ResolveRef(context.TODO(), remote, "does-not-exist")
+			require.NoError(t, err)
+			assert.Empty(t, got)
+		})
+	}
+}
+
+func TestCachedGitCheckout(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+	remote := "file://" + filepath.ToSlash(bare)
+
+	c := NewCachedGit(filepath.Join(tmp, "cache"))
+	checkout := func(version string) (GitCheckout, string) {
+		dest, err := ioutil.TempDir(tmp, "dest")
+		require.NoError(t, err)
+
+		got, err := c.Checkout(context.TODO(), remote, version, dest, GitCheckoutOptions{Subdir: "/lib"})
+		require.NoError(t, err)
+		return got, dest
+	}
+
+	got, dest := checkout("v1")
+	assert.Equal(t, commit, got.Commit)
+	assert.Equal(t, []string{"v1"}, got.Tags)
+	_, err = os.Stat(filepath.Join(dest, "lib", "main.libsonnet"))
+	assert.NoError(t, err)
+
+	mirrors, err := ioutil.ReadDir(c.Dir)
+	require.NoError(t, err)
+	assert.Len(t, mirrors, 1)
+
+	// commits already present are served from the mirror, even if the remote
+	// is gone
+	require.NoError(t, os.Rename(bare, bare+".moved"))
+	got, _ = checkout(commit)
+	assert.Equal(t, commit, got.Commit)
+	assert.Equal(t, []string{"v1"}, got.Tags)
+
+	_, err = c.Checkout(context.TODO(), remote, "v1", tmp, GitCheckoutOptions{Subdir: "/lib"})
+	assert.Error(t, err)
+}
+
+func TestGoGitCheckoutCommit(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+	remote := "file://" + filepath.ToSlash(bare)
+
+	checkout := func() GitCheckout {
+		dest, err := ioutil.TempDir(tmp, "dest")
+		require.NoError(t, err)
+
+		got, err := GoGit{}.Checkout(context.TODO(), remote, commit, dest, GitCheckoutOptions{})
+		require.NoError(t, err)
+		_, err = os.Stat(filepath.Join(dest, "lib", "main.libsonnet"))
+		assert.NoError(t, err)
+		return got
+	}
+
+	// fetched shallowly using the tag pointing at it
+	got := checkout()
+	assert.Equal(t, GitCheckout{Commit: commit, Tags: []string{"v1"}}, got)
+
+	// commits no ref points at require fetching everything
+	testGit(t, filepath.Join(tmp, "work"), "commit", "-q", "--allow-empty", "-m", "second")
+	testGit(t, bare, "fetch", "-q", filepath.Join(tmp, "work"), "+HEAD:refs/heads/next")
+	testGit(t, bare, "tag", "-d", "v1")
+
+	got = checkout()
+	assert.Equal(t, GitCheckout{Commit: commit}, got)
+}
+
+func TestGitInstallSubmodules(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// lib/sub of the superproject is a submodule, pointing at the repository
+	// created by testGitRepo
+	_, subCommit := testGitRepo(t, tmp)
+
+	work := filepath.Join(tmp, "super")
+	require.NoError(t, os.MkdirAll(filepath.Join(work, "lib"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(work, "lib", "super.libsonnet"), []byte("{}"), 0644))
+	testGit(t, work, "init", "-q")
+	testGit(t, work, "-c", "protocol.file.allow=always", "submodule", "--quiet", "add", "../repo.git", "lib/sub")
+	testGit(t, work, "add", ".")
+	testGit(t, work, "commit", "-q", "-m", "initial")
+	testGit(t, work, "tag", "v1")
+	testGit(t, tmp, "clone", "-q", "--bare", work, "super.git")
+
+	backends := map[string]GitBackend{"cached": NewCachedGit(filepath.Join(tmp, "cache"))}
+	for name, backend := range GitBackends {
+		backends[name] = backend
+	}
+
+	for name, backend := range backends {
+		t.Run(name, func(t *testing.T) {
+			d, err := deps.Parse("", "file://"+filepath.ToSlash(filepath.Join(tmp, "super.git"))+"/lib@v1")
+			require.NoError(t, err)
+			d.Source.GitSource.Submodules = true
+
+			vendorDir := filepath.Join(tmp, "vendor-"+name)
+			require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+			p := &GitPackage{Source: d.Source.GitSource, Backend: backend}
+			_, err = p.Install(context.TODO(), d.Name(), vendorDir, d.Version)
+			require.NoError(t, err)
+
+			pkgDir := filepath.Join(vendorDir, d.Name())
+			_, err = os.Stat(filepath.Join(pkgDir, "super.libsonnet"))
+			assert.NoError(t, err)
+			_, err = os.Stat(filepath.Join(pkgDir, "sub", "lib", "main.libsonnet"))
+			assert.NoError(t, err, "submodule of %s not checked out", subCommit)
+			_, err = os.Stat(filepath.Join(pkgDir, "sub", ".git"))
+			assert.True(t, os.IsNotExist(err), "git metadata must not be vendored")
+		})
+	}
+}
+
+// roundTripFunc answers HTTP requests without a server
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestGitInstallGitHub(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-git")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+	source := &deps.Git{Scheme: deps.GitSchemeHTTPS, Host: "github.com", User: "jsonnet-bundler", Repo: "lib", Subdir: "/lib"}
+
+	// git reaches the GitHub remote in the local repository instead
+	for k, v := range map[string]string{
+		"GIT_CONFIG_COUNT":   "1",
+		"GIT_CONFIG_KEY_0":   "url.file://" + filepath.ToSlash(bare) + ".insteadOf",
+		"GIT_CONFIG_VALUE_0": source.Remote(),
+	} {
+		defer os.Setenv(k, os.Getenv(k))
+		require.NoError(t, os.Setenv(k, v))
+	}
+
+	archive := filepath.Join(tmp, "archive.tar.gz")
+	testGit(t, bare, "archive", "--format=tar.gz", "--prefix=lib-"+commit+"/", "-o", archive, commit)
+	data, err := ioutil.ReadFile(archive)
+	require.NoError(t, err)
+	digest, err := hashFile(archive)
+	require.NoError(t, err)
+
+	var requested []string
+	client := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		requested = append(requested, req.URL.String())
+		return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(data)), Request: req}, nil
+	})}
+
+	install := func(backend GitBackend, vendorDir string) *GitPackage {
+		require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+		p := &GitPackage{Source: source, Backend: backend, Env: Env{Client: client}}
+		locked, err := p.Install(context.TODO(), "lib", vendorDir, "v1")
+		require.NoError(t, err)
+		assert.Equal(t, commit, locked)
+
+		_, err = os.Stat(filepath.Join(vendorDir, "lib", "main.libsonnet"))
+		assert.NoError(t, err)
+		return p
+	}
+
+	// without a mirror, the archive is downloaded and its digest recorded
+	p := install(GitBackends["exec"], filepath.Join(tmp, "vendor-exec"))
+	assert.Equal(t, []string{"https://github.com/jsonnet-bundler/lib/archive/" + commit + ".tar.gz"}, requested)
+	assert.Equal(t, digest, p.Resolved().ArchiveDigest)
+
+	// with one, it is fetched into instead, again and again
+	requested = nil
+	cache := NewCachedGit(filepath.Join(tmp, "cache"))
+	for _, dir := range []string{"vendor-cached", "vendor-cached-again"} {
+		p := install(cache, filepath.Join(tmp, dir))
+		assert.Empty(t, p.Resolved().ArchiveDigest)
+	}
+	assert.Empty(t, requested)
+}
@@ -17,13 +17,16 @@ package pkg
 import (
 	"context"
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
-	"net/url"
 	"os"
 	"path"
 )
 
 type GitlabRegistryPackage struct {
 	Source *deps.GitlabRegistry
+
+	Env
+
+	resolved Resolved
 }
 
 func NewGitlabRegistryPackage(source *deps.GitlabRegistry) Interface {
@@ -32,35 +35,10 @@ func NewGitlabRegistryPackage(source *deps.GitlabRegistry) Interface {
 	}
 }
 
-func buildUrl(src *deps.GitlabRegistry, version string) url.URL {
-	host := "gitlab.com"
-	if src.Host != "" {
-		host = src.Host
-	}
-	filename := "package.tar.gz"
-	if src.Filename != "" {
-		filename = src.Filename
-	}
-
-	packageUrl := url.URL{
-		Scheme: "https",
-		Host:   host,
-	}
-	// this way is needed so that net/url does not double encode '/' to '%252F'
-	return *packageUrl.JoinPath(
-		"api/v4/projects",
-		url.PathEscape(src.Project),
-		"packages/generic",
-		src.Package,
-		version,
-		filename,
-	)
-}
-
 func (h *GitlabRegistryPackage) Install(ctx context.Context, name, dir, version string) (string, error) {
 	destPath := path.Join(dir, name)
 
-	packageUrl := buildUrl(h.Source, version)
+	packageUrl := h.Source.PackageURL(version)
 
 	tmpDir, err := CreateTempDir(name, dir, version)
 	if err != nil {
@@ -68,10 +46,14 @@ func (h *GitlabRegistryPackage) Install(ctx context.Context, name, dir, version
 	}
 	defer os.RemoveAll(tmpDir)
 
-	err = DownloadAndUntarTo(tmpDir, packageUrl.String(), destPath)
+	h.resolved.ArchiveDigest, err = h.downloadAndUntarTo(ctx, tmpDir, packageUrl.String(), destPath)
 	if err != nil {
 		return "", err
 	}
 
 	return version, nil
 }
+
+func (h *GitlabRegistryPackage) Resolved() Resolved {
+	return h.resolved
+}
@@ -23,6 +23,10 @@ import (
 
 type HttpPackage struct {
 	Source *deps.Http
+
+	Env
+
+	resolved Resolved
 }
 
 func NewHttpPackage(source *deps.Http) Interface {
@@ -34,11 +38,12 @@ func NewHttpPackage(source *deps.Http) Interface {
 func (h *HttpPackage) Install(ctx context.Context, name, dir, version string) (string, error) {
 	destPath := path.Join(dir, name)
 
-	err := os.Setenv("VERSION", version)
-	if err != nil {
-		return "", err
-	}
-	packageUrl := os.ExpandEnv(h.Source.Url)
+	packageUrl := os.Expand(h.Source.Url, func(key string) string {
+		if key == "VERSION" {
+			return version
+		}
+		return os.Getenv(key)
+	})
 
 	tmpDir, err := CreateTempDir(name, dir, version)
 	if err != nil {
@@ -46,10 +51,14 @@ func (h *HttpPackage) Install(ctx context.Context, name, dir, version string) (s
 	}
 	defer os.RemoveAll(tmpDir)
 
-	err = DownloadAndUntarTo(tmpDir, packageUrl, destPath)
+	h.resolved.ArchiveDigest, err = h.downloadAndUntarTo(ctx, tmpDir, packageUrl, destPath)
 	if err != nil {
 		return "", err
 	}
 
 	return version, nil
 }
+
+func (h *HttpPackage) Resolved() Resolved {
+	return h.resolved
+}
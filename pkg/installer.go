@@ -0,0 +1,251 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// InstallerOptions configure an Installer. Apart from the directories, the
+// zero value of every option is a usable default.
+type InstallerOptions struct {
+	// RootDir is the directory of the top-level jsonnetfile, which relative
+	// local dependencies are resolved against. Defaults to the working
+	// directory.
+	RootDir string
+	// VendorDir is where packages are installed to, relative to RootDir
+	// unless absolute. Defaults to `vendor`.
+	VendorDir string
+
+	// HTTPClient performs the requests for archives and to package proxies.
+	// Defaults to http.DefaultClient.
+	HTTPClient *http.Client
+	// GitBackend performs the git operations. Defaults to DefaultGitBackend.
+	GitBackend GitBackend
+	// Proxy lists the package proxies to retrieve git packages from, in the
+	// format of the Proxy variable. Empty retrieves them from upstream.
+	Proxy string
+	// Mirrors replace the prefix of git remotes given by the key with the
+	// value, e.g. `https://github.com/` with `https://git.example.com/gh/`.
+	// The longest matching prefix is used. Lockfiles keep the original
+	// remotes.
+	Mirrors map[string]string
+
+	// Logger receives the output of git. It is discarded if nil.
+	Logger io.Writer
+	// Observer is notified of the progress of installations. If Concurrency
+	// is larger than 1, it must be safe for concurrent use.
+	Observer Observer
+
+	// Concurrency is the maximum number of packages retrieved at once.
+	// Defaults to 1.
+	Concurrency int
+
+	// Prune removes the files of packages not reachable from the entrypoints
+	// of the jsonnetfile from vendor, apart from licenses. Packages pruned
+	// before are installed completely again if unset.
+	Prune bool
+}
+
+// Installer vendors packages as configured by its options. Unlike the package
+// level functions, it depends on no global state, so that several of them can
+// safely be used at the same time.
+type Installer struct {
+	rootDir   string
+	vendorDir string
+	// projectVendorDir is the vendor directory of the project, which differs
+	// from vendorDir while planning
+	projectVendorDir string
+
+	backend     GitBackend
+	proxy       string
+	mirrors     map[string]string
+	concurrency int
+	prune       bool
+
+	// warned holds the jsonnetfiles whose unknown fields were reported
+	// already. It is shared with the copies used for planning.
+	warned map[string]bool
+
+	env Env
+}
+
+// NewInstaller returns an Installer using opts, filling in the defaults
+func NewInstaller(opts InstallerOptions) (*Installer, error) {
+	root := opts.RootDir
+	if root == "" {
+		root = "."
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return nil, errors.Wrap(err, "resolving root directory")
+	}
+
+	vendorDir := opts.VendorDir
+	if vendorDir == "" {
+		vendorDir = "vendor"
+	}
+	if !filepath.IsAbs(vendorDir) {
+		vendorDir = filepath.Join(root, vendorDir)
+	}
+
+	backend := opts.GitBackend
+	if backend == nil {
+		backend = DefaultGitBackend
+	}
+
+	concurrency := opts.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	return &Installer{
+		rootDir:          root,
+		vendorDir:        vendorDir,
+		projectVendorDir: vendorDir,
+		backend:          backend,
+		proxy:            opts.Proxy,
+		mirrors:          opts.Mirrors,
+		concurrency:      concurrency,
+		prune:            opts.Prune,
+		warned:           make(map[string]bool),
+		env: Env{
+			Client:   opts.HTTPClient,
+			Logger:   opts.Logger,
+			Observer: opts.Observer,
+		},
+	}, nil
+}
+
+// VendorDir returns the absolute path packages are installed to
+func (in *Installer) VendorDir() string {
+	return in.vendorDir
+}
+
+// Env provides packages with what they need from their surroundings while
+// installing. The zero value is silent and uses http.DefaultClient.
+type Env struct {
+	// Client performs HTTP requests. http.DefaultClient is used if nil.
+	Client *http.Client
+	// Logger receives the output of git. It is discarded if nil.
+	Logger io.Writer
+	// Observer is notified of events. They are dropped if nil.
+	Observer Observer
+}
+
+func (e Env) client() *http.Client {
+	if e.Client != nil {
+		return e.Client
+	}
+	return http.DefaultClient
+}
+
+func (e Env) emit(ev Event) {
+	if e.Observer != nil {
+		e.Observer.Observe(ev)
+	}
+}
+
+// downloadFile retrieves url into the file at path
+func (e Env) downloadFile(ctx context.Context, path, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	e.emit(Event{Type: EventFetch, URL: url, Status: resp.StatusCode})
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	_, err = io.Copy(out, resp.Body)
+	return err
+}
+
+// retrieval is a package to be downloaded by ensure
+type retrieval struct {
+	dep         deps.Dependency
+	requested   string
+	expectedSum string
+}
+
+// downloadAll downloads the packages using up to in.concurrency goroutines.
+// Packages nested in the vendor path of another one are retrieved one after
+// another, as installing the outer one replaces the inner one.
+func (in *Installer) downloadAll(todo []retrieval, pathToParentModule string) ([]*deps.Dependency, error) {
+	names := make([]string, 0, len(todo))
+	for _, r := range todo {
+		names = append(names, filepath.ToSlash(r.dep.Name()))
+	}
+	sort.Strings(names)
+
+	concurrency := in.concurrency
+	for i := 1; i < len(names); i++ {
+		if strings.HasPrefix(names[i], names[i-1]+"/") {
+			concurrency = 1
+		}
+	}
+
+	results := make([]*deps.Dependency, len(todo))
+	errs := make([]error, len(todo))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := range todo {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			d := todo[i].dep
+			os.RemoveAll(filepath.Join(in.vendorDir, d.Name()))
+			results[i], errs[i] = in.download(d, pathToParentModule)
+		}(i)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,161 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// recorder is an Observer remembering all events
+type recorder struct {
+	mu     sync.Mutex
+	events []Event
+}
+
+func (r *recorder) Observe(e Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, e)
+}
+
+func (r *recorder) ofType(t string) []Event {
+	var events []Event
+	for _, e := range r.events {
+		if e.Type == t {
+			events = append(events, e)
+		}
+	}
+	return events
+}
+
+func TestInstallerParallel(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-installer")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// two projects with a local dependency of the same name, installed at
+	// the same time without changing the working directory
+	var wg sync.WaitGroup
+	recorders := make([]*recorder, 2)
+	for i, project := range []string{"one", "two"} {
+		root := filepath.Join(tmp, project)
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "lib"), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(filepath.Join(root, "lib", "main.libsonnet"), []byte(project), 0644))
+
+		jf := v1.New()
+		jf.Dependencies["lib"] = deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: "lib"}}}
+
+		recorders[i] = &recorder{}
+		in, err := NewInstaller(InstallerOptions{RootDir: root, Observer: recorders[i], Concurrency: 4})
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := in.Ensure(jf, map[string]deps.Dependency{})
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for i, project := range []string{"one", "two"} {
+		b, err := ioutil.ReadFile(filepath.Join(tmp, project, "vendor", "lib", "main.libsonnet"))
+		require.NoError(t, err)
+		assert.Equal(t, project, string(b))
+
+		links := recorders[i].ofType(EventLink)
+		require.Len(t, links, 1)
+		assert.Equal(t, filepath.Join(tmp, project, "lib"), links[0].Target)
+	}
+}
+
+func TestInstallerConcurrency(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-installer")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+
+	jf := v1.New()
+	for _, alias := range []string{"a", "b", "c"} {
+		d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v1")
+		require.NoError(t, err)
+		d.Alias = alias
+		jf.Dependencies[d.Name()] = *d
+	}
+
+	rec := &recorder{}
+	in, err := NewInstaller(InstallerOptions{RootDir: tmp, Observer: rec, Concurrency: 3})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+	locks, err := in.Ensure(jf, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	require.Len(t, locks, 3)
+	for _, name := range []string{"a", "b", "c"} {
+		assert.Equal(t, commit, locks[name].Version)
+		_, err := os.Stat(filepath.Join(tmp, "vendor", name, "main.libsonnet"))
+		assert.NoError(t, err)
+	}
+
+	results := rec.ofType(EventResult)
+	assert.Len(t, results, 3)
+	for _, r := range results {
+		assert.True(t, r.Installed)
+	}
+}
+
+func TestInstallerUnknownFields(t *testing.T) {
+	root, err := ioutil.TempDir("", "jb-installer")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// a and b both require c, whose jsonnetfile has a typo
+	for _, name := range []string{"a", "b"} {
+		writeFile(t, filepath.Join(root, name, "jsonnetfile.json"), `{"version": 1, "dependencies": [{"source": {"local": {"directory": "../c"}}}]}`)
+	}
+	writeFile(t, filepath.Join(root, "c", "jsonnetfile.json"), `{"version": 1, "legacyImport": false}`)
+
+	jf := v1.New()
+	for _, name := range []string{"a", "b"} {
+		jf.Dependencies[name] = deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: name}}}
+	}
+
+	rec := &recorder{}
+	in, err := NewInstaller(InstallerOptions{RootDir: root, Observer: rec})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+	locks, err := in.Ensure(jf, map[string]deps.Dependency{})
+	require.NoError(t, err)
+	assert.Contains(t, locks, "c")
+
+	warnings := rec.ofType(EventWarn)
+	require.Len(t, warnings, 1)
+	assert.Equal(t, "c", warnings[0].Package)
+	assert.Contains(t, warnings[0].Message, "unknown field `legacyImport`, did you mean `legacyImports`?")
+}
@@ -21,3 +21,19 @@ import (
 type Interface interface {
 	Install(ctx context.Context, name, dir, version string) (lockVersion string, err error)
 }
+
+// Resolved describes how a package was resolved, beyond the version returned
+// by Install
+type Resolved struct {
+	// Tag points at the installed commit of git packages, if there is any
+	Tag string
+	// ArchiveDigest is the checksum of the archive the package was extracted
+	// from, if it was downloaded as one
+	ArchiveDigest string
+}
+
+// Resolver is implemented by packages that can tell how the version they
+// installed last was resolved
+type Resolver interface {
+	Resolved() Resolved
+}
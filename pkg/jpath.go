@@ -0,0 +1,61 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// JPath returns the library search paths for the packages installed in
+// vendorDir, highest precedence first. Besides vendorDir, these are the
+// parent directories of the packages if legacy is set, which resolve imports
+// of their legacy names without the symlinks of LegacyImports.
+//
+// Packages whose legacy name is not the last element of their vendor path,
+// like those with a custom legacy name, can't be resolved this way. Their
+// names are returned as unreachable.
+func JPath(vendorDir string, locks map[string]deps.Dependency, legacy bool) (paths []string, unreachable []string) {
+	paths = []string{vendorDir}
+	if !legacy {
+		return paths, nil
+	}
+
+	names := make([]string, 0, len(locks))
+	for name := range locks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	seen := map[string]bool{".": true}
+	for _, name := range names {
+		d := locks[name]
+		if d.LegacyName() != path.Base(name) {
+			unreachable = append(unreachable, name)
+			continue
+		}
+
+		parent := path.Dir(name)
+		if seen[parent] {
+			continue
+		}
+		seen[parent] = true
+		paths = append(paths, filepath.Join(vendorDir, filepath.FromSlash(parent)))
+	}
+	return paths, unreachable
+}
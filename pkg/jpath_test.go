@@ -0,0 +1,60 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestJPath(t *testing.T) {
+	locks := make(map[string]deps.Dependency)
+	for _, uri := range []string{
+		"github.com/ksonnet/ksonnet-lib/ksonnet.beta.4",
+		"github.com/ksonnet/ksonnet-lib/ksonnet.beta.3",
+		"github.com/grafana/jsonnet-libs/grafana-builder",
+		"github.com/prometheus/node_exporter/docs/node-mixin",
+	} {
+		d, err := deps.Parse("", uri)
+		require.NoError(t, err)
+		locks[d.Name()] = *d
+	}
+
+	// a custom legacy name, which can't be resolved by search paths
+	custom := locks["github.com/prometheus/node_exporter/docs/node-mixin"]
+	custom.LegacyNameCompat = "node-mixin-legacy"
+	locks[custom.Name()] = custom
+
+	// packages right in vendor are found anyways
+	local := deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: "lib"}}}
+	locks[local.Name()] = local
+
+	paths, unreachable := JPath("vendor", locks, true)
+	assert.Equal(t, []string{
+		"vendor",
+		filepath.FromSlash("vendor/github.com/grafana/jsonnet-libs"),
+		filepath.FromSlash("vendor/github.com/ksonnet/ksonnet-lib"),
+	}, paths)
+	assert.Equal(t, []string{"github.com/prometheus/node_exporter/docs/node-mixin"}, unreachable)
+
+	paths, unreachable = JPath("vendor", locks, false)
+	assert.Equal(t, []string{"vendor"}, paths)
+	assert.Empty(t, unreachable)
+}
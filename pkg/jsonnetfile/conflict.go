@@ -0,0 +1,115 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetfile
+
+import (
+	"bytes"
+	"fmt"
+)
+
+const (
+	markerOurs   = "<<<<<<<"
+	markerBase   = "|||||||"
+	markerSplit  = "======="
+	markerTheirs = ">>>>>>>"
+)
+
+// Conflict holds both sides of a file git left conflict markers in
+type Conflict struct {
+	Ours   []byte
+	Theirs []byte
+
+	// Base is the common ancestor. It is only known if the conflict was
+	// written in the diff3 style, nil otherwise.
+	Base []byte
+}
+
+// ParseConflict splits data containing git conflict markers into the
+// versions of both sides. It returns false if there are no conflict markers.
+func ParseConflict(data []byte) (Conflict, bool, error) {
+	const (
+		common = iota
+		ours
+		base
+		theirs
+	)
+
+	var c Conflict
+	var hasBase, conflicted bool
+	state := common
+
+	for i, line := range bytes.SplitAfter(data, []byte("\n")) {
+		marker := func(m string) bool {
+			return bytes.HasPrefix(line, []byte(m))
+		}
+
+		switch {
+		case marker(markerOurs):
+			if state != common {
+				return c, false, fmt.Errorf("line %d: unexpected conflict marker `%s`", i+1, markerOurs)
+			}
+			state, conflicted = ours, true
+			continue
+		case marker(markerBase) && state == ours:
+			state, hasBase = base, true
+			continue
+		case marker(markerSplit) && len(bytes.TrimSpace(line)) == len(markerSplit) && (state == ours || state == base):
+			state = theirs
+			continue
+		case marker(markerTheirs) && state == theirs:
+			state = common
+			continue
+		}
+
+		switch state {
+		case common:
+			c.Ours = append(c.Ours, line...)
+			c.Theirs = append(c.Theirs, line...)
+			c.Base = append(c.Base, line...)
+		case ours:
+			c.Ours = append(c.Ours, line...)
+		case base:
+			c.Base = append(c.Base, line...)
+		case theirs:
+			c.Theirs = append(c.Theirs, line...)
+		}
+	}
+
+	if state != common {
+		return c, false, fmt.Errorf("unterminated conflict")
+	}
+	if !hasBase {
+		c.Base = nil
+	}
+	return c, conflicted, nil
+}
+
+// MarkConflict joins both sides into a single file with conflict markers
+// around them, as git does for unresolved conflicts
+func MarkConflict(ours, theirs []byte) []byte {
+	b := &bytes.Buffer{}
+	b.WriteString(markerOurs + " ours\n")
+	b.Write(ours)
+	if len(ours) > 0 && ours[len(ours)-1] != '\n' {
+		b.WriteString("\n")
+	}
+	b.WriteString(markerSplit + "\n")
+	b.Write(theirs)
+	if len(theirs) > 0 && theirs[len(theirs)-1] != '\n' {
+		b.WriteString("\n")
+	}
+	b.WriteString(markerTheirs + " theirs\n")
+	return b.Bytes()
+}
@@ -0,0 +1,87 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetfile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestParseConflict(t *testing.T) {
+	tests := []struct {
+		name   string
+		data   string
+		want   jsonnetfile.Conflict
+		merged bool
+	}{
+		{
+			name: "none",
+			data: "a\nb\n",
+			want: jsonnetfile.Conflict{Ours: []byte("a\nb\n"), Theirs: []byte("a\nb\n")},
+		},
+		{
+			name: "merge",
+			data: "a\n<<<<<<< HEAD\nb\n=======\nc\nd\n>>>>>>> feature\ne\n",
+			want: jsonnetfile.Conflict{
+				Ours:   []byte("a\nb\ne\n"),
+				Theirs: []byte("a\nc\nd\ne\n"),
+			},
+			merged: true,
+		},
+		{
+			name: "diff3",
+			data: "a\n<<<<<<< HEAD\nb\n||||||| base\nx\n=======\nc\n>>>>>>> feature\ne\n",
+			want: jsonnetfile.Conflict{
+				Ours:   []byte("a\nb\ne\n"),
+				Theirs: []byte("a\nc\ne\n"),
+				Base:   []byte("a\nx\ne\n"),
+			},
+			merged: true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, conflicted, err := jsonnetfile.ParseConflict([]byte(tc.data))
+			require.NoError(t, err)
+			assert.Equal(t, tc.merged, conflicted)
+			assert.Equal(t, string(tc.want.Ours), string(got.Ours))
+			assert.Equal(t, string(tc.want.Theirs), string(got.Theirs))
+			assert.Equal(t, tc.want.Base, got.Base)
+		})
+	}
+}
+
+func TestParseConflictInvalid(t *testing.T) {
+	_, _, err := jsonnetfile.ParseConflict([]byte("a\n<<<<<<< HEAD\nb\n=======\n"))
+	assert.Error(t, err)
+
+	_, _, err = jsonnetfile.ParseConflict([]byte("<<<<<<< HEAD\n<<<<<<< HEAD\n"))
+	assert.Error(t, err)
+}
+
+func TestMarkConflict(t *testing.T) {
+	marked := jsonnetfile.MarkConflict([]byte(`{"a": 1}`), []byte("{\"a\": 2}\n"))
+
+	got, conflicted, err := jsonnetfile.ParseConflict(marked)
+	require.NoError(t, err)
+	assert.True(t, conflicted)
+	assert.Equal(t, "{\"a\": 1}\n", string(got.Ours))
+	assert.Equal(t, "{\"a\": 2}\n", string(got.Theirs))
+}
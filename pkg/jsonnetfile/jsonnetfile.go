@@ -18,32 +18,83 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"os"
+	"path/filepath"
 
+	"github.com/google/go-jsonnet"
 	"github.com/pkg/errors"
 
 	v0 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v0"
 	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
 const (
 	File     = "jsonnetfile.json"
 	LockFile = "jsonnetfile.lock.json"
+
+	// FileJsonnet is evaluated to the contents of a jsonnetfile.json. It is
+	// never written by jb, the lockfile stays json.
+	FileJsonnet = "jsonnetfile.jsonnet"
+
+	WorkspaceFile     = "jsonnetworkspace.json"
+	WorkspaceLockFile = "jsonnetworkspace.lock.json"
 )
 
 var (
 	ErrUpdateJB = errors.New("jsonnetfile version unknown, update jb")
 )
 
-// Load reads a jsonnetfile.(lock).json from disk
-func Load(filepath string) (v1.JsonnetFile, error) {
-	bytes, err := ioutil.ReadFile(filepath)
+// Load reads a jsonnetfile.(lock).json or a jsonnetfile.jsonnet from disk
+func Load(path string) (v1.JsonnetFile, error) {
+	bytes, err := Read(path)
 	if err != nil {
 		return v1.New(), err
 	}
 
+	if filepath.Base(path) == LockFile {
+		return UnmarshalLock(bytes)
+	}
 	return Unmarshal(bytes)
 }
 
+// Manifest returns the path of the jsonnetfile of the project or workspace
+// member in dir. A jsonnetfile.jsonnet takes precedence over a
+// jsonnetfile.json. If neither exists, the path of the latter is returned.
+// Packages in vendor are always described by their jsonnetfile.json.
+func Manifest(dir string) (string, error) {
+	x, err := Exists(filepath.Join(dir, FileJsonnet))
+	if err != nil {
+		return "", err
+	}
+	if x {
+		return filepath.Join(dir, FileJsonnet), nil
+	}
+	return filepath.Join(dir, File), nil
+}
+
+// IsJsonnet returns whether the jsonnetfile at path needs to be evaluated
+func IsJsonnet(path string) bool {
+	return filepath.Ext(path) == ".jsonnet"
+}
+
+// Read returns the json contents of the jsonnetfile at path. A
+// jsonnetfile.jsonnet is evaluated, with imports relative to it.
+func Read(path string) ([]byte, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil || !IsJsonnet(path) {
+		return bytes, err
+	}
+
+	vm := jsonnet.MakeVM()
+	vm.Importer(&jsonnet.FileImporter{})
+
+	out, err := vm.EvaluateSnippet(path, string(bytes))
+	if err != nil {
+		return nil, errors.Wrapf(err, "evaluating %s", path)
+	}
+	return []byte(out), nil
+}
+
 // Unmarshal creates a spec.JsonnetFile from bytes. Empty bytes
 // will create an empty spec.
 func Unmarshal(bytes []byte) (v1.JsonnetFile, error) {
@@ -74,11 +125,64 @@ func Unmarshal(bytes []byte) (v1.JsonnetFile, error) {
 			return m, errors.Wrap(err, "failed to unmarshal v1 file")
 		}
 		return m, nil
+	case v1.LockVersion:
+		if err := json.Unmarshal(bytes, &m); err != nil {
+			return m, errors.Wrap(err, "failed to unmarshal v2 file")
+		}
+		return m, nil
 	default:
 		return m, ErrUpdateJB
 	}
 }
 
+// UnmarshalLock is like Unmarshal, but for lockfiles, which are upgraded if
+// written by an older version of jb
+func UnmarshalLock(bytes []byte) (v1.JsonnetFile, error) {
+	m, err := Unmarshal(bytes)
+	if err != nil || m.Lock {
+		return m, err
+	}
+	return upgradeLock(m), nil
+}
+
+// upgradeLock fills in what lockfiles before version 2 did not record, but
+// is known nevertheless. The remaining fields are recorded when the package is
+// installed again.
+func upgradeLock(m v1.JsonnetFile) v1.JsonnetFile {
+	for name, d := range m.Dependencies {
+		if d.Sum != "" && d.HashAlgorithm == "" {
+			d.HashAlgorithm = deps.HashSHA256
+			m.Dependencies[name] = d
+		}
+	}
+	return m
+}
+
+// LoadWorkspace reads a jsonnetworkspace.json from disk
+func LoadWorkspace(filepath string) (v1.Workspace, error) {
+	ws := v1.NewWorkspace()
+
+	bytes, err := ioutil.ReadFile(filepath)
+	if err != nil {
+		return ws, err
+	}
+
+	versions := struct {
+		Version uint `json:"version"`
+	}{}
+	if err := json.Unmarshal(bytes, &versions); err != nil {
+		return ws, err
+	}
+	if versions.Version != v1.Version {
+		return ws, ErrUpdateJB
+	}
+
+	if err := json.Unmarshal(bytes, &ws); err != nil {
+		return ws, errors.Wrap(err, "failed to unmarshal workspace file")
+	}
+	return ws, nil
+}
+
 // Exists returns whether the file at the given path exists
 func Exists(path string) (bool, error) {
 	_, err := os.Stat(path)
@@ -151,6 +151,53 @@ var v1Jsonnetfile = v1.JsonnetFile{
 	LegacyImports: false,
 }
 
+const v2JSON = `{
+  "version": 2,
+  "dependencies": [
+	{
+	  "source": {
+		"git": {
+		  "remote": "https://github.com/grafana/jsonnet-libs",
+		  "subdir": "grafana-builder"
+		}
+	  },
+	  "version": "54865853ebc1f901964e25a2e7a0e4d2cb6b9648",
+	  "requested": "v1.0.0",
+	  "tag": "v1.0.0",
+	  "sum": "ELsYwK+kGdzX1mee2Yy+/b2mdO4Y503BOCDkFzwmGbE=",
+	  "hashAlgorithm": "sha256",
+	  "archiveDigest": "6mV1Yn9u+3xC1VvD4JYS0RjQgG9Zs7bK0fHuD3RV0ng=",
+	  "parents": ["."]
+	}
+  ],
+  "legacyImports": false
+}`
+
+var v2Jsonnetfile = v1.JsonnetFile{
+	Dependencies: map[string]deps.Dependency{
+		"github.com/grafana/jsonnet-libs/grafana-builder": {
+			Source: deps.Source{
+				GitSource: &deps.Git{
+					Scheme: deps.GitSchemeHTTPS,
+					Host:   "github.com",
+					User:   "grafana",
+					Repo:   "jsonnet-libs",
+					Subdir: "/grafana-builder",
+				},
+			},
+			Version:       "54865853ebc1f901964e25a2e7a0e4d2cb6b9648",
+			Requested:     "v1.0.0",
+			Tag:           "v1.0.0",
+			Sum:           "ELsYwK+kGdzX1mee2Yy+/b2mdO4Y503BOCDkFzwmGbE=",
+			HashAlgorithm: deps.HashSHA256,
+			ArchiveDigest: "6mV1Yn9u+3xC1VvD4JYS0RjQgG9Zs7bK0fHuD3RV0ng=",
+			Parents:       []string{"."},
+		},
+	},
+	LegacyImports: false,
+	Lock:          true,
+}
+
 func TestVersions(t *testing.T) {
 	tests := []struct {
 		Name        string
@@ -168,6 +215,11 @@ func TestVersions(t *testing.T) {
 			JSON:        v1JSON,
 			Jsonnetfile: v1Jsonnetfile,
 		},
+		{
+			Name:        "v2",
+			JSON:        v2JSON,
+			Jsonnetfile: v2Jsonnetfile,
+		},
 		{
 			Name:        "v100",
 			JSON:        `{"version": 100}`,
@@ -185,6 +237,19 @@ func TestVersions(t *testing.T) {
 	}
 }
 
+func TestUnmarshalLock(t *testing.T) {
+	// lockfiles before version 2 only knew sha256
+	jf, err := jsonnetfile.UnmarshalLock([]byte(v1JSON))
+	assert.Nil(t, err)
+	for name, d := range jf.Dependencies {
+		assert.Equal(t, deps.HashSHA256, d.HashAlgorithm, name)
+	}
+
+	jf, err = jsonnetfile.UnmarshalLock([]byte(v2JSON))
+	assert.Nil(t, err)
+	assert.Equal(t, v2Jsonnetfile, jf)
+}
+
 func TestLoadV1(t *testing.T) {
 	tempDir, err := ioutil.TempDir("", "jb-load-jsonnetfile")
 	if err != nil {
@@ -219,6 +284,59 @@ func TestLoadEmpty(t *testing.T) {
 	assert.Equal(t, v1.New(), got)
 }
 
+func TestLoadJsonnet(t *testing.T) {
+	tempDir, err := ioutil.TempDir("", "jb-load-jsonnet")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	manifest, err := jsonnetfile.Manifest(tempDir)
+	assert.Nil(t, err)
+	assert.Equal(t, filepath.Join(tempDir, jsonnetfile.File), manifest)
+
+	// versions shared across dependencies, imported relative to the manifest
+	err = ioutil.WriteFile(filepath.Join(tempDir, "versions.libsonnet"), []byte(`{ ksonnet: 'master' }`), os.ModePerm)
+	assert.Nil(t, err)
+
+	tempFile := filepath.Join(tempDir, jsonnetfile.FileJsonnet)
+	err = ioutil.WriteFile(tempFile, []byte(`
+local versions = import 'versions.libsonnet';
+local github(repo, subdir) = {
+  source: { git: { remote: 'https://github.com/%s.git' % repo, subdir: subdir } },
+  version: versions.ksonnet,
+};
+
+{
+  version: 1,
+  dependencies: [
+    github('grafana/jsonnet-libs', 'grafana-builder'),
+    github('ksonnet/ksonnet-lib', 'ksonnet.beta.3'),
+  ],
+  legacyImports: false,
+}
+`), os.ModePerm)
+	assert.Nil(t, err)
+
+	manifest, err = jsonnetfile.Manifest(tempDir)
+	assert.Nil(t, err)
+	assert.Equal(t, tempFile, manifest)
+	assert.True(t, jsonnetfile.IsJsonnet(tempFile))
+
+	jf, err := jsonnetfile.Load(tempFile)
+	assert.Nil(t, err)
+	assert.False(t, jf.LegacyImports)
+	assert.Len(t, jf.Dependencies, 2)
+	for _, name := range []string{"github.com/grafana/jsonnet-libs/grafana-builder", "github.com/ksonnet/ksonnet-lib/ksonnet.beta.3"} {
+		assert.Equal(t, "master", jf.Dependencies[name].Version, name)
+	}
+
+	err = ioutil.WriteFile(tempFile, []byte(`{ version: error 'broken' }`), os.ModePerm)
+	assert.Nil(t, err)
+	_, err = jsonnetfile.Load(tempFile)
+	assert.Error(t, err)
+}
+
 func TestLoadNotExist(t *testing.T) {
 	jf, err := jsonnetfile.Load(notExist)
 	assert.Equal(t, v1.New(), jf)
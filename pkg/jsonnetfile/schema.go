@@ -0,0 +1,357 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// node is a json value along with its location in the document, which the
+// standard decoder does not retain
+type node struct {
+	start, end int64
+
+	// kind is the json type: object, array, string, number, boolean or null
+	kind  string
+	value interface{}
+
+	keys     []string
+	keyStart map[string]int64
+	fields   map[string]*node
+	items    []*node
+}
+
+// problem is a diagnostic not yet resolved to a line and column
+type problem struct {
+	offset  int64
+	path    string
+	message string
+	// unknown is set for fields not part of the format
+	unknown bool
+}
+
+// parser builds the tree of nodes, reporting duplicate keys along the way
+type parser struct {
+	data     []byte
+	dec      *json.Decoder
+	problems []problem
+}
+
+// parse returns the root node of data. Syntax errors are reported as a
+// problem, in which case the node is nil.
+func parse(data []byte) (*node, []problem) {
+	p := &parser{data: data, dec: json.NewDecoder(bytes.NewReader(data))}
+	p.dec.UseNumber()
+
+	n, err := p.value("")
+	if err == nil {
+		if end := p.skip(); end < int64(len(data)) {
+			return nil, append(p.problems, problem{offset: end, message: "unexpected data after the document"})
+		}
+		return n, p.problems
+	}
+
+	offset := int64(len(data))
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		// the offset is past the offending byte, unless the input ended
+		if err.Offset > 0 && err.Error() != "unexpected end of JSON input" {
+			offset = err.Offset - 1
+		}
+	default:
+		if err == io.ErrUnexpectedEOF || err == io.EOF {
+			return nil, append(p.problems, problem{offset: offset, message: "unexpected end of JSON input"})
+		}
+	}
+	return nil, append(p.problems, problem{offset: offset, message: err.Error()})
+}
+
+// skip returns the offset of the next token
+func (p *parser) skip() int64 {
+	o := p.dec.InputOffset()
+	for o < int64(len(p.data)) && strings.IndexByte(" \t\r\n,:", p.data[o]) >= 0 {
+		o++
+	}
+	return o
+}
+
+func (p *parser) value(path string) (*node, error) {
+	n := &node{start: p.skip()}
+	tok, err := p.dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			n.kind = "object"
+			n.fields = make(map[string]*node)
+			n.keyStart = make(map[string]int64)
+			for p.dec.More() {
+				start := p.skip()
+				k, err := p.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				key := k.(string)
+
+				child, err := p.value(joinPath(path, key))
+				if err != nil {
+					return nil, err
+				}
+
+				// like encoding/json, the last value wins
+				if _, ok := n.fields[key]; ok {
+					p.problems = append(p.problems, problem{offset: start, path: path, message: fmt.Sprintf("duplicate field `%s`", key)})
+				} else {
+					n.keys = append(n.keys, key)
+				}
+				n.fields[key] = child
+				n.keyStart[key] = start
+			}
+		} else {
+			n.kind = "array"
+			for p.dec.More() {
+				child, err := p.value(fmt.Sprintf("%s[%d]", path, len(n.items)))
+				if err != nil {
+					return nil, err
+				}
+				n.items = append(n.items, child)
+			}
+		}
+
+		// closing delimiter
+		if _, err := p.dec.Token(); err != nil {
+			return nil, err
+		}
+	case string:
+		n.kind = "string"
+	case json.Number:
+		n.kind = "number"
+	case bool:
+		n.kind = "boolean"
+	case nil:
+		n.kind = "null"
+	}
+
+	n.value = tok
+	n.end = p.dec.InputOffset()
+	return n, nil
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// schema is the subset of JSON Schema used by the schemas in spec/
+type schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Enum                 []interface{}      `json:"enum"`
+	Required             []string           `json:"required"`
+	Properties           map[string]*schema `json:"properties"`
+	AdditionalProperties *bool              `json:"additionalProperties"`
+	MinProperties        *int               `json:"minProperties"`
+	MaxProperties        *int               `json:"maxProperties"`
+	Items                *schema            `json:"items"`
+	MinLength            *int               `json:"minLength"`
+	Pattern              string             `json:"pattern"`
+	Definitions          map[string]*schema `json:"definitions"`
+}
+
+func loadSchema(data []byte) (*schema, error) {
+	var s schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// validate checks n against s, which belongs to root. An error is returned if
+// the schema itself is broken.
+func (root *schema) validate(s *schema, n *node, path string) ([]problem, error) {
+	if s.Ref != "" {
+		def, ok := root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+		if !ok {
+			return nil, fmt.Errorf("unknown schema reference %s", s.Ref)
+		}
+		s = def
+	}
+
+	report := func(offset int64, format string, args ...interface{}) []problem {
+		return []problem{{offset: offset, path: path, message: fmt.Sprintf(format, args...)}}
+	}
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, n) {
+		return report(n.start, "must be one of %s, got %s", listValues(s.Enum), n.value), nil
+	}
+	if s.Type != "" && s.Type != n.kind {
+		return report(n.start, "expected %s, got %s", s.Type, n.kind), nil
+	}
+
+	var problems []problem
+	switch n.kind {
+	case "object":
+		for _, r := range s.Required {
+			if _, ok := n.fields[r]; !ok {
+				problems = append(problems, report(n.start, "missing field `%s`", r)...)
+			}
+		}
+
+		for _, key := range n.keys {
+			prop, ok := s.Properties[key]
+			if ok {
+				p, err := root.validate(prop, n.fields[key], joinPath(path, key))
+				if err != nil {
+					return nil, err
+				}
+				problems = append(problems, p...)
+				continue
+			}
+			if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				msg := fmt.Sprintf("unknown field `%s`", key)
+				if similar := closest(key, s.Properties); similar != "" {
+					msg += fmt.Sprintf(", did you mean `%s`?", similar)
+				}
+				problems = append(problems, problem{offset: n.keyStart[key], path: path, message: msg, unknown: true})
+			}
+		}
+
+		if s.MinProperties != nil && len(n.keys) < *s.MinProperties ||
+			s.MaxProperties != nil && len(n.keys) > *s.MaxProperties {
+			problems = append(problems, report(n.start, "expected exactly one of %s", listKeys(s.Properties))...)
+		}
+	case "array":
+		if s.Items != nil {
+			for i, item := range n.items {
+				p, err := root.validate(s.Items, item, fmt.Sprintf("%s[%d]", path, i))
+				if err != nil {
+					return nil, err
+				}
+				problems = append(problems, p...)
+			}
+		}
+	case "string":
+		str := n.value.(string)
+		if s.MinLength != nil && len(str) < *s.MinLength {
+			problems = append(problems, report(n.start, "must not be empty")...)
+		}
+		if s.Pattern != "" {
+			re, err := regexp.Compile(s.Pattern)
+			if err != nil {
+				return nil, errors.Wrapf(err, "schema pattern of %s", path)
+			}
+			if !re.MatchString(str) {
+				problems = append(problems, report(n.start, "must match `%s`", s.Pattern)...)
+			}
+		}
+	}
+	return problems, nil
+}
+
+func enumContains(enum []interface{}, n *node) bool {
+	for _, e := range enum {
+		switch e := e.(type) {
+		case float64:
+			if n.kind == "number" && fmt.Sprint(e) == n.value.(json.Number).String() {
+				return true
+			}
+		default:
+			if e == n.value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func listValues(values []interface{}) string {
+	s := make([]string, len(values))
+	for i, v := range values {
+		b, _ := json.Marshal(v)
+		s[i] = string(b)
+	}
+	return strings.Join(s, ", ")
+}
+
+func listKeys(props map[string]*schema) string {
+	keys := make([]string, 0, len(props))
+	for k := range props {
+		keys = append(keys, "`"+k+"`")
+	}
+	sort.Strings(keys)
+	return strings.Join(keys, ", ")
+}
+
+// closest returns the property most similar to key, if any is close enough
+// to be a typo of it
+func closest(key string, props map[string]*schema) string {
+	best, bestDist := "", 3
+	for p := range props {
+		d := distance(strings.ToLower(key), strings.ToLower(p))
+		if d < bestDist || d == bestDist && p < best {
+			best, bestDist = p, d
+		}
+	}
+	return best
+}
+
+// distance is the Damerau-Levenshtein distance of a and b, counting adjacent
+// transpositions (`verison`) as a single edit
+func distance(a, b string) int {
+	d := make([][]int, len(a)+1)
+	for i := range d {
+		d[i] = make([]int, len(b)+1)
+		d[i][0] = i
+	}
+	for j := range d[0] {
+		d[0][j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			d[i][j] = minInt(d[i-1][j]+1, d[i][j-1]+1, d[i-1][j-1]+cost)
+			if i > 1 && j > 1 && a[i-1] == b[j-2] && a[i-2] == b[j-1] {
+				d[i][j] = minInt(d[i][j], d[i-2][j-2]+1)
+			}
+		}
+	}
+	return d[len(a)][len(b)]
+}
+
+func minInt(x int, ys ...int) int {
+	for _, y := range ys {
+		if y < x {
+			x = y
+		}
+	}
+	return x
+}
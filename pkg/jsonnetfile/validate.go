@@ -0,0 +1,250 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetfile
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	v0 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v0"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// Diagnostic is a problem found in a jsonnetfile or lockfile
+type Diagnostic struct {
+	File string
+	// Line and Column are 1-based. They are 0 if the location is unknown,
+	// e.g. in a jsonnetfile.jsonnet, which is only checked once evaluated.
+	Line   int
+	Column int
+
+	// Path of the offending value, e.g. `dependencies[0].source`
+	Path    string
+	Message string
+
+	// Unknown is set for fields that are not part of the format, which Load
+	// ignores
+	Unknown bool
+}
+
+func (d Diagnostic) String() string {
+	loc := d.File
+	if d.Line > 0 {
+		loc = fmt.Sprintf("%s:%d:%d", d.File, d.Line, d.Column)
+	}
+	if d.Path == "" {
+		return fmt.Sprintf("%s: %s", loc, d.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", loc, d.Path, d.Message)
+}
+
+// Validate checks the jsonnetfile or lockfile at path for problems. Unlike
+// Load, it does not ignore unknown fields, which are most likely typos.
+// Lockfiles are recognized by their name. The returned error is only set if
+// the file can't be read or evaluated at all.
+func Validate(path string) ([]Diagnostic, error) {
+	data, err := Read(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return validateFile(path, data)
+}
+
+// UnknownFields returns the fields of the jsonnetfile or lockfile at path that
+// are not part of its format, given its contents. Load ignores them, so they
+// are most likely typos.
+func UnknownFields(path string, data []byte) ([]Diagnostic, error) {
+	diags, err := validateFile(path, data)
+	if err != nil {
+		return nil, err
+	}
+
+	var unknown []Diagnostic
+	for _, d := range diags {
+		if d.Unknown {
+			unknown = append(unknown, d)
+		}
+	}
+	return unknown, nil
+}
+
+// validateFile validates data, which was read from path
+func validateFile(path string, data []byte) ([]Diagnostic, error) {
+	base := filepath.Base(path)
+	lock := base == LockFile || base == WorkspaceLockFile
+
+	diags, err := ValidateBytes(path, data, lock)
+	if err != nil {
+		return nil, err
+	}
+	if IsJsonnet(path) {
+		// the locations refer to the evaluated json, not to the jsonnet
+		for i := range diags {
+			diags[i].Line, diags[i].Column = 0, 0
+		}
+	}
+	return diags, nil
+}
+
+// ValidateBytes checks the contents of a jsonnetfile, or a lockfile if lock is
+// set, against the JSON Schema of its version. Dependencies are parsed as well,
+// to catch e.g. invalid git remotes. file is only used for the diagnostics.
+func ValidateBytes(file string, data []byte, lock bool) ([]Diagnostic, error) {
+	root, problems := parse(data)
+	if root != nil {
+		p, err := check(root, data, lock)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, p...)
+	}
+
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].offset < problems[j].offset
+	})
+
+	diags := make([]Diagnostic, 0, len(problems))
+	for _, p := range problems {
+		line, col := position(data, p.offset)
+		diags = append(diags, Diagnostic{
+			File:    file,
+			Line:    line,
+			Column:  col,
+			Path:    p.path,
+			Message: p.message,
+			Unknown: p.unknown,
+		})
+	}
+	return diags, nil
+}
+
+func check(root *node, data []byte, lock bool) ([]problem, error) {
+	version := v0.Version
+	if v, ok := root.fields["version"]; ok && v.kind == "number" {
+		n, err := v.value.(json.Number).Int64()
+		if err == nil {
+			version = int(n)
+		}
+	}
+
+	raw := v1.Schema
+	switch {
+	case root.kind == "object" && version == v0.Version:
+		raw = v0.Schema
+	case lock:
+		raw = v1.LockSchema
+	}
+
+	s, err := loadSchema(raw)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid schema")
+	}
+
+	problems, err := s.validate(s, root, "")
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid schema")
+	}
+	if version == v0.Version || root.kind != "object" {
+		return problems, nil
+	}
+
+	// the schema can't tell whether a remote is valid or two entries
+	// install into the same directory
+	seen := make(map[string]*node)
+	if list := root.fields["dependencies"]; list != nil && list.kind == "array" {
+		for i, item := range list.items {
+			path := fmt.Sprintf("dependencies[%d]", i)
+			if failed(problems, path) || item.kind != "object" {
+				continue
+			}
+
+			d, p := checkDependency(item, data, path)
+			if p != nil {
+				problems = append(problems, *p)
+				continue
+			}
+
+			if first, ok := seen[d.Name()]; ok {
+				line, _ := position(data, first.start)
+				problems = append(problems, problem{offset: item.start, path: path,
+					message: fmt.Sprintf("`%s` is already installed by the dependency at line %d, use `as` to install both", d.Name(), line)})
+				continue
+			}
+			seen[d.Name()] = item
+		}
+	}
+
+	if list := root.fields["replace"]; list != nil && list.kind == "array" {
+		for i, item := range list.items {
+			path := fmt.Sprintf("replace[%d].with", i)
+			with := item.fields["with"]
+			if failed(problems, path) || with == nil {
+				continue
+			}
+			if _, p := checkDependency(with, data, path); p != nil {
+				problems = append(problems, *p)
+			}
+		}
+	}
+
+	return problems, nil
+}
+
+// checkDependency parses the dependency at n, reporting why it can't be used
+func checkDependency(n *node, data []byte, path string) (*deps.Dependency, *problem) {
+	var d deps.Dependency
+	if err := json.Unmarshal(data[n.start:n.end], &d); err != nil {
+		at, atPath := n.start, path
+		if src := n.fields["source"]; src != nil && src.fields["git"] != nil && src.fields["git"].fields["remote"] != nil {
+			at, atPath = src.fields["git"].fields["remote"].start, path+".source.git.remote"
+		}
+		return nil, &problem{offset: at, path: atPath, message: err.Error()}
+	}
+
+	if d.Alias != "" {
+		if err := deps.ValidateAlias(d.Alias); err != nil {
+			return nil, &problem{offset: n.fields["as"].start, path: path + ".as", message: err.Error()}
+		}
+	}
+	return &d, nil
+}
+
+// failed returns whether any of the problems concerns path or a value below
+func failed(problems []problem, path string) bool {
+	for _, p := range problems {
+		if p.path == path || len(p.path) > len(path) && p.path[:len(path)] == path && (p.path[len(path)] == '.' || p.path[len(path)] == '[') {
+			return true
+		}
+	}
+	return false
+}
+
+// position converts an offset in data to a 1-based line and column
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	col := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, col
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jsonnetfile_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		lock bool
+		want []string
+	}{
+		{
+			name: "valid-v1",
+			data: v1JSON,
+		},
+		{
+			name: "valid-v0",
+			data: v0JSON,
+		},
+		{
+			name: "valid-lock",
+			data: v2JSON,
+			lock: true,
+		},
+		{
+			name: "typos",
+			data: `{
+  "version": 1,
+  "dependencies": [
+    {
+      "source": { "git": { "remote": "https://github.com/grafana/jsonnet-libs.git", "subDir": "grafana-builder" } },
+      "verison": "master"
+    }
+  ],
+  "legacyImports": false
+}`,
+			want: []string{
+				"f:5:85: dependencies[0].source.git: unknown field `subDir`, did you mean `subdir`?",
+				"f:6:7: dependencies[0]: unknown field `verison`, did you mean `version`?",
+			},
+		},
+		{
+			name: "types",
+			data: `{"version": 1, "dependencies": [{"source": {}, "version": 1}], "legacyImports": "yes"}`,
+			want: []string{
+				"f:1:44: dependencies[0].source: expected exactly one of `git`, `gitlab`, `http`, `local`",
+				"f:1:59: dependencies[0].version: expected string, got number",
+				"f:1:81: legacyImports: expected boolean, got string",
+			},
+		},
+		{
+			name: "remote",
+			data: "{\"version\": 1, \"dependencies\": [\n  {\"source\": {\"git\": {\"remote\": \"github.com\"}}}\n]}",
+			want: []string{
+				"f:2:33: dependencies[0].source.git.remote: invalid path `` in git url `github.com`",
+			},
+		},
+		{
+			name: "duplicates",
+			data: `{
+  "version": 1,
+  "version": 1,
+  "dependencies": [
+    {"source": {"local": {"directory": "a"}}},
+    {"source": {"local": {"directory": "a"}}},
+    {"source": {"local": {"directory": "a"}}, "as": "../b"}
+  ]
+}`,
+			want: []string{
+				"f:3:3: duplicate field `version`",
+				"f:6:5: dependencies[1]: `a` is already installed by the dependency at line 5, use `as` to install both",
+				"f:7:53: dependencies[2].as: alias `../b` must be a clean path inside of the vendor directory",
+			},
+		},
+		{
+			name: "version",
+			data: `{"version": 2, "dependencies": []}`,
+			want: []string{"f:1:13: version: must be one of 1, got 2"},
+		},
+		{
+			name: "lock-fields",
+			data: `{"version": 2, "dependencies": [{"source": {"local": {"directory": "a"}}, "parents": ["."], "hashAlgorithm": "md5"}]}`,
+			lock: true,
+			want: []string{`f:1:110: dependencies[0].hashAlgorithm: must be one of "sha256", got md5`},
+		},
+		{
+			name: "syntax",
+			data: "{\"version\": 1,\n  \"dependencies\": [}",
+			want: []string{"f:2:20: invalid character '}' looking for beginning of value"},
+		},
+		{
+			name: "trailing",
+			data: `{"version": 1} x`,
+			want: []string{"f:1:16: unexpected data after the document"},
+		},
+		{
+			name: "truncated",
+			data: "{\"version\": 1,\n",
+			want: []string{"f:2:1: unexpected end of JSON input"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			diags, err := jsonnetfile.ValidateBytes("f", []byte(tc.data), tc.lock)
+			require.NoError(t, err)
+
+			got := []string{}
+			for _, d := range diags {
+				got = append(got, d.String())
+			}
+			if tc.want == nil {
+				tc.want = []string{}
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	data := []byte(`{"version": 1, "dependencies": [{"source": {"local": {"directory": "a"}}, "vesion": "v1"}], "legacyImport": false}`)
+
+	unknown, err := jsonnetfile.UnknownFields("jsonnetfile.json", data)
+	require.NoError(t, err)
+	require.Len(t, unknown, 2)
+	assert.Equal(t, "jsonnetfile.json:1:75: dependencies[0]: unknown field `vesion`, did you mean `version`?", unknown[0].String())
+	assert.Equal(t, "jsonnetfile.json:1:93: unknown field `legacyImport`, did you mean `legacyImports`?", unknown[1].String())
+
+	// other problems are left to jb validate
+	unknown, err = jsonnetfile.UnknownFields("jsonnetfile.json", []byte(`{"version": 1, "dependencies": {}}`))
+	require.NoError(t, err)
+	assert.Empty(t, unknown)
+}
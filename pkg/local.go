@@ -16,17 +16,23 @@ package pkg
 
 import (
 	"context"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
-	"github.com/fatih/color"
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/format/gitignore"
 	"github.com/pkg/errors"
 
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
 type LocalPackage struct {
+	// Source.Directory is relative to the working directory, unless absolute
 	Source *deps.Local
+
+	Env
 }
 
 func NewLocalPackage(source *deps.Local) Interface {
@@ -36,14 +42,15 @@ func NewLocalPackage(source *deps.Local) Interface {
 }
 
 func (p *LocalPackage) Install(ctx context.Context, name, dir, version string) (lockVersion string, err error) {
-	wd, err := os.Getwd()
+	oldname, err := filepath.Abs(p.Source.Directory)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to get current working directory")
+		return "", errors.Wrap(err, "failed to resolve directory")
 	}
 
-	oldname := filepath.Join(wd, p.Source.Directory)
+	// names may be nested, like aliases such as `team/lib-v1`, so the link
+	// is relative to its parent directory rather than to dir
 	newname := filepath.Join(dir, name)
-	linkname, err := filepath.Rel(dir, oldname)
+	linkname, err := filepath.Rel(filepath.Dir(newname), oldname)
 
 	if err != nil {
 		linkname = oldname
@@ -54,17 +61,134 @@ func (p *LocalPackage) Install(ctx context.Context, name, dir, version string) (
 		return "", errors.Wrap(err, "failed to clean previous destination path")
 	}
 
+	// dir itself must exist already
+	if parent := filepath.Dir(newname); parent != filepath.Clean(dir) {
+		if err := os.MkdirAll(parent, os.ModePerm); err != nil {
+			return "", errors.Wrap(err, "failed to create parent of destination path")
+		}
+	}
+
 	_, err = os.Stat(oldname)
 	if os.IsNotExist(err) {
+		if p.Source.Copied() {
+			return "", errors.Wrap(err, "local directory does not exist")
+		}
 		return "", errors.Wrap(err, "symlink destination path does not exist")
 	}
 
+	if p.Source.Copied() {
+		skip, err := copySkip(oldname)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to read .gitignore of local dependency")
+		}
+
+		err = copyDirSkip(oldname, newname, skip)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to copy local dependency")
+		}
+
+		p.emit(Event{Type: EventCopy, Package: name, Path: newname, Target: oldname})
+		return localCommit(oldname), nil
+	}
+
 	err = os.Symlink(linkname, newname)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to create symlink for local dependency")
 	}
 
-	color.Magenta("LOCAL %s -> %s", name, oldname)
+	p.emit(Event{Type: EventLink, Kind: LinkLocal, Package: name, Path: newname, Target: oldname})
 
 	return "", nil
 }
+
+// copySkip returns whether a file of the local directory dir is left out when
+// copying it: the git metadata and the files ignored by git
+func copySkip(dir string) (func(rel string, info os.FileInfo) bool, error) {
+	ignored, err := gitignored(dir)
+	if err != nil {
+		return nil, err
+	}
+	return func(rel string, info os.FileInfo) bool {
+		return info.Name() == ".git" || ignored.Match(strings.Split(filepath.ToSlash(rel), "/"), info.IsDir())
+	}, nil
+}
+
+// localSum returns the sum of the files a copy of the local directory dir
+// has in vendor, once filtered by include and exclude
+func localSum(dir string, include, exclude []string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	skip, err := copySkip(dir)
+	if err != nil {
+		return "", err
+	}
+
+	return hashDirSkip(dir, func(rel string, info os.FileInfo) bool {
+		if skip(rel, info) {
+			return true
+		}
+		if info.IsDir() || keep(info.Name()) || (len(include) == 0 && len(exclude) == 0) {
+			return false
+		}
+		ok, err := included(filepath.ToSlash(rel), include, exclude)
+		return err == nil && !ok
+	}), nil
+}
+
+// gitignored returns a matcher for the paths ignored by the .gitignore files
+// in dir and its subdirectories. Those of parent directories don't apply.
+func gitignored(dir string) (gitignore.Matcher, error) {
+	var patterns []gitignore.Pattern
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() && info.Name() == ".git" {
+			return filepath.SkipDir
+		}
+		if info.IsDir() || info.Name() != ".gitignore" {
+			return nil
+		}
+
+		rel, err := filepath.Rel(dir, filepath.Dir(path))
+		if err != nil {
+			return err
+		}
+		var domain []string
+		if rel != "." {
+			domain = strings.Split(filepath.ToSlash(rel), "/")
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			line = strings.TrimRight(line, "\r")
+			if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			patterns = append(patterns, gitignore.ParsePattern(line, domain))
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return gitignore.NewMatcher(patterns), nil
+}
+
+// localCommit returns the commit checked out in the git repository containing
+// dir. It is empty if dir is not part of one.
+func localCommit(dir string) string {
+	repo, err := git.PlainOpenWithOptions(dir, &git.PlainOpenOptions{DetectDotGit: true})
+	if err != nil {
+		return ""
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return ""
+	}
+	return head.Hash().String()
+}
@@ -18,11 +18,14 @@ import (
 	"context"
 	"io/ioutil"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
@@ -85,3 +88,134 @@ func TestLocalInstallSourceAndTargetDoNotExist(t *testing.T) {
 	assert.Error(t, err)
 	assert.Empty(t, lockVersion)
 }
+
+func TestEnsureLocalCopy(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "jb-local")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "main.libsonnet"), "{}")
+	writeFile(t, filepath.Join(lib, "docs", "index.md"), "docs")
+	testGit(t, lib, "init", "-q")
+	testGit(t, lib, "add", ".")
+	testGit(t, lib, "commit", "-q", "-m", "initial")
+	commit := testGit(t, lib, "rev-parse", "HEAD")
+
+	d := deps.Dependency{
+		Source:  deps.Source{LocalSource: &deps.Local{Directory: "../lib", Mode: deps.LocalCopy}},
+		Exclude: []string{"docs"},
+	}
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = d
+
+	root := filepath.Join(tmp, "project")
+	rec := &recorder{}
+	in, err := NewInstaller(InstallerOptions{RootDir: root, Observer: rec})
+	require.NoError(t, err)
+	ensure := func(locks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+		require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+		return in.Ensure(jf, locks)
+	}
+
+	locks, err := ensure(map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	vendored := filepath.Join(root, "vendor", "lib")
+	info, err := os.Lstat(vendored)
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	for name, want := range map[string]bool{
+		"main.libsonnet": true,
+		"docs":           false,
+		".git":           false,
+	} {
+		_, err := os.Stat(filepath.Join(vendored, name))
+		assert.Equal(t, want, err == nil, name)
+	}
+
+	l := locks["lib"]
+	assert.Equal(t, hashDir(vendored), l.Sum)
+	assert.Equal(t, deps.HashSHA256, l.HashAlgorithm)
+	assert.Equal(t, commit, l.Version)
+	assert.Len(t, rec.ofType(EventCopy), 1)
+
+	// changes to excluded files don't matter
+	writeFile(t, filepath.Join(lib, "docs", "index.md"), "more docs")
+	locks, err = ensure(locks)
+	require.NoError(t, err)
+	assert.Empty(t, rec.ofType(EventWarn))
+
+	// the copy stays as it is when the files change, with a warning
+	writeFile(t, filepath.Join(lib, "main.libsonnet"), "{ a: 1 }")
+	locks, err = ensure(locks)
+	require.NoError(t, err)
+	assert.Equal(t, l, locks["lib"])
+	require.Len(t, rec.ofType(EventWarn), 1)
+	assert.Contains(t, rec.ofType(EventWarn)[0].Message, "changed since it was copied")
+
+	// or the directory moves on to another commit
+	testGit(t, lib, "commit", "-q", "-am", "change")
+
+	locks, err = ensure(locks)
+	require.NoError(t, err)
+	assert.Equal(t, l, locks["lib"])
+	require.Len(t, rec.ofType(EventWarn), 2)
+	assert.Contains(t, rec.ofType(EventWarn)[1].Message, "copied at commit")
+
+	// but can't be copied again without updating the lock
+	require.NoError(t, os.RemoveAll(vendored))
+	_, err = ensure(locks)
+	assert.Error(t, err)
+}
+
+func TestEnsureLocalCopyGitignore(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-local")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "main.libsonnet"), "{}")
+	writeFile(t, filepath.Join(lib, ".gitignore"), "# scratch files\n*.tmp\n")
+	writeFile(t, filepath.Join(lib, "gen", ".gitignore"), "/out/\n")
+
+	d := deps.Dependency{
+		Source: deps.Source{LocalSource: &deps.Local{Directory: "../lib", Mode: deps.LocalCopy}},
+	}
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = d
+
+	root := filepath.Join(tmp, "project")
+	in, err := NewInstaller(InstallerOptions{RootDir: root})
+	require.NoError(t, err)
+	ensure := func() map[string]deps.Dependency {
+		require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+		locks, err := in.Ensure(jf, map[string]deps.Dependency{})
+		require.NoError(t, err)
+		return locks
+	}
+
+	sum := ensure()["lib"].Sum
+
+	// ignored files are neither copied nor part of the sum
+	writeFile(t, filepath.Join(lib, "scratch.tmp"), "scratch")
+	writeFile(t, filepath.Join(lib, "gen", "out", "main.json"), "{}")
+	require.NoError(t, os.RemoveAll(filepath.Join(root, "vendor")))
+
+	locks := ensure()
+	vendored := filepath.Join(root, "vendor", "lib")
+	for name, want := range map[string]bool{
+		"main.libsonnet": true,
+		"gen/.gitignore": true,
+		"scratch.tmp":    false,
+		"gen/out":        false,
+	} {
+		_, err := os.Stat(filepath.Join(vendored, name))
+		assert.Equal(t, want, err == nil, name)
+	}
+	assert.Equal(t, sum, locks["lib"].Sum)
+}
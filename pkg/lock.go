@@ -0,0 +1,248 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// MergeLocks merges the locked dependencies of two sides of a conflicting
+// change. Entries changed on one side only are taken from that side. Entries
+// changed differently on both sides are left out and their names returned,
+// so that ResolveConflicts resolves them again.
+//
+// base is the common ancestor of both sides. If it is nil, entries present on
+// one side only are kept, as they can't be told apart from removed ones.
+// Unneeded entries are dropped by Ensure anyway.
+func MergeLocks(base, ours, theirs map[string]deps.Dependency) (map[string]deps.Dependency, []string) {
+	merged := make(map[string]deps.Dependency)
+	conflicts := []string{}
+
+	names := make(map[string]bool)
+	for name := range ours {
+		names[name] = true
+	}
+	for name := range theirs {
+		names[name] = true
+	}
+
+	for name := range names {
+		o, inOurs := ours[name]
+		t, inTheirs := theirs[name]
+		b, inBase := base[name]
+
+		switch {
+		case inOurs && inTheirs && lockEqual(o, t):
+			merged[name] = o
+
+		// without an ancestor, any difference is a conflict
+		case base == nil && inOurs && inTheirs:
+			conflicts = append(conflicts, name)
+		case base == nil && inOurs:
+			merged[name] = o
+		case base == nil && inTheirs:
+			merged[name] = t
+
+		// changed on one side only
+		case inOurs && inTheirs && inBase && lockEqual(b, o):
+			merged[name] = t
+		case inOurs && inTheirs && inBase && lockEqual(b, t):
+			merged[name] = o
+
+		// added on one side only
+		case !inBase && !inTheirs:
+			merged[name] = o
+		case !inBase && !inOurs:
+			merged[name] = t
+
+		// removed on one side, unchanged on the other
+		case inBase && !inTheirs && lockEqual(b, o),
+			inBase && !inOurs && lockEqual(b, t):
+			continue
+
+		default:
+			conflicts = append(conflicts, name)
+		}
+	}
+
+	sort.Strings(conflicts)
+	return merged, conflicts
+}
+
+// lockEqual compares two locked dependencies. Parents are not considered, as
+// they are derived from the other entries.
+func lockEqual(a, b deps.Dependency) bool {
+	a.Parents, b.Parents = nil, nil
+	return reflect.DeepEqual(a, b)
+}
+
+// requirer is a jsonnetfile requiring packages, that of the project being `.`
+type requirer struct {
+	name string
+	// dir relative local dependencies are resolved against, empty for the
+	// project
+	dir  string
+	deps map[string]deps.Dependency
+}
+
+// ResolveConflicts resolves the packages names again and adds them to the
+// merged locks returned by MergeLocks. Direct dependencies are resolved
+// against the jsonnetfile, nested ones against the jsonnetfiles of the
+// packages requiring them. Only the packages names are retrieved, into a
+// temporary directory: the vendor directory is left untouched.
+//
+// Packages required by no known jsonnetfile are left out with a warning, as
+// the vendored packages may not match merged. Ensure resolves them again.
+func (in *Installer) ResolveConflicts(direct v1.JsonnetFile, merged map[string]deps.Dependency, names []string) (map[string]deps.Dependency, error) {
+	locks := make(map[string]deps.Dependency, len(merged)+len(names))
+	for name, l := range merged {
+		locks[name] = l
+	}
+	if len(names) == 0 {
+		return locks, nil
+	}
+
+	scratch, err := ioutil.TempDir("", "jb-resolve")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+	if err := os.MkdirAll(filepath.Join(scratch, ".tmp"), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	resolver := *in
+	resolver.vendorDir = scratch
+	resolver.env.Observer = scratchObserver(in.env.Observer)
+
+	// the requirements of merged packages are known from vendor, as long as
+	// it matches them
+	queue := []requirer{{name: ".", deps: direct.Dependencies}}
+	for _, name := range sortedNames(merged) {
+		l := merged[name]
+		if !linked(l) && !check(l, in.vendorDir) {
+			continue
+		}
+		r, ok, err := in.requirer(in.vendorDir, l, "")
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			queue = append(queue, r)
+		}
+	}
+
+	pending := make(map[string]bool, len(names))
+	for _, name := range names {
+		pending[name] = true
+	}
+	parents := make(map[string][]string)
+
+	for len(queue) > 0 {
+		r := queue[0]
+		queue = queue[1:]
+
+		for _, name := range sortedNames(r.deps) {
+			d := replaced(r.deps[name], direct.Replace)
+			if _, conflicting := pending[d.Name()]; !conflicting {
+				continue
+			}
+			parents[d.Name()] = append(parents[d.Name()], r.name)
+			if !pending[d.Name()] {
+				continue
+			}
+			pending[d.Name()] = false
+
+			requested := d.Version
+			locked, err := resolver.download(d, r.dir)
+			if err != nil {
+				return nil, errors.Wrapf(err, "resolving %s", d.Name())
+			}
+			locked.Requested = requested
+			locks[locked.Name()] = *locked
+
+			nested, ok, err := resolver.requirer(scratch, *locked, r.dir)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				queue = append(queue, nested)
+			}
+		}
+	}
+
+	for _, name := range names {
+		if pending[name] {
+			in.env.emit(Event{Type: EventWarn, Package: name, Message: fmt.Sprintf("%s is required by no package jb knows of, left out of the lock. Run `jb install` to resolve it again", name)})
+			continue
+		}
+		l := locks[name]
+		l.Parents = parents[name]
+		sort.Strings(l.Parents)
+		locks[name] = l
+	}
+	return locks, nil
+}
+
+// requirer returns the jsonnetfile of the package l installed in vendorDir,
+// if it has one and wants its nested dependencies installed.
+// pathToParentModule is the directory of the module l was declared in.
+func (in *Installer) requirer(vendorDir string, l deps.Dependency, pathToParentModule string) (requirer, bool, error) {
+	if l.Single {
+		return requirer{}, false, nil
+	}
+
+	dir := filepath.Join(vendorDir, l.Name())
+	f, err := jsonnetfile.Load(filepath.Join(dir, jsonnetfile.File))
+	if os.IsNotExist(err) {
+		return requirer{}, false, nil
+	}
+	if err != nil {
+		return requirer{}, false, err
+	}
+	for _, name := range l.ExcludeDependencies {
+		delete(f.Dependencies, name)
+	}
+
+	// relative paths of copies are relative to the original directory
+	if l.FetchSource().LocalSource.Copied() {
+		dir = in.localDir(l, pathToParentModule)
+	} else if dir, err = filepath.EvalSymlinks(dir); err != nil {
+		return requirer{}, false, err
+	}
+	return requirer{name: l.Name(), dir: dir, deps: f.Dependencies}, true, nil
+}
+
+// sortedNames returns the keys of m in order, so that packages are resolved
+// deterministically
+func sortedNames(m map[string]deps.Dependency) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,153 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestMergeLocks(t *testing.T) {
+	lock := func(repo, version string) deps.Dependency {
+		return deps.Dependency{
+			Source: deps.Source{GitSource: &deps.Git{
+				Scheme: deps.GitSchemeHTTPS,
+				Host:   "github.com",
+				User:   "example",
+				Repo:   repo,
+			}},
+			Version: version,
+		}
+	}
+	locks := func(ds ...deps.Dependency) map[string]deps.Dependency {
+		m := make(map[string]deps.Dependency)
+		for _, d := range ds {
+			m[d.Name()] = d
+		}
+		return m
+	}
+
+	tests := []struct {
+		name               string
+		base, ours, theirs map[string]deps.Dependency
+		want               map[string]deps.Dependency
+		wantConflicts      []string
+	}{
+		{
+			name:          "added-both-sides",
+			base:          locks(),
+			ours:          locks(lock("a", "1")),
+			theirs:        locks(lock("b", "1")),
+			want:          locks(lock("a", "1"), lock("b", "1")),
+			wantConflicts: []string{},
+		},
+		{
+			name:          "changed-one-side",
+			base:          locks(lock("a", "1"), lock("b", "1")),
+			ours:          locks(lock("a", "2"), lock("b", "1")),
+			theirs:        locks(lock("a", "1"), lock("b", "2")),
+			want:          locks(lock("a", "2"), lock("b", "2")),
+			wantConflicts: []string{},
+		},
+		{
+			name:          "changed-both-sides",
+			base:          locks(lock("a", "1"), lock("b", "1")),
+			ours:          locks(lock("a", "2"), lock("b", "1")),
+			theirs:        locks(lock("a", "3"), lock("b", "1")),
+			want:          locks(lock("b", "1")),
+			wantConflicts: []string{"github.com/example/a"},
+		},
+		{
+			name:          "removed-one-side",
+			base:          locks(lock("a", "1"), lock("b", "1")),
+			ours:          locks(lock("b", "1")),
+			theirs:        locks(lock("a", "1"), lock("b", "1")),
+			want:          locks(lock("b", "1")),
+			wantConflicts: []string{},
+		},
+		{
+			name:          "removed-and-changed",
+			base:          locks(lock("a", "1")),
+			ours:          locks(),
+			theirs:        locks(lock("a", "2")),
+			want:          locks(),
+			wantConflicts: []string{"github.com/example/a"},
+		},
+		{
+			name:          "no-base",
+			base:          nil,
+			ours:          locks(lock("a", "1"), lock("b", "1")),
+			theirs:        locks(lock("a", "2"), lock("c", "1")),
+			want:          locks(lock("b", "1"), lock("c", "1")),
+			wantConflicts: []string{"github.com/example/a"},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, conflicts := MergeLocks(tc.base, tc.ours, tc.theirs)
+			assert.Equal(t, tc.want, got)
+			assert.Equal(t, tc.wantConflicts, conflicts)
+		})
+	}
+}
+
+func TestResolveConflicts(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-lock")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// a requires c, b is not conflicting
+	writeFile(t, filepath.Join(tmp, "a", "jsonnetfile.json"), `{"version": 1, "dependencies": [{"source": {"local": {"directory": "../c"}}, "version": ""}]}`)
+	writeFile(t, filepath.Join(tmp, "c", "main.libsonnet"), "{}")
+
+	local := func(dir string) deps.Dependency {
+		return deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: dir}}}
+	}
+	jf := v1.New()
+	jf.Dependencies["a"] = local("a")
+	jf.Dependencies["b"] = local("b")
+
+	root := filepath.Join(tmp, "project")
+	rec := &recorder{}
+	in, err := NewInstaller(InstallerOptions{RootDir: tmp, VendorDir: filepath.Join(root, "vendor"), Observer: rec})
+	require.NoError(t, err)
+
+	b := local("b")
+	b.Sum = "unchecked"
+	locks, err := in.ResolveConflicts(jf, map[string]deps.Dependency{"b": b}, []string{"a", "c", "gone"})
+	require.NoError(t, err)
+
+	c := local("../c")
+	c.Parents = []string{"a"}
+	a := local("a")
+	a.Parents = []string{"."}
+	assert.Equal(t, map[string]deps.Dependency{"a": a, "b": b, "c": c}, locks)
+
+	// required by nothing anymore
+	require.Len(t, rec.ofType(EventWarn), 1)
+	assert.Equal(t, "gone", rec.ofType(EventWarn)[0].Package)
+
+	_, err = os.Stat(root)
+	assert.True(t, os.IsNotExist(err))
+}
@@ -20,11 +20,13 @@ import (
 	"encoding/base64"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
 
-	"github.com/fatih/color"
 	"github.com/pkg/errors"
 
 	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
@@ -49,14 +51,67 @@ var (
 //
 // Finally, all unknown files and directories are removed from vendor/
 // The full list of locked depedencies is returned
+//
+// Packages are retrieved silently, using the DefaultGitBackend and Proxy.
+// Relative local dependencies are resolved against the working directory.
 func Ensure(direct v1.JsonnetFile, vendorDir string, oldLocks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	in, err := NewInstaller(InstallerOptions{VendorDir: vendorDir, Proxy: Proxy})
+	if err != nil {
+		return nil, err
+	}
+	return in.Ensure(direct, oldLocks)
+}
+
+// Ensure works like the package level Ensure, installing into the vendor
+// directory of the Installer. If pruning, the files not reachable from the
+// entrypoints are removed afterwards.
+func (in *Installer) Ensure(direct v1.JsonnetFile, oldLocks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	locks, err := in.install(direct, oldLocks)
+	if err != nil || !in.prune {
+		return locks, err
+	}
+
+	// files removed by an earlier run may be imported by now. Such packages
+	// are installed completely again, until all imports can be resolved.
+	for {
+		reachable, missing, err := in.reachable(direct, locks)
+		if err != nil {
+			return nil, errors.Wrap(err, "following imports")
+		}
+		if len(missing) == 0 {
+			return locks, in.pruneAll(locks, reachable)
+		}
+
+		for _, name := range missing {
+			if err := os.RemoveAll(filepath.Join(in.vendorDir, name)); err != nil {
+				return nil, err
+			}
+		}
+		// removed by install, like all unknown directories
+		if err := os.MkdirAll(filepath.Join(in.vendorDir, ".tmp"), os.ModePerm); err != nil {
+			return nil, err
+		}
+		if locks, err = in.install(direct, locks); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// install makes sure all packages are present in vendor, see Ensure
+func (in *Installer) install(direct v1.JsonnetFile, oldLocks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	vendorDir := in.vendorDir
+
 	// ensure all required files are in vendor
 	// This is the actual installation
-	locks, err := ensure(direct.Dependencies, vendorDir, "", oldLocks)
+	locks, err := in.ensure(direct.Dependencies, "", oldLocks, direct.Replace)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := recordParents(direct, vendorDir, locks); err != nil {
+		return nil, err
+	}
+
 	// remove unchanged legacyNames
 	CleanLegacyName(locks)
 
@@ -85,7 +140,7 @@ func Ensure(direct v1.JsonnetFile, vendorDir string, oldLocks map[string]deps.De
 				return nil, err
 			}
 			if !strings.HasPrefix(name, ".tmp") {
-				color.Magenta("CLEAN %s", dir)
+				in.env.emit(Event{Type: EventClean, Path: dir})
 			}
 		}
 	}
@@ -97,7 +152,7 @@ func Ensure(direct v1.JsonnetFile, vendorDir string, oldLocks map[string]deps.De
 	if !direct.LegacyImports {
 		return locks, nil
 	}
-	if err := linkLegacy(vendorDir, locks); err != nil {
+	if err := in.linkLegacy(locks); err != nil {
 		return nil, err
 	}
 
@@ -120,7 +175,7 @@ func cleanLegacySymlinks(vendorDir string, locks map[string]deps.Dependency) err
 	// local packages need to be ignored
 	locals := map[string]bool{}
 	for _, d := range locks {
-		if d.Source.LocalSource == nil {
+		if d.FetchSource().LocalSource == nil {
 			continue
 		}
 
@@ -142,20 +197,25 @@ func cleanLegacySymlinks(vendorDir string, locks map[string]deps.Dependency) err
 	})
 }
 
-func linkLegacy(vendorDir string, locks map[string]deps.Dependency) error {
+func (in *Installer) linkLegacy(locks map[string]deps.Dependency) error {
 	// create only the ones we want
 	for _, d := range locks {
 		// localSource still uses the relative style
-		if d.Source.LocalSource != nil {
+		if d.FetchSource().LocalSource != nil {
+			continue
+		}
+
+		// aliases without a path are their own legacy name
+		if d.LegacyName() == d.Name() {
 			continue
 		}
 
-		legacyName := filepath.Join(vendorDir, d.LegacyName())
+		legacyName := filepath.Join(in.vendorDir, d.LegacyName())
 		pkgName := d.Name()
 
-		taken, err := checkLegacyNameTaken(legacyName, pkgName)
+		taken, err := in.checkLegacyNameTaken(legacyName, pkgName)
 		if err != nil {
-			fmt.Println(err)
+			in.env.emit(Event{Type: EventWarn, Package: pkgName, Message: err.Error()})
 			continue
 		}
 		if taken {
@@ -169,11 +229,12 @@ func linkLegacy(vendorDir string, locks map[string]deps.Dependency) error {
 		); err != nil {
 			return err
 		}
+		in.env.emit(Event{Type: EventLink, Kind: LinkLegacy, Package: pkgName, Path: legacyName, Target: pkgName})
 	}
 	return nil
 }
 
-func checkLegacyNameTaken(legacyName string, pkgName string) (bool, error) {
+func (in *Installer) checkLegacyNameTaken(legacyName string, pkgName string) (bool, error) {
 	fi, err := os.Lstat(legacyName)
 	if err != nil {
 		// does not exist: not taken
@@ -190,57 +251,117 @@ func checkLegacyNameTaken(legacyName string, pkgName string) (bool, error) {
 		if err != nil {
 			return false, err
 		}
-		color.Yellow("WARN: cannot link '%s' to '%s', because package '%s' already uses that name. The absolute import still works\n", pkgName, legacyName, s)
+		in.env.emit(Event{Type: EventWarn, Package: pkgName, Message: fmt.Sprintf("cannot link '%s' to '%s', because package '%s' already uses that name. The absolute import still works", pkgName, legacyName, s)})
 		return true, nil
 	}
 
 	// sth else
-	color.Yellow("WARN: cannot link '%s' to '%s', because the file/directory already exists. The absolute import still works.\n", pkgName, legacyName)
+	in.env.emit(Event{Type: EventWarn, Package: pkgName, Message: fmt.Sprintf("cannot link '%s' to '%s', because the file/directory already exists. The absolute import still works.", pkgName, legacyName)})
 	return true, nil
 }
 
+// known returns whether p is the vendor path of a package, inside of one or a
+// parent directory of one. Paths are compared by their elements, so that
+// aliases like `grafonnet-v9` don't keep `grafonnet` around and vice versa.
 func known(deps map[string]deps.Dependency, p string) bool {
 	p = filepath.ToSlash(p)
 	for _, d := range deps {
 		k := filepath.ToSlash(d.Name())
-		if strings.HasPrefix(p, k) || strings.HasPrefix(k, p) {
+		if p == k || strings.HasPrefix(p, k+"/") || strings.HasPrefix(k, p+"/") {
 			return true
 		}
 	}
 	return false
 }
 
-func ensure(direct map[string]deps.Dependency, vendorDir, pathToParentModule string, locks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+func (in *Installer) ensure(direct map[string]deps.Dependency, pathToParentModule string, locks map[string]deps.Dependency, replace []deps.Replace) (map[string]deps.Dependency, error) {
+	vendorDir := in.vendorDir
 	deps := make(map[string]deps.Dependency)
 
+	var todo []retrieval
+
 	for _, d := range direct {
+		d = replaced(d, replace)
+		requested := d.Version
 		l, present := locks[d.Name()]
 
+		if present && !hashSupported(l) {
+			return nil, fmt.Errorf("unsupported hash algorithm `%s` in the lock of %s, update jb", l.HashAlgorithm, d.Name())
+		}
+
+		// the replacement changed since locking, the lock no longer applies
+		if present && !reflect.DeepEqual(l.ReplacedBy, d.ReplacedBy) {
+			present = false
+		}
+
+		// the jsonnetfile asks for a different version than the locked one.
+		// Nested dependencies are resolved against the locks of the current
+		// run as well, which is why this only applies to direct ones.
+		if present && pathToParentModule == "" && l.Requested != "" && l.Requested != requested {
+			present = false
+		}
+
+		// submodules or LFS were toggled since locking, which changes the
+		// contents. Install the locked version again, with a new sum.
+		if present && gitExtrasChanged(l, d) {
+			d.Version = l.Version
+			present = false
+		}
+
+		// the same goes for changed include or exclude patterns
+		if present && filtersChanged(l, d) {
+			d.Version = l.Version
+			present = false
+		}
+
+		// local dependencies switched between being linked and copied
+		if present && linked(l) != linked(d) {
+			present = false
+		}
+
+		var expectedSum string
+
 		// already locked and the integrity is intact
 		if present {
-			d.Version = locks[d.Name()].Version
-
-			if check(l, vendorDir) {
+			d.Version = l.Version
+
+			// pruned packages are installed completely unless pruning
+			if check(l, vendorDir) && (l.PrunedFrom == "" || in.prune) {
+				// lockfiles before version 2 did not record it
+				if l.Requested == "" {
+					l.Requested = requested
+				}
+				l.ExcludeDependencies = d.ExcludeDependencies
+				in.checkLocalCopy(l, pathToParentModule)
 				deps[d.Name()] = l
+				in.env.emit(Event{Type: EventResult, Package: d.Name(), Version: l.Version, Sum: l.Sum})
 				continue
 			}
+			expectedSum = l.Sum
+			if l.PrunedFrom != "" {
+				expectedSum = l.PrunedFrom
+			}
 		}
-		expectedSum := locks[d.Name()].Sum
 
 		// either not present or not intact: download again
-		dir := filepath.Join(vendorDir, d.Name())
-		os.RemoveAll(dir)
+		todo = append(todo, retrieval{dep: d, requested: requested, expectedSum: expectedSum})
+	}
 
-		locked, err := download(d, vendorDir, pathToParentModule)
-		if err != nil {
-			return nil, errors.Wrap(err, "downloading")
-		}
-		if expectedSum != "" && locked.Sum != expectedSum {
-			return nil, fmt.Errorf("checksum mismatch for %s. Expected %s but got %s", d.Name(), expectedSum, locked.Sum)
+	downloaded, err := in.downloadAll(todo, pathToParentModule)
+	if err != nil {
+		return nil, errors.Wrap(err, "downloading")
+	}
+
+	for i, r := range todo {
+		locked := downloaded[i]
+		locked.Requested = r.requested
+		if r.expectedSum != "" && locked.Sum != r.expectedSum {
+			return nil, fmt.Errorf("checksum mismatch for %s. Expected %s but got %s", locked.Name(), r.expectedSum, locked.Sum)
 		}
-		deps[d.Name()] = *locked
+		deps[locked.Name()] = *locked
+		in.env.emit(Event{Type: EventResult, Package: locked.Name(), Version: locked.Version, Sum: locked.Sum, Installed: true})
 		// we settled on a new version, add it to the locks for recursion
-		locks[d.Name()] = *locked
+		locks[locked.Name()] = *locked
 	}
 
 	for _, d := range deps {
@@ -249,7 +370,7 @@ func ensure(direct map[string]deps.Dependency, vendorDir, pathToParentModule str
 			continue
 		}
 
-		f, err := jsonnetfile.Load(filepath.Join(vendorDir, d.Name(), jsonnetfile.File))
+		f, err := in.loadPackage(d.Name(), filepath.Join(vendorDir, d.Name(), jsonnetfile.File))
 		if err != nil {
 			if os.IsNotExist(err) {
 				continue
@@ -257,12 +378,20 @@ func ensure(direct map[string]deps.Dependency, vendorDir, pathToParentModule str
 			return nil, err
 		}
 
+		for _, name := range d.ExcludeDependencies {
+			delete(f.Dependencies, name)
+		}
+
 		absolutePath, err := filepath.EvalSymlinks(filepath.Join(vendorDir, d.Name()))
 		if err != nil {
 			return nil, err
 		}
+		// relative paths of copies are relative to the original directory
+		if d.FetchSource().LocalSource.Copied() {
+			absolutePath = in.localDir(d, pathToParentModule)
+		}
 
-		nested, err := ensure(f.Dependencies, vendorDir, absolutePath, locks)
+		nested, err := in.ensure(f.Dependencies, absolutePath, locks, replace)
 		if err != nil {
 			return nil, err
 		}
@@ -277,61 +406,209 @@ func ensure(direct map[string]deps.Dependency, vendorDir, pathToParentModule str
 	return deps, nil
 }
 
+// checkLocalCopy warns if the directory of the copied local dependency l
+// changed since it was copied to vendor, either by moving to a different
+// commit or by editing its files. Installing it again would fail on the sum,
+// so it has to be updated.
+func (in *Installer) checkLocalCopy(l deps.Dependency, pathToParentModule string) {
+	if !l.FetchSource().LocalSource.Copied() {
+		return
+	}
+	dir := in.localDir(l, pathToParentModule)
+
+	if commit := localCommit(dir); l.Version != "" && commit != "" && commit != l.Version {
+		in.env.emit(Event{Type: EventWarn, Package: l.Name(), Message: fmt.Sprintf("%s was copied at commit %s, but its directory is at %s now. Run `jb update %s` to copy it again", l.Name(), l.Version, commit, l.Name())})
+		return
+	}
+
+	// the lock holds the sum after pruning, if any
+	want := l.Sum
+	if l.PrunedFrom != "" {
+		want = l.PrunedFrom
+	}
+
+	// a directory that is gone is only needed when copying again
+	sum, err := localSum(dir, l.Include, l.Exclude)
+	if err != nil || sum == want {
+		return
+	}
+	in.env.emit(Event{Type: EventWarn, Package: l.Name(), Message: fmt.Sprintf("the files of %s changed since it was copied. Run `jb update %s` to copy it again", l.Name(), l.Name())})
+}
+
+// hashSupported returns whether the sums of the lock can be verified
+func hashSupported(l deps.Dependency) bool {
+	return l.HashAlgorithm == "" || l.HashAlgorithm == deps.HashSHA256
+}
+
+// gitExtrasChanged returns whether the git sources of the locked and the
+// requested dependency differ in the files they materialize
+func gitExtrasChanged(l, d deps.Dependency) bool {
+	lg, dg := l.FetchSource().GitSource, d.FetchSource().GitSource
+	if lg == nil || dg == nil {
+		return false
+	}
+	return lg.Submodules != dg.Submodules || lg.LFS != dg.LFS
+}
+
+// replaced applies the first matching replace directive to d. Only the
+// directives of the top-level jsonnetfile are considered, but they apply to
+// direct and nested dependencies alike.
+func replaced(d deps.Dependency, replace []deps.Replace) deps.Dependency {
+	for _, r := range replace {
+		if r.Matches(d) {
+			return r.Apply(d)
+		}
+	}
+	return d
+}
+
+// localDir returns the directory of the local dependency d, declared by the
+// module at pathToParentModule. When a local dependency tree is resolved
+// recursively, nested local dependencies with relative paths must be
+// evaluated relative to their referencing jsonnetfile, rather than relative
+// to the top-level jsonnetfile.
+func (in *Installer) localDir(d deps.Dependency, pathToParentModule string) string {
+	if d.ReplacedBy != nil || pathToParentModule == "" {
+		// direct dependencies and replacements are declared in the
+		// top-level jsonnetfile, so relative local paths are relative to it
+		pathToParentModule = in.rootDir
+	}
+
+	dir := d.FetchSource().LocalSource.Directory
+	if !filepath.IsAbs(dir) {
+		dir = filepath.Join(pathToParentModule, dir)
+	}
+	return dir
+}
+
 // download retrieves a package from a remote upstream. The checksum of the
 // files is generated afterwards.
-func download(d deps.Dependency, vendorDir, pathToParentModule string) (*deps.Dependency, error) {
+func (in *Installer) download(d deps.Dependency, pathToParentModule string) (*deps.Dependency, error) {
+	vendorDir := in.vendorDir
+	src := d.FetchSource()
+
 	var p Interface
 	switch {
-	case d.Source.GitSource != nil:
-		p = NewGitPackage(d.Source.GitSource)
-	case d.Source.LocalSource != nil:
-		wd, err := os.Getwd()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get current working directory: %w", err)
-		}
-
-		// Resolve the relative path to the parent module. When a local
-		// dependency tree is resolved recursively, nested local dependencies
-		// with relative paths must be evaluated relative to their referencing
-		// jsonnetfile, rather than relative to the top-level jsonnetfile.
-		modulePath, err := filepath.Rel(wd, filepath.Join(pathToParentModule, d.Source.LocalSource.Directory))
-		if err != nil {
-			modulePath = d.Source.LocalSource.Directory
-		}
-
-		p = NewLocalPackage(&deps.Local{Directory: modulePath})
-	case d.Source.HttpSource != nil:
-		p = NewHttpPackage(d.Source.HttpSource)
-	case d.Source.GitlabRegistrySource != nil:
-		p = NewGitlabRegistryPackage(d.Source.GitlabRegistrySource)
+	case src.GitSource != nil:
+		p = proxied(src.GitSource, in.proxy, in.mirrors, in.backend, in.env)
+	case src.LocalSource != nil:
+		modulePath := in.localDir(d, pathToParentModule)
+		p = &LocalPackage{Source: &deps.Local{Directory: modulePath, Mode: src.LocalSource.Mode}, Env: in.env}
+	case src.HttpSource != nil:
+		p = &HttpPackage{Source: src.HttpSource, Env: in.env}
+	case src.GitlabRegistrySource != nil:
+		p = &GitlabRegistryPackage{Source: src.GitlabRegistrySource, Env: in.env}
 	}
 
 	if p == nil {
 		return nil, errors.New("either git, local, http or gitlab source is required")
 	}
+	if linked(d) && filtered(d) {
+		return nil, fmt.Errorf("%s: include and exclude are not supported for linked local dependencies, use mode `copy`", d.Name())
+	}
 
 	version, err := p.Install(context.TODO(), d.Name(), vendorDir, d.Version)
 	if err != nil {
 		return nil, err
 	}
 
+	if filtered(d) {
+		if err := filter(filepath.Join(vendorDir, d.Name()), d.Include, d.Exclude); err != nil {
+			return nil, errors.Wrapf(err, "filtering %s", d.Name())
+		}
+	}
+
 	var sum string
-	if d.Source.LocalSource == nil {
+	if !linked(d) {
 		sum = hashDir(filepath.Join(vendorDir, d.Name()))
 	}
 
+	var resolved Resolved
+	if r, ok := p.(Resolver); ok {
+		resolved = r.Resolved()
+	}
+
 	d.Version = version
 	d.Sum = sum
+	d.Tag = resolved.Tag
+	d.ArchiveDigest = resolved.ArchiveDigest
+	d.HashAlgorithm = ""
+	if sum != "" || resolved.ArchiveDigest != "" {
+		d.HashAlgorithm = deps.HashSHA256
+	}
 	return &d, nil
 }
 
+// loadPackage loads the jsonnetfile.json of the package name at path, warning
+// about fields that are not part of the format once
+func (in *Installer) loadPackage(name, path string) (v1.JsonnetFile, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return v1.New(), err
+	}
+
+	if !in.warned[path] {
+		in.warned[path] = true
+		// broken files are reported by Unmarshal below
+		unknown, _ := jsonnetfile.UnknownFields(path, data)
+		for _, u := range unknown {
+			in.env.emit(Event{Type: EventWarn, Package: name, Message: u.String()})
+		}
+	}
+
+	return jsonnetfile.Unmarshal(data)
+}
+
+// recordParents sets the Parents of all locks to the packages whose
+// jsonnetfile requires them, `.` being the project itself
+func recordParents(direct v1.JsonnetFile, vendorDir string, locks map[string]deps.Dependency) error {
+	parents := make(map[string][]string)
+	for name := range direct.Dependencies {
+		parents[name] = append(parents[name], ".")
+	}
+
+	for name, l := range locks {
+		if l.Single {
+			continue
+		}
+
+		f, err := jsonnetfile.Load(filepath.Join(vendorDir, name, jsonnetfile.File))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		for _, nested := range l.ExcludeDependencies {
+			delete(f.Dependencies, nested)
+		}
+		for nested := range f.Dependencies {
+			parents[nested] = append(parents[nested], name)
+		}
+	}
+
+	for name, l := range locks {
+		l.Parents = parents[name]
+		sort.Strings(l.Parents)
+		locks[name] = l
+	}
+	return nil
+}
+
+// linked returns whether d is a local dependency symlinked into vendor
+func linked(d deps.Dependency) bool {
+	src := d.FetchSource().LocalSource
+	return src != nil && !src.Copied()
+}
+
 // check returns whether the files present at the vendor/ folder match the
-// sha256 sum of the package. local-directory dependencies are not checked as
-// their purpose is to change during development where integrity checking would
-// be a hindrance.
+// sha256 sum of the package. Linked local-directory dependencies are not
+// checked as their purpose is to change during development where integrity
+// checking would be a hindrance.
 func check(d deps.Dependency, vendorDir string) bool {
-	// assume a local dependency is intact as long as it exists
-	if d.Source.LocalSource != nil {
+	// assume a linked dependency is intact as long as it exists
+	if linked(d) {
 		x, err := jsonnetfile.Exists(filepath.Join(vendorDir, d.Name()))
 		if err != nil {
 			return false
@@ -353,6 +630,12 @@ func check(d deps.Dependency, vendorDir string) bool {
 // hashing this data using sha256. This can be memory heavy with lots of data,
 // but jsonnet files should be fairly small
 func hashDir(dir string) string {
+	return hashDirSkip(dir, nil)
+}
+
+// hashDirSkip is hashDir leaving out the files and directories skip returns
+// true for, like copyDirSkip does
+func hashDirSkip(dir string, skip func(rel string, info os.FileInfo) bool) string {
 	hasher := sha256.New()
 
 	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
@@ -360,6 +643,19 @@ func hashDir(dir string) string {
 			return err
 		}
 
+		if skip != nil && path != dir {
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			if skip(rel, info) {
+				if info.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+		}
+
 		if info.IsDir() {
 			return nil
 		}
@@ -15,8 +15,15 @@
 package pkg
 
 import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
@@ -31,6 +38,15 @@ func TestKnown(t *testing.T) {
 				Subdir: "/ksonnet.beta.4",
 			}},
 		},
+		"grafonnet-v9": deps.Dependency{
+			Alias: "grafonnet-v9",
+			Source: deps.Source{GitSource: &deps.Git{
+				Scheme: deps.GitSchemeHTTPS,
+				Host:   "github.com",
+				User:   "grafana",
+				Repo:   "grafonnet",
+			}},
+		},
 	}
 
 	paths := []string{
@@ -41,6 +57,10 @@ func TestKnown(t *testing.T) {
 		"github.com/ksonnet/ksonnet-lib/ksonnet.beta.4/k.libsonnet",
 		"github.com/ksonnet-util", // don't know that one
 		"ksonnet.beta.4",          // the symlink
+		"grafonnet-v9",
+		"grafonnet-v9/main.libsonnet",
+		"grafonnet",                    // only known under its alias
+		"github.com/grafana/grafonnet", // same
 	}
 
 	want := []string{
@@ -50,6 +70,8 @@ func TestKnown(t *testing.T) {
 		"github.com/ksonnet/ksonnet-lib",
 		"github.com/ksonnet/ksonnet-lib/ksonnet.beta.4",
 		"github.com/ksonnet/ksonnet-lib/ksonnet.beta.4/k.libsonnet",
+		"grafonnet-v9",
+		"grafonnet-v9/main.libsonnet",
 	}
 
 	w := make(map[string]bool)
@@ -93,3 +115,239 @@ func TestCleanLegacyName(t *testing.T) {
 		}
 	}
 }
+
+func TestReplaced(t *testing.T) {
+	upstream := deps.Dependency{
+		Version: "v1",
+		Source: deps.Source{GitSource: &deps.Git{
+			Scheme: deps.GitSchemeHTTPS,
+			Host:   "github.com",
+			User:   "grafana",
+			Repo:   "jsonnet-libs",
+			Subdir: "/grafana-builder",
+		}},
+	}
+	fork := deps.Source{GitSource: &deps.Git{
+		Scheme: deps.GitSchemeHTTPS,
+		Host:   "github.com",
+		User:   "fork",
+		Repo:   "jsonnet-libs",
+		Subdir: "/grafana-builder",
+	}}
+
+	cases := []struct {
+		name        string
+		replace     deps.Replace
+		wantVersion string
+		wantFork    bool
+	}{
+		{
+			name:        "any-version",
+			replace:     deps.Replace{Name: upstream.Name(), With: deps.Dependency{Source: fork}},
+			wantVersion: "v1",
+			wantFork:    true,
+		},
+		{
+			name:        "new-version",
+			replace:     deps.Replace{Name: upstream.Name(), With: deps.Dependency{Source: fork, Version: "fix"}},
+			wantVersion: "fix",
+			wantFork:    true,
+		},
+		{
+			name:        "other-version",
+			replace:     deps.Replace{Name: upstream.Name(), Version: "v2", With: deps.Dependency{Source: fork}},
+			wantVersion: "v1",
+			wantFork:    false,
+		},
+		{
+			name:        "other-name",
+			replace:     deps.Replace{Name: "github.com/grafana/jsonnet-libs", With: deps.Dependency{Source: fork}},
+			wantVersion: "v1",
+			wantFork:    false,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := replaced(upstream, []deps.Replace{c.replace})
+
+			if got.Name() != upstream.Name() {
+				t.Fatalf("expected name to stay %s, got %s", upstream.Name(), got.Name())
+			}
+			if got.Version != c.wantVersion {
+				t.Fatalf("expected version %s, got %s", c.wantVersion, got.Version)
+			}
+			if isFork := got.FetchSource().GitSource.User == "fork"; isFork != c.wantFork {
+				t.Fatalf("expected fetching from fork to be %v", c.wantFork)
+			}
+		})
+	}
+
+	// aliased dependencies are matched by the name of the package and by their alias
+	aliased := upstream
+	aliased.Alias = "grafana-builder-v1"
+	for _, name := range []string{upstream.Name(), aliased.Alias} {
+		got := replaced(aliased, []deps.Replace{{Name: name, With: deps.Dependency{Source: fork}}})
+		assert.Equal(t, aliased.Name(), got.Name(), name)
+		assert.Equal(t, "fork", got.FetchSource().GitSource.User, name)
+	}
+}
+
+func TestEnsureLockResolution(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-ensure")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, commit := testGitRepo(t, tmp)
+
+	d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v1")
+	require.NoError(t, err)
+
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = *d
+
+	vendorDir := filepath.Join(tmp, "vendor")
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+	locks, err := Ensure(jf, vendorDir, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	l := locks[d.Name()]
+	assert.Equal(t, commit, l.Version)
+	assert.Equal(t, "v1", l.Requested)
+	assert.Equal(t, "v1", l.Tag)
+	assert.Equal(t, deps.HashSHA256, l.HashAlgorithm)
+	assert.NotEmpty(t, l.Sum)
+	assert.Equal(t, []string{"."}, l.Parents)
+
+	// requesting a different version in the jsonnetfile invalidates the lock
+	d.Version = commit
+	jf.Dependencies[d.Name()] = *d
+
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+	locks, err = Ensure(jf, vendorDir, locks)
+	require.NoError(t, err)
+
+	l = locks[d.Name()]
+	assert.Equal(t, commit, l.Version)
+	assert.Equal(t, commit, l.Requested)
+	assert.Equal(t, "v1", l.Tag)
+}
+
+func TestEnsureAlias(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-ensure")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, v1Commit := testGitRepo(t, tmp)
+
+	// a second version of the library, tagged as v2
+	work := filepath.Join(tmp, "work")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(work, "lib", "main.libsonnet"), []byte("{v2: true}"), 0644))
+	testGit(t, work, "commit", "-q", "-am", "v2")
+	testGit(t, work, "tag", "v2")
+	testGit(t, work, "push", "-q", "--tags", bare, "HEAD:master")
+
+	current, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v2")
+	require.NoError(t, err)
+	old, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v1")
+	require.NoError(t, err)
+	old.Alias = "lib-v1"
+
+	jf := v1.New()
+	jf.Dependencies[current.Name()] = *current
+	jf.Dependencies[old.Name()] = *old
+
+	vendorDir := filepath.Join(tmp, "vendor")
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+	locks, err := Ensure(jf, vendorDir, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	require.Len(t, locks, 2)
+	assert.Equal(t, v1Commit, locks["lib-v1"].Version)
+	assert.Equal(t, "lib-v1", locks["lib-v1"].Alias)
+	assert.Equal(t, "v2", locks[current.Name()].Tag)
+
+	b, err := ioutil.ReadFile(filepath.Join(vendorDir, "lib-v1", "main.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(b))
+
+	// the legacy name of the aliased package is the alias itself, so the
+	// legacy symlink belongs to the other one
+	b, err = ioutil.ReadFile(filepath.Join(vendorDir, "lib", "main.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{v2: true}", string(b))
+
+	// removing the alias cleans it up, but keeps the other version
+	delete(jf.Dependencies, old.Name())
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+	locks, err = Ensure(jf, vendorDir, locks)
+	require.NoError(t, err)
+
+	assert.Len(t, locks, 1)
+	_, err = os.Stat(filepath.Join(vendorDir, "lib-v1"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(vendorDir, current.Name(), "main.libsonnet"))
+	assert.NoError(t, err)
+}
+
+func TestEnsureLocalNestedAlias(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-ensure")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	writeFile(t, filepath.Join(tmp, "lib", "main.libsonnet"), "{}")
+
+	d := deps.Dependency{
+		Source: deps.Source{LocalSource: &deps.Local{Directory: "lib"}},
+		Alias:  "team/lib-v1",
+	}
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = d
+
+	in, err := NewInstaller(InstallerOptions{RootDir: tmp})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+	locks, err := in.Ensure(jf, map[string]deps.Dependency{})
+	require.NoError(t, err)
+	assert.Contains(t, locks, "team/lib-v1")
+
+	link := filepath.Join(tmp, "vendor", "team", "lib-v1")
+	target, err := os.Readlink(link)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join("..", "..", "lib"), target)
+
+	b, err := ioutil.ReadFile(filepath.Join(link, "main.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(b))
+}
+
+func TestRecordParentsIgnoresVendoredJsonnet(t *testing.T) {
+	vendorDir, err := ioutil.TempDir("", "jb-parents")
+	require.NoError(t, err)
+	defer os.RemoveAll(vendorDir)
+
+	parse := func(uri string) deps.Dependency {
+		d, err := deps.Parse("", uri)
+		require.NoError(t, err)
+		return *d
+	}
+	a, b, c := parse("github.com/foo/a"), parse("github.com/foo/b"), parse("github.com/foo/c")
+
+	// a package is described by its jsonnetfile.json, even if it comes with
+	// a jsonnetfile.jsonnet for its own development
+	writeFile(t, filepath.Join(vendorDir, a.Name(), "jsonnetfile.json"), `{"version": 1, "dependencies": [{"source": {"git": {"remote": "https://github.com/foo/b.git"}}, "version": "master"}]}`)
+	writeFile(t, filepath.Join(vendorDir, a.Name(), "jsonnetfile.jsonnet"), `{version: 1, dependencies: [{source: {git: {remote: 'https://github.com/foo/c.git'}}, version: 'master'}]}`)
+
+	locks := map[string]deps.Dependency{a.Name(): a, b.Name(): b, c.Name(): c}
+	direct := v1.New()
+	direct.Dependencies[a.Name()] = a
+	direct.Dependencies[c.Name()] = c
+	require.NoError(t, recordParents(direct, vendorDir, locks))
+
+	assert.Equal(t, []string{"."}, locks[a.Name()].Parents)
+	assert.Equal(t, []string{a.Name()}, locks[b.Name()].Parents)
+	assert.Equal(t, []string{"."}, locks[c.Name()].Parents)
+}
@@ -0,0 +1,166 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+
+	"golang.org/x/mod/semver"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// Plan resolves the dependencies like Ensure does, but leaves vendorDir
+// untouched. Remotes are still queried, and packages that are not installed at
+// their locked version are retrieved into a temporary directory, so that
+// their nested dependencies can be resolved as well.
+func Plan(direct v1.JsonnetFile, vendorDir string, oldLocks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	in, err := NewInstaller(InstallerOptions{VendorDir: vendorDir, Proxy: Proxy})
+	if err != nil {
+		return nil, err
+	}
+	return in.Plan(direct, oldLocks)
+}
+
+// Plan works like the package level Plan, leaving the vendor directory of the
+// Installer untouched. Events about the temporary directory, like cleaning
+// it, are not passed on to the Observer.
+func (in *Installer) Plan(direct v1.JsonnetFile, oldLocks map[string]deps.Dependency) (map[string]deps.Dependency, error) {
+	vendorDir := in.vendorDir
+
+	scratch, err := ioutil.TempDir("", "jb-plan")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(scratch)
+
+	// intact packages are copied instead of retrieved again. Linked local
+	// ones are symlinks relative to the vendor directory, which are cheap to
+	// create.
+	locks := make(map[string]deps.Dependency, len(oldLocks))
+	for name, l := range oldLocks {
+		locks[name] = l
+		if linked(l) || !check(l, vendorDir) {
+			continue
+		}
+		if err := copyDir(filepath.Join(vendorDir, name), filepath.Join(scratch, name)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Join(scratch, ".tmp"), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	planner := *in
+	planner.vendorDir = scratch
+	planner.env.Observer = scratchObserver(in.env.Observer)
+
+	return planner.Ensure(direct, locks)
+}
+
+// scratchObserver passes the events of o on, except for those about a
+// temporary vendor directory
+func scratchObserver(o Observer) Observer {
+	if o == nil {
+		return nil
+	}
+	return ObserverFunc(func(e Event) {
+		if e.Type != EventClean && e.Type != EventLink && e.Type != EventCopy {
+			o.Observe(e)
+		}
+	})
+}
+
+const (
+	ChangeAdd       = "add"
+	ChangeRemove    = "remove"
+	ChangeUpgrade   = "upgrade"
+	ChangeDowngrade = "downgrade"
+	// ChangeUpdate is a different version or contents of a package, which
+	// can't be told apart into an upgrade or downgrade
+	ChangeUpdate = "update"
+)
+
+// Change describes how a package differs between two sets of locks
+type Change struct {
+	Name   string `json:"name"`
+	Action string `json:"action"`
+
+	// Old is nil for added packages, New for removed ones
+	Old *deps.Dependency `json:"old,omitempty"`
+	New *deps.Dependency `json:"new,omitempty"`
+}
+
+// CompareLocks returns the changes to the installed packages when going from
+// the old to the new locks, sorted by name. Changes to fields not affecting
+// the vendored files, like the parents, are not considered.
+func CompareLocks(old, new map[string]deps.Dependency) []Change {
+	var changes []Change
+	for name, n := range new {
+		n := n
+		o, ok := old[name]
+		switch {
+		case !ok:
+			changes = append(changes, Change{Name: name, Action: ChangeAdd, New: &n})
+		case o.Version != n.Version || o.Sum != n.Sum || !reflect.DeepEqual(o.FetchSource(), n.FetchSource()):
+			changes = append(changes, Change{Name: name, Action: direction(o, n), Old: &o, New: &n})
+		}
+	}
+
+	for name, o := range old {
+		o := o
+		if _, ok := new[name]; !ok {
+			changes = append(changes, Change{Name: name, Action: ChangeRemove, Old: &o})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Name < changes[j].Name
+	})
+	return changes
+}
+
+// direction tells upgrades and downgrades apart using the semantic versions
+// of the tags, if both have one
+func direction(old, new deps.Dependency) string {
+	o, n := semverOf(old), semverOf(new)
+	if !semver.IsValid(o) || !semver.IsValid(n) {
+		return ChangeUpdate
+	}
+
+	switch semver.Compare(o, n) {
+	case -1:
+		return ChangeUpgrade
+	case 1:
+		return ChangeDowngrade
+	default:
+		return ChangeUpdate
+	}
+}
+
+func semverOf(d deps.Dependency) string {
+	for _, v := range []string{d.Tag, d.Version} {
+		if semver.IsValid(v) {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,154 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestCompareLocks(t *testing.T) {
+	lock := func(repo, version, tag string) deps.Dependency {
+		return deps.Dependency{
+			Source: deps.Source{GitSource: &deps.Git{
+				Scheme: deps.GitSchemeHTTPS,
+				Host:   "github.com",
+				User:   "example",
+				Repo:   repo,
+			}},
+			Version: version,
+			Tag:     tag,
+		}
+	}
+	locks := func(ds ...deps.Dependency) map[string]deps.Dependency {
+		m := make(map[string]deps.Dependency)
+		for _, d := range ds {
+			m[d.Name()] = d
+		}
+		return m
+	}
+	withParents := func(d deps.Dependency) deps.Dependency {
+		d.Parents = []string{"."}
+		return d
+	}
+
+	tests := []struct {
+		name     string
+		old, new map[string]deps.Dependency
+		want     map[string]string
+	}{
+		{
+			name: "unchanged",
+			old:  locks(lock("a", "1", "")),
+			new:  locks(withParents(lock("a", "1", ""))),
+			want: map[string]string{},
+		},
+		{
+			name: "added-removed",
+			old:  locks(lock("a", "1", "")),
+			new:  locks(lock("b", "1", "")),
+			want: map[string]string{"github.com/example/a": ChangeRemove, "github.com/example/b": ChangeAdd},
+		},
+		{
+			name: "upgrade",
+			old:  locks(lock("a", "1", "v1.0.0")),
+			new:  locks(lock("a", "2", "v1.1.0")),
+			want: map[string]string{"github.com/example/a": ChangeUpgrade},
+		},
+		{
+			name: "downgrade",
+			old:  locks(lock("a", "v2.0.0", "")),
+			new:  locks(lock("a", "v1.0.0", "")),
+			want: map[string]string{"github.com/example/a": ChangeDowngrade},
+		},
+		{
+			name: "commits",
+			old:  locks(lock("a", "1", "")),
+			new:  locks(lock("a", "2", "")),
+			want: map[string]string{"github.com/example/a": ChangeUpdate},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			changes := CompareLocks(tc.old, tc.new)
+
+			got := make(map[string]string)
+			for i, c := range changes {
+				got[c.Name] = c.Action
+				if i > 0 {
+					assert.True(t, changes[i-1].Name < c.Name, "changes are sorted")
+				}
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-plan-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, v1Commit := testGitRepo(t, tmp)
+
+	work := filepath.Join(tmp, "work")
+	require.NoError(t, ioutil.WriteFile(filepath.Join(work, "lib", "main.libsonnet"), []byte("{v2: true}"), 0644))
+	testGit(t, work, "commit", "-q", "-am", "v2")
+	testGit(t, work, "tag", "v2")
+	testGit(t, work, "push", "-q", "--tags", bare, "HEAD:master")
+
+	d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v1")
+	require.NoError(t, err)
+
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = *d
+
+	vendorDir := filepath.Join(tmp, "vendor")
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+	installed, err := Ensure(jf, vendorDir, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	// nothing changes
+	planned, err := Plan(jf, vendorDir, installed)
+	require.NoError(t, err)
+	assert.Empty(t, CompareLocks(installed, planned))
+
+	// requesting v2 updates the package, but only in the plan
+	d.Version = "v2"
+	jf.Dependencies[d.Name()] = *d
+
+	planned, err = Plan(jf, vendorDir, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	changes := CompareLocks(installed, planned)
+	require.Len(t, changes, 1)
+	assert.Equal(t, ChangeUpgrade, changes[0].Action)
+	assert.Equal(t, v1Commit, changes[0].Old.Version)
+	assert.Equal(t, "v2", changes[0].New.Tag)
+
+	b, err := ioutil.ReadFile(filepath.Join(vendorDir, d.Name(), "main.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(b))
+}
@@ -0,0 +1,248 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// Proxy is a comma separated list of package proxies git sources are retrieved
+// from, e.g. `https://jb-proxy.example.com,direct`. They are tried in order,
+// the special entry `direct` retrieves the package from its upstream
+// repository. An empty value or `off` always uses the upstream.
+//
+// A proxy serves the following endpoints, where <name> is the package name as
+// returned by deps.Dependency.Name() and <version> is path-escaped:
+//
+//	GET <proxy>/<name>/@v/list                    known versions, one per line
+//	GET <proxy>/<name>/@v/<version>.info          resolved version and sum as json
+//	GET <proxy>/<name>/@v/<version>.tar.gz        gzipped tarball of the package
+//	GET <proxy>/<name>/@v/<version>.jsonnetfile   jsonnetfile.json of the package
+//
+// Every request carries the `remote` and `subdir` query parameters of the git
+// source, so that a caching proxy can fetch packages it does not know yet.
+var Proxy = ""
+
+const proxyDirect = "direct"
+
+// ProxyInfo is the response of the `.info` endpoint
+type ProxyInfo struct {
+	// Version is the resolved version, a commit sha for git sources
+	Version string `json:"version"`
+	// Sum is the checksum of the package contents, as stored in the lockfile
+	Sum string `json:"sum"`
+	// Tag points at the resolved commit, if there is any
+	Tag string `json:"tag,omitempty"`
+}
+
+// ProxyPackage retrieves git packages from a package proxy
+type ProxyPackage struct {
+	URL    string
+	Source *deps.Git
+
+	Env
+
+	resolved Resolved
+}
+
+func NewProxyPackage(proxyURL string, source *deps.Git) *ProxyPackage {
+	return &ProxyPackage{
+		URL:    strings.TrimSuffix(proxyURL, "/"),
+		Source: source,
+	}
+}
+
+// proxied wraps the git package in the proxies, if any. See Proxy for the
+// format of proxies.
+func proxied(source *deps.Git, proxies string, mirrors map[string]string, backend GitBackend, env Env) Interface {
+	git := &GitPackage{Source: source, Backend: backend, Remote: mirrored(source.Remote(), mirrors), Env: env}
+
+	// repositories on the local disk are never proxied, neither are
+	// submodules and LFS files served by proxies
+	if source.Scheme == deps.GitSchemeFile || source.Submodules || source.LFS {
+		return git
+	}
+
+	var chain []Interface
+	for _, u := range strings.Split(proxies, ",") {
+		switch u = strings.TrimSpace(u); u {
+		case "", "off":
+			continue
+		case proxyDirect:
+			chain = append(chain, git)
+		default:
+			p := NewProxyPackage(u, source)
+			p.Env = env
+			chain = append(chain, p)
+		}
+	}
+
+	if len(chain) == 0 {
+		return git
+	}
+	return &proxyChain{entries: chain, env: env}
+}
+
+// mirrored replaces the longest prefix of remote found in mirrors by its
+// value. An empty string is returned if there is none.
+func mirrored(remote string, mirrors map[string]string) string {
+	var prefix string
+	for p := range mirrors {
+		if strings.HasPrefix(remote, p) && len(p) > len(prefix) {
+			prefix = p
+		}
+	}
+	if prefix == "" {
+		return ""
+	}
+	return mirrors[prefix] + strings.TrimPrefix(remote, prefix)
+}
+
+// proxyChain tries to install from each entry in order, until one succeeds
+type proxyChain struct {
+	entries []Interface
+	env     Env
+
+	// used is the entry the package was installed from
+	used Interface
+}
+
+func (c *proxyChain) Install(ctx context.Context, name, dir, version string) (string, error) {
+	var err error
+	for i, p := range c.entries {
+		var v string
+		v, err = p.Install(ctx, name, dir, version)
+		if err == nil {
+			c.used = p
+			return v, nil
+		}
+
+		if i < len(c.entries)-1 {
+			c.env.emit(Event{Type: EventWarn, Package: name, Message: fmt.Sprintf("%s, trying next proxy", err)})
+			if err := os.RemoveAll(filepath.Join(dir, name)); err != nil {
+				return "", err
+			}
+		}
+	}
+	return "", err
+}
+
+func (c *proxyChain) Resolved() Resolved {
+	if r, ok := c.used.(Resolver); ok {
+		return r.Resolved()
+	}
+	return Resolved{}
+}
+
+func (p *ProxyPackage) endpoint(name, file string) string {
+	q := url.Values{}
+	q.Set("remote", p.Source.Remote())
+	q.Set("subdir", strings.TrimPrefix(p.Source.Subdir, "/"))
+	return fmt.Sprintf("%s/%s/@v/%s?%s", p.URL, name, file, q.Encode())
+}
+
+func (p *ProxyPackage) get(ctx context.Context, name, file string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.endpoint(name, file), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := p.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("proxy %s: unexpected status code %d for %s", p.URL, resp.StatusCode, path.Join(name, "@v", file))
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// Info resolves version to an exact one
+func (p *ProxyPackage) Info(ctx context.Context, name, version string) (*ProxyInfo, error) {
+	b, err := p.get(ctx, name, url.PathEscape(version)+".info")
+	if err != nil {
+		return nil, err
+	}
+
+	var info ProxyInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, errors.Wrap(err, "decoding proxy info")
+	}
+	return &info, nil
+}
+
+func (p *ProxyPackage) Resolved() Resolved {
+	return p.resolved
+}
+
+func (p *ProxyPackage) Install(ctx context.Context, name, dir, version string) (string, error) {
+	destPath := filepath.Join(dir, name)
+
+	// the proxy knows packages by their source, name might be an alias
+	name = p.Source.Name()
+
+	info, err := p.Info(ctx, name, version)
+	if err != nil {
+		return "", err
+	}
+
+	tmpDir, err := CreateTempDir(name, dir, info.Version)
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	archive := filepath.Join(tmpDir, "package.tar.gz")
+	if err := p.downloadFile(ctx, archive, p.endpoint(name, url.PathEscape(info.Version)+".tar.gz")); err != nil {
+		return "", errors.Wrap(err, "downloading from proxy")
+	}
+
+	ar, err := os.Open(archive)
+	if err != nil {
+		return "", err
+	}
+	defer ar.Close()
+
+	if err := GzipUntar(destPath, ar, ""); err != nil {
+		return "", errors.Wrap(err, "failed to unpack proxy archive")
+	}
+
+	if sum := hashDir(destPath); sum != info.Sum {
+		return "", fmt.Errorf("proxy %s returned a corrupt archive for %s. Expected sum %s but got %s", p.URL, name, info.Sum, sum)
+	}
+
+	digest, err := hashFile(archive)
+	if err != nil {
+		return "", err
+	}
+	p.resolved = Resolved{Tag: info.Tag, ArchiveDigest: digest}
+
+	return info.Version, nil
+}
@@ -0,0 +1,386 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+var commitShaRegex = regexp.MustCompile("^[0-9a-f]{40,}$")
+
+// DefaultCacheDir returns the directory jb caches downloaded data in
+func DefaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "jb")
+}
+
+// ProxyServerOptions configure a ProxyServer. Apart from CacheDir, the zero
+// value of every option is a usable default.
+type ProxyServerOptions struct {
+	// CacheDir holds the packages served
+	CacheDir string
+
+	// HTTPClient performs the requests for archives. Defaults to
+	// http.DefaultClient.
+	HTTPClient *http.Client
+	// GitBackend performs the git operations. Defaults to DefaultGitBackend.
+	GitBackend GitBackend
+	// Logger receives the output of git. It is discarded if nil.
+	Logger io.Writer
+
+	// Allow restricts the remotes packages are fetched from. Entries are
+	// either hosts, e.g. `github.com`, or prefixes of remotes, e.g.
+	// `https://github.com/grafana/`. Any https or ssh remote is allowed if
+	// empty.
+	Allow []string
+}
+
+// ProxyServer implements the package proxy protocol described at Proxy. It
+// is backed by a cache directory: packages are fetched from upstream once and
+// served from the cache afterwards.
+type ProxyServer struct {
+	cacheDir string
+	backend  GitBackend
+	allow    []string
+
+	env Env
+
+	// fetching the same package concurrently would race on the cache
+	mu sync.Mutex
+}
+
+// NewProxyServer returns a ProxyServer using opts, filling in the defaults
+func NewProxyServer(opts ProxyServerOptions) *ProxyServer {
+	backend := opts.GitBackend
+	if backend == nil {
+		backend = DefaultGitBackend
+	}
+
+	return &ProxyServer{
+		cacheDir: opts.CacheDir,
+		backend:  backend,
+		allow:    opts.Allow,
+		env: Env{
+			Client: opts.HTTPClient,
+			Logger: opts.Logger,
+		},
+	}
+}
+
+type proxyError struct {
+	code int
+	err  error
+}
+
+func (e *proxyError) Error() string {
+	return e.err.Error()
+}
+
+func (s *ProxyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := s.serve(w, r); err != nil {
+		code := http.StatusInternalServerError
+		if perr, ok := err.(*proxyError); ok {
+			code = perr.code
+		}
+		http.Error(w, err.Error(), code)
+	}
+}
+
+func (s *ProxyServer) serve(w http.ResponseWriter, r *http.Request) error {
+	p := strings.TrimPrefix(r.URL.EscapedPath(), "/")
+	i := strings.LastIndex(p, "/@v/")
+	if i < 0 {
+		return &proxyError{http.StatusNotFound, errors.New("not found")}
+	}
+
+	name, err := url.PathUnescape(p[:i])
+	if err != nil {
+		return &proxyError{http.StatusBadRequest, err}
+	}
+	file, err := url.PathUnescape(p[i+len("/@v/"):])
+	if err != nil {
+		return &proxyError{http.StatusBadRequest, err}
+	}
+	if name == "" || strings.Contains(name, "..") || strings.Contains(name, `\`) {
+		return &proxyError{http.StatusBadRequest, fmt.Errorf("invalid package name `%s`", name)}
+	}
+
+	source, err := proxySource(name, r.URL.Query())
+	if err != nil {
+		return err
+	}
+	if source != nil && !s.allowed(source) {
+		return &proxyError{http.StatusForbidden, fmt.Errorf("remote `%s` is not allowed", source.Remote())}
+	}
+
+	if file == "list" {
+		versions, err := s.list(r.Context(), name, source)
+		if err != nil {
+			return err
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, err = fmt.Fprintln(w, strings.Join(versions, "\n"))
+		return err
+	}
+
+	var version, ext string
+	for _, e := range []string{".info", ".tar.gz", ".jsonnetfile"} {
+		if strings.HasSuffix(file, e) {
+			version, ext = strings.TrimSuffix(file, e), e
+			break
+		}
+	}
+	if version == "" {
+		return &proxyError{http.StatusNotFound, fmt.Errorf("unknown endpoint `%s`", file)}
+	}
+
+	info, err := s.fetch(r.Context(), name, version, source)
+	if err != nil {
+		return err
+	}
+
+	switch ext {
+	case ".info":
+		w.Header().Set("Content-Type", "application/json")
+		return json.NewEncoder(w).Encode(info)
+	case ".jsonnetfile":
+		f := s.path(name, info.Version+".jsonnetfile")
+		if _, err := os.Stat(f); os.IsNotExist(err) {
+			return &proxyError{http.StatusNotFound, fmt.Errorf("%s has no %s", name, jsonnetfile.File)}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		http.ServeFile(w, r, f)
+	default:
+		w.Header().Set("Content-Type", "application/gzip")
+		http.ServeFile(w, r, s.path(name, info.Version+".tar.gz"))
+	}
+	return nil
+}
+
+// proxySource builds the git source from the request parameters. Without
+// them, only packages already present in the cache can be served.
+func proxySource(name string, q url.Values) (*deps.Git, error) {
+	if q.Get("remote") == "" {
+		return nil, nil
+	}
+
+	d, err := deps.Parse("", q.Get("remote"))
+	if err != nil {
+		return nil, &proxyError{http.StatusBadRequest, err}
+	}
+	if d.Source.GitSource == nil {
+		return nil, &proxyError{http.StatusBadRequest, fmt.Errorf("`%s` is not a git remote", q.Get("remote"))}
+	}
+
+	// the server must not hand out repositories of its own filesystem
+	source := d.Source.GitSource
+	if source.Scheme != deps.GitSchemeHTTPS && source.Scheme != deps.GitSchemeSSH {
+		return nil, &proxyError{http.StatusBadRequest, fmt.Errorf("`%s` is not an https or ssh remote", q.Get("remote"))}
+	}
+	source.Subdir = ""
+	if subdir := strings.TrimPrefix(q.Get("subdir"), "/"); subdir != "" {
+		source.Subdir = "/" + subdir
+	}
+
+	if source.Name() != name {
+		return nil, &proxyError{http.StatusBadRequest, fmt.Errorf("source `%s` does not match package `%s`", source.Name(), name)}
+	}
+	return source, nil
+}
+
+// allowed returns whether packages may be fetched from source
+func (s *ProxyServer) allowed(source *deps.Git) bool {
+	if len(s.allow) == 0 {
+		return true
+	}
+
+	remote := source.Remote()
+	for _, a := range s.allow {
+		if strings.Contains(a, "/") {
+			if strings.HasPrefix(remote, a) {
+				return true
+			}
+			continue
+		}
+		if strings.EqualFold(source.Host, a) {
+			return true
+		}
+	}
+	return false
+}
+
+// path returns the location of a file of the package in the cache
+func (s *ProxyServer) path(name, file string) string {
+	return filepath.Join(s.cacheDir, "download", filepath.FromSlash(name), "@v", file)
+}
+
+func (s *ProxyServer) cached(name, version string) (*ProxyInfo, bool) {
+	b, err := ioutil.ReadFile(s.path(name, version+".info"))
+	if err != nil {
+		return nil, false
+	}
+
+	var info ProxyInfo
+	if err := json.Unmarshal(b, &info); err != nil {
+		return nil, false
+	}
+	return &info, true
+}
+
+// list returns all branches and tags of the upstream repository, or the
+// cached versions if upstream is not known
+func (s *ProxyServer) list(ctx context.Context, name string, source *deps.Git) ([]string, error) {
+	if source == nil {
+		infos, err := filepath.Glob(s.path(name, "*.info"))
+		if err != nil {
+			return nil, err
+		}
+
+		versions := make([]string, 0, len(infos))
+		for _, i := range infos {
+			versions = append(versions, strings.TrimSuffix(filepath.Base(i), ".info"))
+		}
+		return versions, nil
+	}
+
+	versions, err := s.backend.ListRefs(ctx, source.Remote())
+	if err != nil {
+		return nil, &proxyError{http.StatusBadGateway, errors.Wrap(err, "listing remote refs")}
+	}
+	return versions, nil
+}
+
+// fetch makes sure the package is present in the cache at the given version
+// and returns the resolved version. Commits are served straight from the
+// cache, refs are resolved against upstream first as they might have moved.
+func (s *ProxyServer) fetch(ctx context.Context, name, version string, source *deps.Git) (*ProxyInfo, error) {
+	if commitShaRegex.MatchString(version) {
+		if info, ok := s.cached(name, version); ok {
+			return info, nil
+		}
+	}
+
+	if source == nil {
+		return nil, &proxyError{http.StatusNotFound, fmt.Errorf("%s@%s is not cached and no remote was given", name, version)}
+	}
+
+	commit, err := s.backend.ResolveRef(ctx, source.Remote(), version)
+	if err == nil && commit != "" {
+		if info, ok := s.cached(name, commit); ok {
+			return info, nil
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Join(s.cacheDir, ".tmp"), os.ModePerm); err != nil {
+		return nil, err
+	}
+	work, err := CreateTempDir(name, s.cacheDir, version)
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(work)
+
+	if err := os.MkdirAll(filepath.Join(work, ".tmp"), os.ModePerm); err != nil {
+		return nil, err
+	}
+
+	gp := &GitPackage{Source: source, Backend: s.backend, Env: s.env}
+	resolved, err := gp.Install(ctx, name, work, version)
+	if err != nil {
+		return nil, &proxyError{http.StatusBadGateway, errors.Wrapf(err, "fetching %s@%s", name, version)}
+	}
+
+	info := ProxyInfo{Version: resolved, Tag: gp.Resolved().Tag}
+	if err := s.store(name, info, filepath.Join(work, name)); err != nil {
+		return nil, err
+	}
+
+	cached, _ := s.cached(name, resolved)
+	return cached, nil
+}
+
+// store adds the installed package at dir to the cache. The sum of info is
+// computed from dir.
+func (s *ProxyServer) store(name string, info ProxyInfo, dir string) error {
+	version := info.Version
+
+	if err := os.MkdirAll(s.path(name, ""), os.ModePerm); err != nil {
+		return err
+	}
+
+	// archive into a temporary file first, so that concurrent readers never
+	// see a partial archive
+	ar, err := ioutil.TempFile(s.path(name, ""), ".archive")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(ar.Name())
+
+	if err := GzipTar(ar, dir, "package"); err != nil {
+		ar.Close()
+		return errors.Wrap(err, "archiving package")
+	}
+	if err := ar.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(ar.Name(), s.path(name, version+".tar.gz")); err != nil {
+		return err
+	}
+
+	jf, err := ioutil.ReadFile(filepath.Join(dir, jsonnetfile.File))
+	switch {
+	case err == nil:
+		if err := ioutil.WriteFile(s.path(name, version+".jsonnetfile"), jf, 0644); err != nil {
+			return err
+		}
+	case !os.IsNotExist(err):
+		return err
+	}
+
+	// the info file marks the entry as complete, so it is written last
+	info.Sum = hashDir(dir)
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path(name, version+".info"), b, 0644)
+}
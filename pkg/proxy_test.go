@@ -0,0 +1,178 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestProxyInstallCached(t *testing.T) {
+	const commit = "54865853ebc1f901964e25a2e7a0e4d2cb6b9648"
+	source := &deps.Git{
+		Scheme: deps.GitSchemeHTTPS,
+		Host:   "github.com",
+		User:   "grafana",
+		Repo:   "jsonnet-libs",
+		Subdir: "/grafana-builder",
+	}
+
+	tmp, err := ioutil.TempDir("", "jb-proxy")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	// populate the cache of the proxy
+	pkgDir := filepath.Join(tmp, "pkg")
+	require.NoError(t, os.MkdirAll(filepath.Join(pkgDir, "lib"), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pkgDir, "lib", "main.libsonnet"), []byte("{}"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(pkgDir, "jsonnetfile.json"), []byte(`{"version": 1}`), 0644))
+
+	server := NewProxyServer(ProxyServerOptions{CacheDir: filepath.Join(tmp, "cache")})
+	require.NoError(t, server.store(source.Name(), ProxyInfo{Version: commit, Tag: "v1"}, pkgDir))
+
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+
+	vendorDir := filepath.Join(tmp, "vendor")
+	require.NoError(t, os.MkdirAll(filepath.Join(vendorDir, ".tmp"), os.ModePerm))
+
+	p := NewProxyPackage(ts.URL, source)
+	version, err := p.Install(context.TODO(), source.Name(), vendorDir, commit)
+	require.NoError(t, err)
+	assert.Equal(t, commit, version)
+	assert.Equal(t, "v1", p.Resolved().Tag)
+	assert.NotEmpty(t, p.Resolved().ArchiveDigest)
+
+	got, err := ioutil.ReadFile(filepath.Join(vendorDir, source.Name(), "lib", "main.libsonnet"))
+	require.NoError(t, err)
+	assert.Equal(t, "{}", string(got))
+	assert.Equal(t, hashDir(pkgDir), hashDir(filepath.Join(vendorDir, source.Name())))
+
+	jf, err := p.get(context.TODO(), source.Name(), commit+".jsonnetfile")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"version": 1}`, string(jf))
+
+	// without a remote, the cached versions are listed
+	versions, err := server.list(context.TODO(), source.Name(), nil)
+	require.NoError(t, err)
+	assert.Equal(t, []string{commit}, versions)
+}
+
+func TestProxyNotCached(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-proxy")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	ts := httptest.NewServer(NewProxyServer(ProxyServerOptions{CacheDir: tmp}))
+	defer ts.Close()
+
+	p := &ProxyPackage{URL: ts.URL, Source: &deps.Git{}}
+	_, err = p.get(context.TODO(), "github.com/foo/bar", "master.info")
+	assert.Error(t, err)
+}
+
+func TestProxyRejectsLocalRemotes(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-proxy")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	bare, _ := testGitRepo(t, tmp)
+	d, err := deps.Parse("", "file://"+filepath.ToSlash(bare))
+	require.NoError(t, err)
+
+	ts := httptest.NewServer(NewProxyServer(ProxyServerOptions{CacheDir: filepath.Join(tmp, "cache")}))
+	defer ts.Close()
+
+	q := url.Values{"remote": {"file://" + filepath.ToSlash(bare)}}
+	resp, err := http.Get(ts.URL + "/" + d.Name() + "/@v/v1.info?" + q.Encode())
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	_, err = os.Stat(filepath.Join(tmp, "cache", "download"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+// refsBackend lists fixed refs for any remote
+type refsBackend struct {
+	ExecGit
+	refs []string
+}
+
+func (b refsBackend) ListRefs(ctx context.Context, remote string) ([]string, error) {
+	return b.refs, nil
+}
+
+func TestProxyAllow(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-proxy")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	ts := httptest.NewServer(NewProxyServer(ProxyServerOptions{
+		CacheDir:   tmp,
+		GitBackend: refsBackend{refs: []string{"main", "v1"}},
+		Allow:      []string{"gitlab.com", "https://github.com/grafana/"},
+	}))
+	defer ts.Close()
+
+	list := func(remote string) (int, string) {
+		d, err := deps.Parse("", remote)
+		require.NoError(t, err)
+
+		q := url.Values{"remote": {remote}}
+		resp, err := http.Get(ts.URL + "/" + d.Name() + "/@v/list?" + q.Encode())
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := ioutil.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(b)
+	}
+
+	code, body := list("https://github.com/grafana/jsonnet-libs.git")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, "main\nv1\n", body)
+
+	code, _ = list("https://gitlab.com/foo/bar.git")
+	assert.Equal(t, http.StatusOK, code)
+
+	code, _ = list("https://github.com/ksonnet/ksonnet-lib.git")
+	assert.Equal(t, http.StatusForbidden, code)
+}
+
+func TestMirrored(t *testing.T) {
+	mirrors := map[string]string{
+		"https://github.com/":          "https://git.example.com/gh/",
+		"https://github.com/grafana/":  "https://grafana.example.com/",
+		"https://gitlab.com/unrelated": "https://example.com/",
+	}
+
+	assert.Equal(t, "https://git.example.com/gh/ksonnet/ksonnet-lib.git",
+		mirrored("https://github.com/ksonnet/ksonnet-lib.git", mirrors))
+	assert.Equal(t, "https://grafana.example.com/jsonnet-libs.git",
+		mirrored("https://github.com/grafana/jsonnet-libs.git", mirrors))
+	assert.Equal(t, "", mirrored("ssh://git@github.com/grafana/jsonnet-libs.git", mirrors))
+	assert.Equal(t, "", mirrored("https://github.com/foo.git", nil))
+}
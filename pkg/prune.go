@@ -0,0 +1,268 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+	"github.com/jsonnet-bundler/jsonnet-bundler/tool/rewrite"
+)
+
+// licenses are kept when pruning, regardless of whether they are imported
+var licenses = regexp.MustCompile(`(?i)^(licen[cs]e|notice|copying)([.\-_].*)?$`)
+
+// keep returns whether the file name is kept when pruning although it is not
+// imported. Besides licenses, these are the manifests jb reads the nested
+// dependencies from.
+func keep(name string) bool {
+	switch name {
+	case jsonnetfile.File, jsonnetfile.FileJsonnet, jsonnetfile.LockFile:
+		return true
+	}
+	return licenses.MatchString(name)
+}
+
+// entrypoints returns the files the imports are followed from
+func (in *Installer) entrypoints(direct v1.JsonnetFile) ([]string, error) {
+	if len(direct.Entrypoints) == 0 {
+		vendorDir, err := filepath.Rel(in.rootDir, in.projectVendorDir)
+		if err != nil {
+			return nil, err
+		}
+		return rewrite.Files(in.rootDir, vendorDir)
+	}
+
+	var files []string
+	for _, pattern := range direct.Entrypoints {
+		matches, err := filepath.Glob(filepath.Join(in.rootDir, pattern))
+		if err != nil {
+			return nil, errors.Wrapf(err, "entrypoint `%s`", pattern)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("entrypoint `%s` matches no files", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// reachable follows the imports of the entrypoints through vendor. It returns
+// the paths of all files reached and the packages that were pruned of
+// imported files.
+func (in *Installer) reachable(direct v1.JsonnetFile, locks map[string]deps.Dependency) (map[string]bool, []string, error) {
+	vendorDir, err := filepath.EvalSymlinks(in.vendorDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	queue, err := in.entrypoints(direct)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	owners := packageOwners(locks, direct.LegacyImports)
+	reached := make(map[string]bool)
+	missing := make(map[string]bool)
+
+	for len(queue) > 0 {
+		file := queue[0]
+		queue = queue[1:]
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		// the file is kept, but what it imports can't be known
+		imports, err := rewrite.Imports(file, data)
+		if err != nil {
+			in.env.emit(Event{Type: EventWarn, Message: fmt.Sprintf("not following the imports of %s: %s", file, err)})
+			continue
+		}
+
+		for _, imp := range imports {
+			candidates := []string{imp.Path}
+			if !filepath.IsAbs(imp.Path) {
+				candidates = []string{
+					filepath.Join(filepath.Dir(file), imp.Path),
+					filepath.Join(vendorDir, imp.Path),
+				}
+			}
+
+			found := ""
+			for _, c := range candidates {
+				if info, err := os.Stat(c); err == nil && !info.IsDir() {
+					found = c
+					break
+				}
+			}
+
+			if found == "" {
+				for _, c := range candidates {
+					name := owner(vendorDir, c, owners)
+					if name != "" && locks[name].PrunedFrom != "" {
+						missing[name] = true
+					}
+				}
+				continue
+			}
+
+			real, err := filepath.EvalSymlinks(found)
+			if err != nil {
+				return nil, nil, err
+			}
+			if reached[found] && reached[real] {
+				continue
+			}
+			reached[found] = true
+			reached[real] = true
+
+			// other kinds of imports are not evaluated
+			if imp.Kind == rewrite.KindImport {
+				queue = append(queue, found)
+			}
+		}
+	}
+
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return reached, names, nil
+}
+
+// pruneAll removes the files of all packages that were not reached and
+// updates the sums of the locks. Linked local packages are left alone, as
+// they are symlinks to directories of the user.
+func (in *Installer) pruneAll(locks map[string]deps.Dependency, reached map[string]bool) error {
+	vendorDir, err := filepath.EvalSymlinks(in.vendorDir)
+	if err != nil {
+		return err
+	}
+	owners := packageOwners(locks, false)
+
+	for name, l := range locks {
+		if linked(l) {
+			continue
+		}
+		if err := prune(vendorDir, name, owners, reached); err != nil {
+			return errors.Wrapf(err, "pruning %s", name)
+		}
+	}
+
+	// the sums of packages include nested ones, so they are only computed
+	// once all are pruned
+	for name, l := range locks {
+		if linked(l) {
+			continue
+		}
+
+		sum := hashDir(filepath.Join(vendorDir, name))
+		if sum == l.Sum {
+			continue
+		}
+		if l.PrunedFrom == "" {
+			l.PrunedFrom = l.Sum
+		}
+		l.Sum = sum
+		locks[name] = l
+	}
+	return nil
+}
+
+// prune removes the files of the package name that were not reached, along
+// with the directories left empty
+func prune(vendorDir, name string, owners map[string]string, reached map[string]bool) error {
+	root := filepath.Join(vendorDir, name)
+
+	var dirs []string
+	err := filepath.Walk(root, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		// nested packages are pruned on their own
+		if owner(vendorDir, p, owners) != name {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		switch {
+		case info.IsDir():
+			if p != root {
+				dirs = append(dirs, p)
+			}
+		case !reached[p] && !keep(info.Name()):
+			return os.Remove(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// innermost first, non-empty ones fail to be removed
+	for i := len(dirs) - 1; i >= 0; i-- {
+		os.Remove(dirs[i])
+	}
+	return nil
+}
+
+// packageOwners maps the vendor paths of packages to their names, optionally
+// including their legacy names
+func packageOwners(locks map[string]deps.Dependency, legacy bool) map[string]string {
+	owners := make(map[string]string, len(locks))
+	for name, l := range locks {
+		if legacy && l.LegacyName() != name {
+			owners[l.LegacyName()] = name
+		}
+	}
+	for name := range locks {
+		owners[name] = name
+	}
+	return owners
+}
+
+// owner returns the name of the package the file at p belongs to, which is
+// the one with the longest vendor path containing it. It is empty if there is
+// none.
+func owner(vendorDir, p string, owners map[string]string) string {
+	rel, err := filepath.Rel(vendorDir, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return ""
+	}
+
+	for prefix := filepath.ToSlash(rel); prefix != "."; prefix = path.Dir(prefix) {
+		if name, ok := owners[prefix]; ok {
+			return name
+		}
+	}
+	return ""
+}
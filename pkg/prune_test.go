@@ -0,0 +1,156 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestPrune(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	tmp, err := ioutil.TempDir("", "jb-prune")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	work := filepath.Join(tmp, "work")
+	for name, content := range map[string]string{
+		"lib/main.libsonnet":  "(import 'util.libsonnet') + { data: importstr 'data.txt' }",
+		"lib/util.libsonnet":  "{}",
+		"lib/data.txt":        "data",
+		"lib/other.libsonnet": "{}",
+		"lib/tests/a.jsonnet": "import '../main.libsonnet'",
+		"lib/LICENSE":         "Apache-2.0",
+		"lib/docs/NOTICE.md":  "notice",
+	} {
+		writeFile(t, filepath.Join(work, name), content)
+	}
+	testGit(t, work, "init", "-q")
+	testGit(t, work, "add", ".")
+	testGit(t, work, "commit", "-q", "-m", "initial")
+	testGit(t, work, "tag", "v1")
+	bare := filepath.Join(tmp, "repo.git")
+	testGit(t, tmp, "clone", "-q", "--bare", work, bare)
+
+	root := filepath.Join(tmp, "project")
+	writeFile(t, filepath.Join(root, "main.jsonnet"), "import 'lib/main.libsonnet'")
+
+	d, err := deps.Parse("", "file://"+filepath.ToSlash(bare)+"/lib@v1")
+	require.NoError(t, err)
+	d.Alias = "lib"
+	jf := v1.New()
+	jf.Dependencies["lib"] = *d
+
+	ensure := func(prune bool, locks map[string]deps.Dependency) (map[string]deps.Dependency, *recorder) {
+		rec := &recorder{}
+		in, err := NewInstaller(InstallerOptions{RootDir: root, Observer: rec, Prune: prune})
+		require.NoError(t, err)
+		require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+		locks, err = in.Ensure(jf, locks)
+		require.NoError(t, err)
+		return locks, rec
+	}
+	vendored := func() []string {
+		var files []string
+		dir := filepath.Join(root, "vendor", "lib")
+		filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err == nil && !info.IsDir() {
+				rel, _ := filepath.Rel(dir, path)
+				files = append(files, filepath.ToSlash(rel))
+			}
+			return err
+		})
+		sort.Strings(files)
+		return files
+	}
+
+	locks, _ := ensure(true, map[string]deps.Dependency{})
+	assert.Equal(t, []string{"LICENSE", "data.txt", "docs/NOTICE.md", "main.libsonnet", "util.libsonnet"}, vendored())
+	full := locks["lib"].PrunedFrom
+	assert.NotEmpty(t, full)
+	assert.Equal(t, hashDir(filepath.Join(root, "vendor", "lib")), locks["lib"].Sum)
+	assert.True(t, check(locks["lib"], filepath.Join(root, "vendor")))
+
+	// intact pruned packages are kept
+	locks, rec := ensure(true, locks)
+	require.Len(t, rec.ofType(EventResult), 1)
+	assert.False(t, rec.ofType(EventResult)[0].Installed)
+
+	// newly imported files are restored
+	writeFile(t, filepath.Join(root, "main.jsonnet"), "(import 'lib/main.libsonnet') + (import 'lib/other.libsonnet')")
+	locks, _ = ensure(true, locks)
+	assert.Equal(t, []string{"LICENSE", "data.txt", "docs/NOTICE.md", "main.libsonnet", "other.libsonnet", "util.libsonnet"}, vendored())
+	assert.Equal(t, full, locks["lib"].PrunedFrom)
+
+	// without pruning, the complete package is installed again
+	locks, _ = ensure(false, locks)
+	assert.Len(t, vendored(), 7)
+	assert.Empty(t, locks["lib"].PrunedFrom)
+	assert.Equal(t, full, locks["lib"].Sum)
+}
+
+func TestPruneSkipsBrokenFiles(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "jb-prune")
+	require.NoError(t, err)
+	defer os.RemoveAll(tmp)
+
+	writeFile(t, filepath.Join(tmp, "lib", "main.libsonnet"), "{}")
+	writeFile(t, filepath.Join(tmp, "lib", "other.libsonnet"), "{}")
+
+	root := filepath.Join(tmp, "project")
+	writeFile(t, filepath.Join(root, "main.jsonnet"), "import 'lib/main.libsonnet'")
+	writeFile(t, filepath.Join(root, "broken.jsonnet"), "import 'lib/other.libsonnet' +")
+
+	d := deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: "../lib", Mode: deps.LocalCopy}}}
+	jf := v1.New()
+	jf.Dependencies[d.Name()] = d
+
+	rec := &recorder{}
+	in, err := NewInstaller(InstallerOptions{RootDir: root, Observer: rec, Prune: true})
+	require.NoError(t, err)
+	require.NoError(t, os.MkdirAll(filepath.Join(in.VendorDir(), ".tmp"), os.ModePerm))
+
+	_, err = in.Ensure(jf, map[string]deps.Dependency{})
+	require.NoError(t, err)
+
+	warnings := rec.ofType(EventWarn)
+	require.Len(t, warnings, 1)
+	assert.Contains(t, warnings[0].Message, filepath.Join(root, "broken.jsonnet"))
+
+	_, err = os.Stat(filepath.Join(root, "vendor", "lib", "main.libsonnet"))
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(root, "vendor", "lib", "other.libsonnet"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(name), os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(name, []byte(content), 0644))
+}
@@ -3,18 +3,19 @@ package pkg
 import (
 	"archive/tar"
 	"compress/gzip"
+	"context"
 	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
-	"github.com/fatih/color"
 	"github.com/pkg/errors"
 	"io"
 	"io/ioutil"
-	"net/http"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func GzipUntar(dst string, r io.Reader, subDir string) error {
@@ -100,6 +101,73 @@ func GzipUntar(dst string, r io.Reader, subDir string) error {
 	}
 }
 
+// GzipTar writes the contents of src as a gzipped tarball to w. All entries
+// are placed below prefix, so that the archive can be extracted using
+// GzipUntar. Entries are written in lexical order with zeroed timestamps and
+// ownership, so the same tree always yields the same archive.
+func GzipTar(w io.Writer, src, prefix string) error {
+	gzw := gzip.NewWriter(w)
+	tw := tar.NewWriter(gzw)
+
+	err := filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+
+		var link string
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(file); err != nil {
+				return err
+			}
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+
+		header.Name = path.Join(prefix, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		header.ModTime = time.Unix(0, 0)
+		header.AccessTime = time.Time{}
+		header.ChangeTime = time.Time{}
+		header.Uid, header.Gid = 0, 0
+		header.Uname, header.Gname = "", ""
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		_, err = io.Copy(tw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gzw.Close()
+}
+
 func CreateTempDir(name, dir, version string) (string, error) {
 	pkgh := sha256.Sum256([]byte(fmt.Sprintf("jsonnetpkg-%s-%s", strings.Replace(name, "/", "-", -1), strings.Replace(version, "/", "-", -1))))
 	// using 16 bytes should be a good middle ground between length and collision resistance
@@ -112,51 +180,107 @@ func CreateTempDir(name, dir, version string) (string, error) {
 }
 
 func DownloadFile(filepath string, url string) error {
-	resp, err := http.Get(url)
-	if err != nil {
-		return err
-	}
-
-	color.Cyan("GET %s %d", url, resp.StatusCode)
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
-	}
-
-	defer resp.Body.Close()
+	return Env{}.downloadFile(context.Background(), filepath, url)
+}
 
-	// Create the file
-	out, err := os.Create(filepath)
-	if err != nil {
-		return err
-	}
-	defer out.Close()
+// DownloadAndUntarTo downloads the archive at url and extracts it to destPath.
+// The checksum of the archive is returned.
+func DownloadAndUntarTo(tmpDir, url, destPath string) (string, error) {
+	return Env{}.downloadAndUntarTo(context.Background(), tmpDir, url, destPath)
+}
 
-	// Write the body to file
-	_, err = io.Copy(out, resp.Body)
+func (e Env) downloadAndUntarTo(ctx context.Context, tmpDir, url, destPath string) (string, error) {
+	filename := filepath.Base(url)
+	err := e.downloadFile(ctx, path.Join(tmpDir, filename), url)
 	if err != nil {
-		return err
+		return "", errors.Wrap(err, "failed to download file")
 	}
 
-	return nil
-}
-
-func DownloadAndUntarTo(tmpDir, url, destPath string) error {
-	filename := filepath.Base(url)
-	err := DownloadFile(path.Join(tmpDir, filename), url)
+	digest, err := hashFile(path.Join(tmpDir, filename))
 	if err != nil {
-		return errors.Wrap(err, "failed to download file")
+		return "", errors.Wrap(err, "failed to hash downloaded archive")
 	}
 
 	var ar *os.File
 	ar, err = os.Open(path.Join(tmpDir, filename))
 	if err != nil {
-		return errors.Wrap(err, "failed to open downloaded archive")
+		return "", errors.Wrap(err, "failed to open downloaded archive")
 	}
 	defer ar.Close()
 	err = GzipUntar(destPath, ar, "")
 	if err != nil {
-		return errors.Wrap(err, "failed to unpack downloaded archive")
+		return "", errors.Wrap(err, "failed to unpack downloaded archive")
 	}
-	return nil
+	return digest, nil
+}
+
+// hashFile computes the checksum of a single file, encoded like the ones of
+// hashDir
+func hashFile(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, f); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// copyDir copies the files below src to dst, recreating symlinks instead of
+// following them
+func copyDir(src, dst string) error {
+	return copyDirSkip(src, dst, nil)
+}
+
+// copyDirSkip is copyDir leaving out the files and directories skip returns
+// true for. skip is called with the path relative to src.
+func copyDirSkip(src, dst string, skip func(rel string, info os.FileInfo) bool) error {
+	return filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		switch {
+		case rel != "." && skip != nil && skip(rel, info):
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		case info.IsDir():
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			return os.Symlink(link, target)
+		}
+
+		in, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer in.Close()
+
+		out, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			out.Close()
+			return err
+		}
+		return out.Close()
+	})
 }
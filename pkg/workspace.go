@@ -0,0 +1,106 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/pkg/errors"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/pkg/jsonnetfile"
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// MergeWorkspace merges the direct dependencies of all members of a workspace
+// into a single JsonnetFile, which can be passed to Ensure to vendor them all
+// at once. members maps the member directories as listed in the workspace to
+// their jsonnetfile.
+//
+// Local dependencies of members are rewritten to be relative to the workspace
+// root, so members can depend on each other using relative paths. If members
+// require the same package at different versions, VersionMismatch is returned.
+func MergeWorkspace(ws v1.Workspace, members map[string]v1.JsonnetFile) (v1.JsonnetFile, error) {
+	merged := v1.New()
+	merged.LegacyImports = ws.LegacyImports
+	merged.Replace = ws.Replace
+
+	requiredBy := make(map[string]string)
+
+	for _, member := range ws.Members {
+		jf, ok := members[member]
+		if !ok {
+			return merged, fmt.Errorf("workspace member `%s` not loaded", member)
+		}
+
+		for _, d := range jf.Dependencies {
+			if d.Source.LocalSource != nil && !filepath.IsAbs(d.Source.LocalSource.Directory) {
+				d.Source.LocalSource = &deps.Local{
+					Directory: filepath.Join(member, d.Source.LocalSource.Directory),
+					Mode:      d.Source.LocalSource.Mode,
+				}
+			}
+
+			other, ok := merged.Dependencies[d.Name()]
+			if !ok {
+				merged.Dependencies[d.Name()] = d
+				requiredBy[d.Name()] = member
+				continue
+			}
+
+			if other.Version != d.Version || !reflect.DeepEqual(other.Source, d.Source) {
+				return merged, errors.Wrapf(VersionMismatch, "%s is required as `%s` by %s, but as `%s` by %s",
+					d.Name(), other.Version, requiredBy[d.Name()], d.Version, member)
+			}
+
+			// nested dependencies are needed as soon as one member wants them
+			other.Single = other.Single && d.Single
+			merged.Dependencies[d.Name()] = other
+		}
+	}
+
+	return merged, nil
+}
+
+// LoadWorkspaceMembers reads the jsonnetfile.json of every member of the
+// workspace at root
+func LoadWorkspaceMembers(root string, ws v1.Workspace) (map[string]v1.JsonnetFile, error) {
+	members := make(map[string]v1.JsonnetFile, len(ws.Members))
+	for _, member := range ws.Members {
+		manifest, err := jsonnetfile.Manifest(filepath.Join(root, member))
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading workspace member `%s`", member)
+		}
+		jf, err := jsonnetfile.Load(manifest)
+		if err != nil {
+			return nil, errors.Wrapf(err, "loading workspace member `%s`", member)
+		}
+		members[member] = jf
+	}
+	return members, nil
+}
+
+// WorkspaceMember returns the entry of the workspace at root listing dir as a
+// member, if any. Both root and dir must be absolute.
+func WorkspaceMember(root string, ws v1.Workspace, dir string) (string, bool) {
+	for _, m := range ws.Members {
+		if filepath.Join(root, m) == filepath.Clean(dir) {
+			return m, true
+		}
+	}
+	return "", false
+}
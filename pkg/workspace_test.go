@@ -0,0 +1,81 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pkg
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+func TestMergeWorkspace(t *testing.T) {
+	grafonnet := func(version string, single bool) deps.Dependency {
+		return deps.Dependency{
+			Version: version,
+			Single:  single,
+			Source: deps.Source{GitSource: &deps.Git{
+				Scheme: deps.GitSchemeHTTPS,
+				Host:   "github.com",
+				User:   "grafana",
+				Repo:   "grafonnet-lib",
+				Subdir: "/grafonnet",
+			}},
+		}
+	}
+	local := func(dir string) deps.Dependency {
+		return deps.Dependency{Source: deps.Source{LocalSource: &deps.Local{Directory: dir}}}
+	}
+	file := func(ds ...deps.Dependency) v1.JsonnetFile {
+		jf := v1.New()
+		for _, d := range ds {
+			jf.Dependencies[d.Name()] = d
+		}
+		return jf
+	}
+
+	ws := v1.NewWorkspace()
+	ws.Members = []string{"environments/prod", "environments/dev"}
+
+	merged, err := MergeWorkspace(ws, map[string]v1.JsonnetFile{
+		"environments/prod": file(grafonnet("v1", true), local("../../lib/common")),
+		"environments/dev":  file(grafonnet("v1", false), local("../../lib/common")),
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, file(grafonnet("v1", false), local("lib/common")).Dependencies, merged.Dependencies)
+
+	_, err = MergeWorkspace(ws, map[string]v1.JsonnetFile{
+		"environments/prod": file(grafonnet("v1", false)),
+		"environments/dev":  file(grafonnet("v2", false)),
+	})
+	assert.Equal(t, VersionMismatch, errors.Cause(err))
+}
+
+func TestWorkspaceMember(t *testing.T) {
+	ws := v1.NewWorkspace()
+	ws.Members = []string{"environments/prod", "./lib/"}
+
+	m, ok := WorkspaceMember("/repo", ws, "/repo/lib")
+	assert.True(t, ok)
+	assert.Equal(t, "./lib/", m)
+
+	_, ok = WorkspaceMember("/repo", ws, "/repo/environments")
+	assert.False(t, ok)
+}
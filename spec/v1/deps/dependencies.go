@@ -14,8 +14,11 @@
 package deps
 
 import (
+	"errors"
+	"fmt"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 )
@@ -26,28 +29,84 @@ type Dependency struct {
 	Sum     string `json:"sum,omitempty"`
 	Single  bool   `json:"single,omitempty"`
 
+	// Include limits the vendored files to those matching any of the globs,
+	// which are relative to the package. Exclude removes the matching ones.
+	// `**` matches any number of directories, and a matching directory
+	// applies to all files in it. Licenses and jsonnetfiles are always kept.
+	Include []string `json:"include,omitempty"`
+	Exclude []string `json:"exclude,omitempty"`
+	// ExcludeDependencies are the names of nested dependencies not to
+	// install. Single excludes all of them.
+	ExcludeDependencies []string `json:"excludeDependencies,omitempty"`
+
+	// Alias installs the package under a different vendor path and import
+	// name than the one derived from its source. This allows vendoring
+	// several versions of the same source side by side.
+	Alias string `json:"as,omitempty"`
+
+	// ReplacedBy is the source the dependency was actually retrieved from,
+	// if a `replace` directive applied. Only recorded in the lockfile.
+	ReplacedBy *Source `json:"replacedBy,omitempty"`
+
+	// The following describe how the dependency was resolved. They are only
+	// recorded in lockfiles, starting with version 2.
+
+	// Requested is the version asked for in the jsonnetfile, e.g. a branch or
+	// a tag. Version holds what it resolved to, e.g. a commit.
+	Requested string `json:"requested,omitempty"`
+	// Tag points at the resolved commit of git sources, if there is any
+	Tag string `json:"tag,omitempty"`
+	// HashAlgorithm used for Sum and ArchiveDigest
+	HashAlgorithm string `json:"hashAlgorithm,omitempty"`
+	// ArchiveDigest is the checksum of the archive the package was extracted
+	// from, if it was downloaded as one
+	ArchiveDigest string `json:"archiveDigest,omitempty"`
+	// Parents are the names of the packages requiring this one, `.` being the
+	// project itself
+	Parents []string `json:"parents,omitempty"`
+	// PrunedFrom is the Sum of the complete package, if the files not
+	// reachable from the entrypoints of the project were removed from vendor.
+	// Sum covers the remaining files then.
+	PrunedFrom string `json:"prunedFrom,omitempty"`
+
 	// older schema used to have `name`. We still need that data for
 	// `LegacyName`
 	LegacyNameCompat string `json:"name,omitempty"`
 }
 
-func Parse(dir, uri string) *Dependency {
+// Parse parses a package uri as passed on the command line. It can be a git
+// url, a path to a local directory or an http(s) url of an archive. http(s)
+// urls are archives unless they end in .git, but fail to parse as git url.
+// Unparseable uris are reported with a descriptive error.
+func Parse(dir, uri string) (*Dependency, error) {
 	if uri == "" {
-		return nil
+		return nil, errors.New("empty package uri")
+	}
+
+	if d := parseHttp(uri); d != nil && isTarball(uri) {
+		return d, nil
 	}
 
-	if d := parseGit(uri); d != nil {
-		return d
+	d, gitErr := parseGit(uri)
+	if gitErr == nil {
+		return d, nil
 	}
 
 	if d := parseLocal(dir, uri); d != nil {
-		return d
+		return d, nil
+	}
+
+	if d := parseHttp(uri); d != nil && !isGitRepo(uri) {
+		return d, nil
 	}
 
-	return parseHttp(uri)
+	return nil, gitErr
 }
 
 func (d Dependency) Name() string {
+	if d.Alias != "" {
+		return d.Alias
+	}
 	return d.Source.Name()
 }
 
@@ -55,9 +114,32 @@ func (d Dependency) LegacyName() string {
 	if d.LegacyNameCompat != "" {
 		return d.LegacyNameCompat
 	}
+	if d.Alias != "" {
+		return path.Base(d.Alias)
+	}
 	return d.Source.LegacyName()
 }
 
+// ValidateAlias returns an error if alias can't be used as the vendor path of
+// a package, e.g. because it points outside of the vendor directory
+func ValidateAlias(alias string) error {
+	switch {
+	case strings.Contains(alias, `\`):
+		return fmt.Errorf("alias `%s` must use forward slashes", alias)
+	case path.IsAbs(alias), filepath.IsAbs(alias):
+		return fmt.Errorf("alias `%s` must be a relative path", alias)
+	case alias != path.Clean(alias), alias == ".", alias == "..", strings.HasPrefix(alias, "../"):
+		return fmt.Errorf("alias `%s` must be a clean path inside of the vendor directory", alias)
+	case alias == ".tmp", strings.HasPrefix(alias, ".tmp/"):
+		return fmt.Errorf("alias `%s` is reserved", alias)
+	}
+	return nil
+}
+
+// HashSHA256 is the algorithm all checksums are computed with. Lockfiles
+// before version 2 did not record it, but used it as well.
+const HashSHA256 = "sha256"
+
 type Source struct {
 	GitSource            *Git            `json:"git,omitempty"`
 	LocalSource          *Local          `json:"local,omitempty"`
@@ -111,8 +193,25 @@ func (s Source) LegacyName() string {
 	}
 }
 
+// Modes of installing local dependencies
+const (
+	// LocalLink symlinks the directory into vendor, which is the default
+	LocalLink = "link"
+	// LocalCopy copies the directory into vendor, so that it has a sum like
+	// remote packages and does not depend on the directory to exist
+	LocalCopy = "copy"
+)
+
 type Local struct {
 	Directory string `json:"directory"`
+	// Mode is either LocalLink or LocalCopy. Empty means LocalLink.
+	Mode string `json:"mode,omitempty"`
+}
+
+// Copied returns whether the directory is copied into vendor instead of
+// being symlinked
+func (l *Local) Copied() bool {
+	return l != nil && l.Mode == LocalCopy
 }
 
 func parseLocal(dir, p string) *Dependency {
@@ -143,7 +242,13 @@ type Http struct {
 	Target string `json:"target"`
 }
 
+// parseHttp recognizes http(s) urls
 func parseHttp(uri string) *Dependency {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil
+	}
+
 	return &Dependency{
 		Source: Source{
 			HttpSource: &Http{
@@ -155,9 +260,62 @@ func parseHttp(uri string) *Dependency {
 	}
 }
 
+// isTarball returns whether the path of the url uri names a gzipped tarball,
+// which is never a git repository
+func isTarball(uri string) bool {
+	u, err := url.Parse(uri)
+	return err == nil && (strings.HasSuffix(u.Path, ".tar.gz") || strings.HasSuffix(u.Path, ".tgz"))
+}
+
+// isGitRepo returns whether the path of the url uri contains a repository
+// ending in .git, so that it can only be meant as git url
+func isGitRepo(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return false
+	}
+	for _, s := range strings.Split(u.Path, "/") {
+		// the version follows the repository or subdirectory
+		if i := strings.Index(s, "@"); i >= 0 {
+			s = s[:i]
+		}
+		if strings.HasSuffix(s, ".git") && s != ".git" {
+			return true
+		}
+	}
+	return false
+}
+
 type GitlabRegistry struct {
 	Project  string `json:"project"`
 	Package  string `json:"package"`
 	Host     string `json:"host,omitempty"`
 	Filename string `json:"filename,omitempty"`
 }
+
+// PackageURL returns the url of the archive of version in the generic package
+// registry of the project
+func (g *GitlabRegistry) PackageURL(version string) url.URL {
+	host := "gitlab.com"
+	if g.Host != "" {
+		host = g.Host
+	}
+	filename := "package.tar.gz"
+	if g.Filename != "" {
+		filename = g.Filename
+	}
+
+	packageUrl := url.URL{
+		Scheme: "https",
+		Host:   host,
+	}
+	// this way is needed so that net/url does not double encode '/' to '%252F'
+	return *packageUrl.JoinPath(
+		"api/v4/projects",
+		url.PathEscape(g.Project),
+		"packages/generic",
+		g.Package,
+		version,
+		filename,
+	)
+}
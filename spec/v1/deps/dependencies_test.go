@@ -53,6 +53,40 @@ func TestParseDependency(t *testing.T) {
 			path: "examplec/foo/bar",
 			want: nil,
 		},
+		{
+			name: "HttpDownload",
+			path: "https://example.com/download?id=foo",
+			want: &Dependency{
+				Source: Source{
+					HttpSource: &Http{
+						Url: "https://example.com/download?id=foo",
+					},
+				},
+				Version: "",
+			},
+		},
+		{
+			name: "InvalidGitHttp",
+			path: "https://user:pw@example.com/foo/bar.git",
+			want: nil,
+		},
+		{
+			name: "InvalidGitVersion",
+			path: "https://example.com/foo/bar.git/lib@",
+			want: nil,
+		},
+		{
+			name: "HttpArchive",
+			path: "https://example.com/releases/foo-v1.tar.gz",
+			want: &Dependency{
+				Source: Source{
+					HttpSource: &Http{
+						Url: "https://example.com/releases/foo-v1.tar.gz",
+					},
+				},
+				Version: "",
+			},
+		},
 		{
 			name: "local",
 			path: testFolder,
@@ -68,13 +102,35 @@ func TestParseDependency(t *testing.T) {
 	}
 	for _, tt := range tests {
 		_ = t.Run(tt.name, func(t *testing.T) {
-			dependency := Parse("", tt.path)
+			dependency, err := Parse("", tt.path)
 
-			if tt.path == "" {
+			if tt.want == nil {
+				assert.Error(t, err)
 				assert.Nil(t, dependency)
 			} else {
+				assert.NoError(t, err)
 				assert.Equal(t, tt.want, dependency)
 			}
 		})
 	}
 }
+
+func TestAliasName(t *testing.T) {
+	d := Dependency{
+		Source: Source{GitSource: &Git{
+			Scheme: GitSchemeHTTPS,
+			Host:   "github.com",
+			User:   "grafana",
+			Repo:   "grafonnet",
+		}},
+	}
+	assert.Equal(t, "github.com/grafana/grafonnet", d.Name())
+	assert.Equal(t, "grafonnet", d.LegacyName())
+
+	d.Alias = "github.com/grafana/grafonnet-v9"
+	assert.Equal(t, "github.com/grafana/grafonnet-v9", d.Name())
+	assert.Equal(t, "grafonnet-v9", d.LegacyName())
+
+	d.LegacyNameCompat = "g9"
+	assert.Equal(t, "g9", d.LegacyName())
+}
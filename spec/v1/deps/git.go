@@ -16,6 +16,8 @@ package deps
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"path"
 	"path/filepath"
 	"regexp"
 	"strings"
@@ -24,6 +26,7 @@ import (
 const (
 	GitSchemeSSH   = "ssh://git@"
 	GitSchemeHTTPS = "https://"
+	GitSchemeFile  = "file://"
 )
 
 // Git holds all required information for cloning a package from git
@@ -33,25 +36,37 @@ type Git struct {
 
 	// Hostname the repo is located at
 	Host string
-	// User (example.com/<user>)
+	// Port of the host, if not the default one of the scheme
+	Port string
+	// User (example.com/<user>). Might contain (sub)groups, e.g.
+	// `group/subgroup`
 	User string
 	// Repo (example.com/<user>/<repo>)
 	Repo string
 	// Subdir (example.com/<user>/<repo>/<subdir>)
 	Subdir string
+
+	// Submodules of the repository are checked out as well
+	Submodules bool
+	// LFS replaces Git LFS pointers with the actual files
+	LFS bool
 }
 
 // json representation of Git (for compatiblity with old format)
 type jsonGit struct {
-	Remote string `json:"remote"`
-	Subdir string `json:"subdir"`
+	Remote     string `json:"remote"`
+	Subdir     string `json:"subdir"`
+	Submodules bool   `json:"submodules,omitempty"`
+	LFS        bool   `json:"lfs,omitempty"`
 }
 
 // MarshalJSON takes care of translating between Git and jsonGit
 func (gs *Git) MarshalJSON() ([]byte, error) {
 	j := jsonGit{
-		Remote: gs.Remote(),
-		Subdir: strings.TrimPrefix(gs.Subdir, "/"),
+		Remote:     gs.Remote(),
+		Subdir:     strings.TrimPrefix(gs.Subdir, "/"),
+		Submodules: gs.Submodules,
+		LFS:        gs.LFS,
 	}
 	return json.Marshal(j)
 }
@@ -66,20 +81,28 @@ func (gs *Git) UnmarshalJSON(data []byte) error {
 	if j.Subdir != "" {
 		gs.Subdir = "/" + strings.TrimPrefix(j.Subdir, "/")
 	}
+	gs.Submodules = j.Submodules
+	gs.LFS = j.LFS
 
-	tmp := parseGit(j.Remote)
-	if tmp == nil {
-		return fmt.Errorf("unable to parse git url `%s` ", j.Remote)
+	tmp, err := parseGit(j.Remote)
+	if err != nil {
+		return err
 	}
 	gs.Host = tmp.Source.GitSource.Host
+	gs.Port = tmp.Source.GitSource.Port
 	gs.User = tmp.Source.GitSource.User
 	gs.Repo = tmp.Source.GitSource.Repo
 	gs.Scheme = tmp.Source.GitSource.Scheme
 	return nil
 }
 
-// Name returns the repository in a go-like format (example.com/user/repo/subdir)
+// Name returns the repository in a go-like format (example.com/user/repo/subdir).
+// Repositories on the local disk are named after the repository only, like
+// local sources, as their location differs between machines (repo/subdir).
 func (gs *Git) Name() string {
+	if gs.Scheme == GitSchemeFile {
+		return strings.TrimSuffix(gs.Repo, ".git") + gs.Subdir
+	}
 	return fmt.Sprintf("%s/%s/%s%s", gs.Host, gs.User, strings.TrimSuffix(gs.Repo, ".git"), gs.Subdir)
 }
 
@@ -89,109 +112,220 @@ func (gs *Git) LegacyName() string {
 	return filepath.Base(strings.TrimSuffix(gs.Repo, ".git") + gs.Subdir)
 }
 
-var gitProtoFmts = map[string]string{
-	GitSchemeSSH:   GitSchemeSSH + "%s/%s/%s.git",
-	GitSchemeHTTPS: GitSchemeHTTPS + "%s/%s/%s.git",
-}
-
 // Remote returns a remote string that can be passed to git
 func (gs *Git) Remote() string {
-	return fmt.Sprintf(gitProtoFmts[gs.Scheme],
-		gs.Host, gs.User, gs.Repo,
-	)
+	if gs.Scheme == GitSchemeFile {
+		return GitSchemeFile + "/" + path.Join(gs.User, gs.Repo)
+	}
+
+	host := gs.Host
+	if gs.Port != "" {
+		host = net.JoinHostPort(gs.Host, gs.Port)
+	}
+
+	// Azure DevOps does not accept the .git suffix
+	suffix := ".git"
+	if gs.isAzureDevOps() {
+		suffix = ""
+	}
+
+	return fmt.Sprintf("%s%s/%s/%s%s", gs.Scheme, host, gs.User, gs.Repo, suffix)
 }
 
-// regular expressions for matching package uris
-const (
-	gitSSHExp = `ssh://git@(?P<host>.+)/(?P<user>.+)/(?P<repo>.+).git`
-	gitSCPExp = `^git@(?P<host>.+):(?P<user>.+)/(?P<repo>.+).git`
-	// The long ugly pattern for ${host} here is a generic pattern for "valid URL with zero or more subdomains and a valid TLD"
-	gitHTTPSSubgroup = `(?P<host>[a-zA-Z0-9][a-zA-Z0-9-\.]{1,61}[a-zA-Z0-9]\.[a-zA-Z]{2,})/(?P<user>[-_~a-zA-Z0-9/\.]+)/(?P<repo>[-_a-zA-Z0-9\.]+)\.git`
-	gitHTTPSExp      = `(?P<host>[a-zA-Z0-9][a-zA-Z0-9-\.]{1,61}[a-zA-Z0-9]\.[a-zA-Z]{2,})/(?P<user>[-_~a-zA-Z0-9\.]+)/(?P<repo>[-_a-zA-Z0-9\.]+)`
-)
+func (gs *Git) isAzureDevOps() bool {
+	return gs.User == "_git" || strings.HasSuffix(gs.User, "/_git") || isAzureDevOpsSSH(gs.Host)
+}
+
+func isAzureDevOpsSSH(host string) bool {
+	return host == "ssh.dev.azure.com" || strings.HasSuffix(host, "vs-ssh.visualstudio.com")
+}
 
 var (
-	VersionRegex        = `@(?P<version>.*)`
-	PathRegex           = `/(?P<subdir>.*)`
-	PathAndVersionRegex = `/(?P<subdir>.*)@(?P<version>.*)`
+	// host without a scheme must have a valid TLD, to tell it apart from
+	// local directories
+	gitHostTLDExp = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-\.]{0,61}[a-zA-Z0-9]\.[a-zA-Z]{2,}$`)
+	gitHostExp    = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-\.]{0,61}[a-zA-Z0-9])?$`)
+	gitPortExp    = regexp.MustCompile(`^[0-9]{1,5}$`)
+	gitSCPExp     = regexp.MustCompile(`^(?P<user>[^@/:]+)@(?P<host>[^@/:]+):(?P<path>.*)$`)
+	gitSegmentExp = regexp.MustCompile(`^[-_~a-zA-Z0-9\.]+$`)
 )
 
-func parseGit(uri string) *Dependency {
-	var d = Dependency{
-		Version: "master",
-		Source:  Source{},
-	}
-	var gs *Git
-	var version string
+// parseGit parses the following forms of git package uris, each optionally
+// followed by a subdirectory and `@version`:
+//
+//	example.com/user/repo
+//	https://host[:port]/user/repo
+//	ssh://git@host[:port]/user/repo.git
+//	git+ssh://git@host[:port]/group/subgroup/repo.git
+//	git+https://host[:port]/user/repo
+//	git@host:user/repo.git
+//	https://dev.azure.com/org/project/_git/repo
+//	file:///srv/mirrors/repo.git
+//
+// Hosts without a scheme must have a TLD. If the repository path consists of
+// more than two elements, the repository is either the element ending in
+// `.git`, the one following `_git` (Azure DevOps) or the second one.
+func parseGit(uri string) (*Dependency, error) {
+	gs := &Git{}
 
+	var user, hostport, path string
 	switch {
-	case reMatch(gitSSHExp, uri):
-		gs, version = match(uri, gitSSHExp)
-		gs.Scheme = GitSchemeSSH
-	case reMatch(gitSCPExp, uri):
-		gs, version = match(uri, gitSCPExp)
+	case strings.HasPrefix(uri, "file://"), strings.HasPrefix(uri, "git+file://"):
+		return parseGitFile(uri)
+
+	case strings.Contains(uri, "://"):
+		i := strings.Index(uri, "://")
+		switch scheme := strings.TrimPrefix(uri[:i], "git+"); scheme {
+		case "ssh":
+			gs.Scheme = GitSchemeSSH
+		case "https":
+			gs.Scheme = GitSchemeHTTPS
+		default:
+			return nil, fmt.Errorf("unsupported git scheme `%s` in `%s`: use https or ssh", uri[:i], uri)
+		}
+
+		rest := uri[i+len("://"):]
+		hostport, path = rest, ""
+		if j := strings.Index(rest, "/"); j >= 0 {
+			hostport, path = rest[:j], rest[j+1:]
+		}
+
+		if j := strings.LastIndex(hostport, "@"); j >= 0 {
+			user, hostport = hostport[:j], hostport[j+1:]
+		}
+
+		if user != "" && gs.Scheme == GitSchemeHTTPS {
+			return nil, fmt.Errorf("credentials in https git urls are not supported (`%s`): use a credential helper instead", uri)
+		}
+
+	case gitSCPExp.MatchString(uri):
+		m := gitSCPExp.FindStringSubmatch(uri)
 		gs.Scheme = GitSchemeSSH
-	case reMatch(gitHTTPSSubgroup, uri):
-		gs, version = match(uri, gitHTTPSSubgroup)
-		gs.Scheme = GitSchemeHTTPS
-	case reMatch(gitHTTPSExp, uri):
-		gs, version = match(uri, gitHTTPSExp)
-		gs.Scheme = GitSchemeHTTPS
+		user, hostport, path = m[1], m[2], m[3]
+
 	default:
-		return nil
+		hostport, path = uri, ""
+		if j := strings.Index(uri, "/"); j >= 0 {
+			hostport, path = uri[:j], uri[j+1:]
+		}
+		if !gitHostTLDExp.MatchString(hostport) {
+			return nil, fmt.Errorf("`%s` is not a valid git url: host `%s` must have a top level domain or an explicit scheme like https:// must be given", uri, hostport)
+		}
+		gs.Scheme = GitSchemeHTTPS
+	}
+
+	if user != "" && user != "git" {
+		return nil, fmt.Errorf("unsupported ssh user `%s` in `%s`: only `git` is supported", user, uri)
+	}
+
+	gs.Host = hostport
+	if host, port, err := net.SplitHostPort(hostport); err == nil {
+		if !gitPortExp.MatchString(port) {
+			return nil, fmt.Errorf("invalid port `%s` in git url `%s`", port, uri)
+		}
+		gs.Host, gs.Port = host, port
+	}
+	if !gitHostExp.MatchString(gs.Host) {
+		return nil, fmt.Errorf("invalid host `%s` in git url `%s`", gs.Host, uri)
+	}
+
+	d := Dependency{
+		Version: "master",
+		Source:  Source{GitSource: gs},
+	}
+
+	if i := strings.LastIndex(path, "@"); i >= 0 {
+		path, d.Version = path[:i], path[i+1:]
+		if d.Version == "" {
+			return nil, fmt.Errorf("empty version in git url `%s`", uri)
+		}
 	}
 
-	if gs.Subdir != "" {
-		gs.Subdir = "/" + gs.Subdir
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	for _, s := range segments {
+		if !gitSegmentExp.MatchString(s) {
+			return nil, fmt.Errorf("invalid path `%s` in git url `%s`", path, uri)
+		}
+	}
+
+	repo := gitRepoIndex(gs.Host, segments)
+	if repo < 1 || repo >= len(segments) {
+		return nil, fmt.Errorf("`%s` is not a valid git url: it must contain at least a user (or group) and a repository, e.g. `%s/user/repo`", uri, gs.Host)
 	}
 
-	d.Source.GitSource = gs
-	if version != "" {
-		d.Version = version
+	gs.User = strings.Join(segments[:repo], "/")
+	gs.Repo = strings.TrimSuffix(segments[repo], ".git")
+	if repo+1 < len(segments) {
+		gs.Subdir = "/" + strings.Join(segments[repo+1:], "/")
 	}
-	return &d
+
+	return &d, nil
 }
 
-func match(p string, exp string) (gs *Git, version string) {
-	gs = &Git{}
-	exps := []*regexp.Regexp{
-		regexp.MustCompile(exp + PathAndVersionRegex),
-		regexp.MustCompile(exp + PathRegex),
-		regexp.MustCompile(exp + VersionRegex),
-		regexp.MustCompile(exp),
+// parseGitFile parses git repositories on the local disk, such as
+// `file:///srv/mirrors/repo.git/subdir@v1`. The repository is the path up to
+// the first element ending in `.git`, or the whole path if there is none. The
+// version follows an `@` in the last element only, other ones are part of
+// the path.
+func parseGitFile(uri string) (*Dependency, error) {
+	p := strings.TrimPrefix(strings.TrimPrefix(uri, "git+"), GitSchemeFile)
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("`%s` is not a valid git url: file:// urls must contain an absolute path, e.g. file:///srv/repo.git", uri)
 	}
 
-	for _, e := range exps {
-		if !e.MatchString(p) {
-			continue
+	d := Dependency{
+		Version: "master",
+		Source:  Source{GitSource: &Git{Scheme: GitSchemeFile}},
+	}
+	gs := d.Source.GitSource
+
+	if i := strings.LastIndex(p, "@"); i > strings.LastIndex(p, "/") {
+		p, d.Version = p[:i], p[i+1:]
+		if d.Version == "" {
+			return nil, fmt.Errorf("empty version in git url `%s`", uri)
 		}
+	}
 
-		matches := reSubMatchMap(e, p)
-		gs.Host = matches["host"]
-		gs.User = matches["user"]
-		gs.Repo = matches["repo"]
+	segments := strings.Split(strings.Trim(path.Clean(p), "/"), "/")
+	if len(segments) == 0 || segments[0] == "" {
+		return nil, fmt.Errorf("`%s` is not a valid git url: missing repository path", uri)
+	}
 
-		if sd, ok := matches["subdir"]; ok {
-			gs.Subdir = sd
+	repo := len(segments) - 1
+	for i, s := range segments {
+		if strings.HasSuffix(s, ".git") && s != ".git" {
+			repo = i
+			break
 		}
+	}
 
-		return gs, matches["version"]
+	gs.User = strings.Join(segments[:repo], "/")
+	gs.Repo = segments[repo]
+	if repo+1 < len(segments) {
+		gs.Subdir = "/" + strings.Join(segments[repo+1:], "/")
 	}
-	return gs, ""
-}
 
-func reMatch(exp string, str string) bool {
-	return regexp.MustCompile(exp).MatchString(str)
+	return &d, nil
 }
 
-func reSubMatchMap(r *regexp.Regexp, str string) map[string]string {
-	match := r.FindStringSubmatch(str)
-	subMatchMap := make(map[string]string)
-	for i, name := range r.SubexpNames() {
-		if i != 0 {
-			subMatchMap[name] = match[i]
+// gitRepoIndex returns the index of the segment holding the repository name
+func gitRepoIndex(host string, segments []string) int {
+	for i, s := range segments {
+		if strings.HasSuffix(s, ".git") && s != ".git" {
+			return i
+		}
+	}
+
+	for i, s := range segments {
+		if s == "_git" {
+			return i + 1
 		}
 	}
 
-	return subMatchMap
+	// ssh://git@ssh.dev.azure.com/v3/org/project/repo
+	if isAzureDevOpsSSH(host) && len(segments) > 0 && segments[0] == "v3" {
+		return 3
+	}
+
+	return 1
 }
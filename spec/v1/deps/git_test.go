@@ -14,6 +14,7 @@
 package deps
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -237,12 +238,143 @@ func TestParseGit(t *testing.T) {
 			},
 			wantRemote: "https://bitbucket.org/~user/repository.git",
 		},
+		{
+			name: "SSHPort",
+			uri:  "ssh://git@git.corp:2222/team/repo.git/lib@v1",
+			want: &Dependency{
+				Version: "v1",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeSSH,
+					Host:   "git.corp",
+					Port:   "2222",
+					User:   "team",
+					Repo:   "repo",
+					Subdir: "/lib",
+				}},
+			},
+			wantRemote: "ssh://git@git.corp:2222/team/repo.git",
+		},
+		{
+			name: "GitSSHSubgroups",
+			uri:  "git+ssh://git@gitlab.com/group/sub/subsub/repo.git",
+			want: &Dependency{
+				Version: "master",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeSSH,
+					Host:   "gitlab.com",
+					User:   "group/sub/subsub",
+					Repo:   "repo",
+				}},
+			},
+			wantRemote: "ssh://git@gitlab.com/group/sub/subsub/repo.git",
+		},
+		{
+			name: "SCPSubgroups",
+			uri:  "git@gitlab.com:group/sub/repo.git/jsonnet@main",
+			want: &Dependency{
+				Version: "main",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeSSH,
+					Host:   "gitlab.com",
+					User:   "group/sub",
+					Repo:   "repo",
+					Subdir: "/jsonnet",
+				}},
+			},
+			wantRemote: "ssh://git@gitlab.com/group/sub/repo.git",
+		},
+		{
+			name: "GitHTTPSBareHostPort",
+			uri:  "git+https://gitserver:8443/team/repo",
+			want: &Dependency{
+				Version: "master",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeHTTPS,
+					Host:   "gitserver",
+					Port:   "8443",
+					User:   "team",
+					Repo:   "repo",
+				}},
+			},
+			wantRemote: "https://gitserver:8443/team/repo.git",
+		},
+		{
+			name: "AzureDevOpsHTTPS",
+			uri:  "https://dev.azure.com/org/project/_git/repo/lib@v2",
+			want: &Dependency{
+				Version: "v2",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeHTTPS,
+					Host:   "dev.azure.com",
+					User:   "org/project/_git",
+					Repo:   "repo",
+					Subdir: "/lib",
+				}},
+			},
+			wantRemote: "https://dev.azure.com/org/project/_git/repo",
+		},
+		{
+			name: "AzureDevOpsSSH",
+			uri:  "git@ssh.dev.azure.com:v3/org/project/repo/lib",
+			want: &Dependency{
+				Version: "master",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeSSH,
+					Host:   "ssh.dev.azure.com",
+					User:   "v3/org/project",
+					Repo:   "repo",
+					Subdir: "/lib",
+				}},
+			},
+			wantRemote: "ssh://git@ssh.dev.azure.com/v3/org/project/repo",
+		},
+		{
+			name: "FileBare",
+			uri:  "file:///srv/mirrors/libs.git/lib@v1.2",
+			want: &Dependency{
+				Version: "v1.2",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeFile,
+					User:   "srv/mirrors",
+					Repo:   "libs.git",
+					Subdir: "/lib",
+				}},
+			},
+			wantRemote: "file:///srv/mirrors/libs.git",
+		},
+		{
+			name: "FileWorkTree",
+			uri:  "git+file:///home/me/libs",
+			want: &Dependency{
+				Version: "master",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeFile,
+					User:   "home/me",
+					Repo:   "libs",
+				}},
+			},
+			wantRemote: "file:///home/me/libs",
+		},
+		{
+			name: "FileAtInPath",
+			uri:  "file:///home/me@corp/libs.git/lib",
+			want: &Dependency{
+				Version: "master",
+				Source: Source{GitSource: &Git{
+					Scheme: GitSchemeFile,
+					User:   "home/me@corp",
+					Repo:   "libs.git",
+					Subdir: "/lib",
+				}},
+			},
+			wantRemote: "file:///home/me@corp/libs.git",
+		},
 	}
 
 	for _, c := range tests {
 		t.Run(c.name, func(t *testing.T) {
-			got := Parse("", c.uri)
-			require.NotNilf(t, got, "parsed dependency is nil. Most likely, no regex matched the format.")
+			got, err := Parse("", c.uri)
+			require.NoError(t, err)
 
 			assert.Equal(t, c.want, got)
 
@@ -252,3 +384,82 @@ func TestParseGit(t *testing.T) {
 		})
 	}
 }
+
+// TestGitRoundtrip checks that parsing the remote of a parsed package yields the
+// same source again
+func TestGitRoundtrip(t *testing.T) {
+	uris := []string{
+		"github.com/grafana/jsonnet-libs/grafana-builder",
+		"ssh://git@git.corp:2222/team/repo.git",
+		"https://gitserver/group/subgroup/repo.git",
+		"https://dev.azure.com/org/project/_git/repo",
+		"git@ssh.dev.azure.com:v3/org/project/repo",
+		"file:///srv/mirrors/libs.git",
+	}
+
+	for _, uri := range uris {
+		t.Run(uri, func(t *testing.T) {
+			d, err := Parse("", uri)
+			require.NoError(t, err)
+			src := d.Source.GitSource
+
+			again, err := Parse("", src.Remote())
+			require.NoError(t, err)
+			again.Source.GitSource.Subdir = src.Subdir
+
+			assert.Equal(t, src, again.Source.GitSource)
+			assert.Equal(t, src.Name(), again.Source.GitSource.Name())
+		})
+	}
+}
+
+func TestParseGitErrors(t *testing.T) {
+	tests := map[string]string{
+		"ftp://example.com/foo/bar":          "unsupported git scheme",
+		"https://user:pw@example.com/foo/ba": "credentials",
+		"ssh://bob@example.com/foo/bar.git":  "unsupported ssh user",
+		"ssh://git@example.com:ssh/foo/bar":  "invalid port",
+		"https://example.com/foo":            "must contain at least a user",
+		"examplec/foo/bar":                   "top level domain",
+		"example.com/foo bar/baz":            "invalid path",
+		"example.com/foo/bar@":               "empty version",
+		"file://relative/repo.git":           "absolute path",
+	}
+
+	for uri, want := range tests {
+		t.Run(uri, func(t *testing.T) {
+			_, err := parseGit(uri)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), want)
+		})
+	}
+}
+
+func TestGitFileName(t *testing.T) {
+	d, err := Parse("", "file:///srv/mirrors/libs.git/lib")
+	require.NoError(t, err)
+	assert.Equal(t, "libs/lib", d.Name())
+	assert.Equal(t, "lib", d.LegacyName())
+
+	d, err = Parse("", "file:///C:/mirrors/libs.git")
+	require.NoError(t, err)
+	assert.Equal(t, "libs", d.Name())
+}
+
+func TestGitJSONExtras(t *testing.T) {
+	var src Git
+	err := json.Unmarshal([]byte(`{"remote": "https://github.com/foo/bar.git", "subdir": "lib", "submodules": true, "lfs": true}`), &src)
+	require.NoError(t, err)
+	assert.True(t, src.Submodules)
+	assert.True(t, src.LFS)
+
+	b, err := json.Marshal(&src)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"remote": "https://github.com/foo/bar.git", "subdir": "lib", "submodules": true, "lfs": true}`, string(b))
+
+	// both are opt-in and omitted otherwise
+	src.Submodules, src.LFS = false, false
+	b, err = json.Marshal(&src)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"remote": "https://github.com/foo/bar.git", "subdir": "lib"}`, string(b))
+}
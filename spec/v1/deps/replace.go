@@ -0,0 +1,58 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+package deps
+
+// Replace redirects a dependency to a different source, e.g. a fork or a
+// mirror. Similar to Go's `replace` directive, the vendor path and import name
+// of the replaced package stay the same, only the location it is retrieved
+// from changes.
+type Replace struct {
+	// Name of the dependency to replace. This is the name of its source, as
+	// returned by Source.Name(), or the alias it is installed as.
+	Name string `json:"name"`
+	// Version optionally restricts the replacement to dependencies
+	// requesting exactly this version
+	Version string `json:"version,omitempty"`
+
+	// With is the source (and optionally version) to use instead
+	With Dependency `json:"with"`
+}
+
+// Matches returns whether the replacement applies to the given dependency
+func (r Replace) Matches(d Dependency) bool {
+	if r.Name != d.Source.Name() && r.Name != d.Name() {
+		return false
+	}
+	return r.Version == "" || r.Version == d.Version
+}
+
+// Apply returns a copy of d that is retrieved from the replacement source.
+// d.Source is kept so that Name() and LegacyName() stay unchanged.
+func (r Replace) Apply(d Dependency) Dependency {
+	src := r.With.Source
+	d.ReplacedBy = &src
+	if r.With.Version != "" {
+		d.Version = r.With.Version
+	}
+	return d
+}
+
+// FetchSource returns the source the dependency is actually retrieved from,
+// which is the replacement source if one applies
+func (d Dependency) FetchSource() Source {
+	if d.ReplacedBy != nil {
+		return *d.ReplacedBy
+	}
+	return d.Source
+}
@@ -21,7 +21,13 @@ import (
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
-const Version uint = 1
+const (
+	Version uint = 1
+
+	// LockVersion is the version lockfiles are written in. Starting with
+	// version 2, they record how each dependency was resolved.
+	LockVersion uint = 2
+)
 
 // JsonnetFile is the structure of a `.json` file describing a set of jsonnet
 // dependencies. It is used for both, the jsonnetFile and the lockFile.
@@ -31,6 +37,17 @@ type JsonnetFile struct {
 
 	// Symlink files to old location
 	LegacyImports bool
+
+	// Redirect dependencies to different sources
+	Replace []deps.Replace
+
+	// Files the imports are followed from when pruning vendor, as globs
+	// relative to the jsonnetfile. All Jsonnet files of the project are used
+	// if empty.
+	Entrypoints []string
+
+	// Lock marks a lockfile, which is written in LockVersion
+	Lock bool
 }
 
 // New returns a new JsonnetFile with the dependencies map initialized
@@ -47,6 +64,8 @@ type jsonFile struct {
 	Version       uint              `json:"version"`
 	Dependencies  []deps.Dependency `json:"dependencies"`
 	LegacyImports bool              `json:"legacyImports"`
+	Replace       []deps.Replace    `json:"replace,omitempty"`
+	Entrypoints   []string          `json:"entrypoints,omitempty"`
 }
 
 // UnmarshalJSON unmarshals a `jsonFile`'s json into a JsonnetFile
@@ -60,10 +79,18 @@ func (jf *JsonnetFile) UnmarshalJSON(data []byte) error {
 
 	jf.Dependencies = make(map[string]deps.Dependency)
 	for _, d := range s.Dependencies {
+		if d.Alias != "" {
+			if err := deps.ValidateAlias(d.Alias); err != nil {
+				return err
+			}
+		}
 		jf.Dependencies[d.Name()] = d
 	}
 
 	jf.LegacyImports = s.LegacyImports
+	jf.Replace = s.Replace
+	jf.Entrypoints = s.Entrypoints
+	jf.Lock = s.Version >= LockVersion
 
 	return nil
 }
@@ -73,7 +100,12 @@ func (jf JsonnetFile) MarshalJSON() ([]byte, error) {
 	var s jsonFile
 
 	s.Version = Version
+	if jf.Lock {
+		s.Version = LockVersion
+	}
 	s.LegacyImports = jf.LegacyImports
+	s.Replace = jf.Replace
+	s.Entrypoints = jf.Entrypoints
 
 	for _, d := range jf.Dependencies {
 		s.Dependencies = append(s.Dependencies, d)
@@ -116,3 +116,87 @@ func TestRemarshal(t *testing.T) {
 
 	assert.Equal(t, jf, dst)
 }
+
+const jsonReplaceJF = `{
+  "version": 1,
+  "dependencies": [],
+  "legacyImports": true,
+  "replace": [
+    {
+      "name": "github.com/grafana/jsonnet-libs/grafana-builder",
+      "version": "master",
+      "with": {
+        "source": {
+          "git": {
+            "remote": "https://github.com/fork/jsonnet-libs.git",
+            "subdir": "grafana-builder"
+          }
+        },
+        "version": "fix"
+      }
+    }
+  ]
+}`
+
+// TestReplace checks that replace directives survive a roundtrip
+func TestReplace(t *testing.T) {
+	var dst JsonnetFile
+	err := json.Unmarshal([]byte(jsonReplaceJF), &dst)
+	require.NoError(t, err)
+
+	require.Len(t, dst.Replace, 1)
+	assert.Equal(t, "github.com/grafana/jsonnet-libs/grafana-builder", dst.Replace[0].Name)
+	assert.Equal(t, "fork", dst.Replace[0].With.Source.GitSource.User)
+
+	data, err := json.Marshal(dst)
+	require.NoError(t, err)
+	assert.JSONEq(t, jsonReplaceJF, string(data))
+}
+
+// TestLockVersion checks that lockfiles are written in LockVersion and
+// recognized as such
+func TestLockVersion(t *testing.T) {
+	jf := testData()
+	jf.Lock = true
+
+	data, err := json.Marshal(jf)
+	require.NoError(t, err)
+
+	var versions struct {
+		Version uint `json:"version"`
+	}
+	require.NoError(t, json.Unmarshal(data, &versions))
+	assert.Equal(t, LockVersion, versions.Version)
+
+	var dst JsonnetFile
+	require.NoError(t, json.Unmarshal(data, &dst))
+	assert.Equal(t, jf, dst)
+}
+
+// TestAlias checks that aliased dependencies are keyed by their alias, so
+// that the same source can be required twice
+func TestAlias(t *testing.T) {
+	const aliasJF = `{
+  "version": 1,
+  "dependencies": [
+    {"source": {"git": {"remote": "https://github.com/grafana/grafonnet.git", "subdir": "gen/grafonnet-latest"}}, "version": "main"},
+    {"source": {"git": {"remote": "https://github.com/grafana/grafonnet.git", "subdir": "gen/grafonnet-latest"}}, "version": "v9", "as": "grafonnet-v9"}
+  ],
+  "legacyImports": false
+}`
+
+	var dst JsonnetFile
+	require.NoError(t, json.Unmarshal([]byte(aliasJF), &dst))
+	require.Len(t, dst.Dependencies, 2)
+	assert.Equal(t, "main", dst.Dependencies["github.com/grafana/grafonnet/gen/grafonnet-latest"].Version)
+	assert.Equal(t, "v9", dst.Dependencies["grafonnet-v9"].Version)
+
+	data, err := json.Marshal(dst)
+	require.NoError(t, err)
+	assert.JSONEq(t, aliasJF, string(data))
+
+	for _, alias := range []string{"/abs", "../outside", "a/../../b", "a//b", ".tmp"} {
+		err := json.Unmarshal([]byte(`{"version": 1, "dependencies": [{"source": {"local": {"directory": "a"}}, "version": "", "as": "`+alias+`"}]}`), &dst)
+		assert.Error(t, err, alias)
+	}
+}
@@ -29,7 +29,11 @@ func FromV0(mv0 v0.JsonnetFile) (JsonnetFile, error) {
 
 		switch {
 		case old.Source.GitSource != nil:
-			d = *deps.Parse("", old.Source.GitSource.Remote)
+			parsed, err := deps.Parse("", old.Source.GitSource.Remote)
+			if err != nil {
+				return m, err
+			}
+			d = *parsed
 
 			if old.Source.GitSource.Subdir != "" {
 				subdir := filepath.Clean("/" + old.Source.GitSource.Subdir)
@@ -37,7 +41,11 @@ func FromV0(mv0 v0.JsonnetFile) (JsonnetFile, error) {
 			}
 
 		case old.Source.LocalSource != nil:
-			d = *deps.Parse("", old.Source.LocalSource.Directory)
+			d = deps.Dependency{
+				Source: deps.Source{
+					LocalSource: &deps.Local{Directory: filepath.Clean(old.Source.LocalSource.Directory)},
+				},
+			}
 		}
 
 		d.Sum = old.Sum
@@ -0,0 +1,82 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spec
+
+import (
+	"encoding/json"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// Workspace is the structure of a `jsonnetworkspace.json` file. It groups
+// several directories containing a jsonnetfile.json (members), whose
+// dependencies are resolved together and vendored into a single directory at
+// the root of the workspace.
+type Workspace struct {
+	// Directories of the members, relative to the workspace root
+	Members []string
+
+	// Symlink files to old location
+	LegacyImports bool
+
+	// Redirect dependencies of all members to different sources
+	Replace []deps.Replace
+}
+
+// NewWorkspace returns a new, empty Workspace
+func NewWorkspace() Workspace {
+	return Workspace{
+		Members:       []string{},
+		LegacyImports: true,
+	}
+}
+
+type jsonWorkspace struct {
+	Version       uint           `json:"version"`
+	Members       []string       `json:"members"`
+	LegacyImports bool           `json:"legacyImports"`
+	Replace       []deps.Replace `json:"replace,omitempty"`
+}
+
+// UnmarshalJSON unmarshals a `jsonWorkspace`'s json into a Workspace
+func (ws *Workspace) UnmarshalJSON(data []byte) error {
+	s := jsonWorkspace{LegacyImports: true}
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	ws.Members = s.Members
+	if ws.Members == nil {
+		ws.Members = []string{}
+	}
+	ws.LegacyImports = s.LegacyImports
+	ws.Replace = s.Replace
+	return nil
+}
+
+// MarshalJSON serializes a Workspace into json of the format of a
+// `jsonWorkspace`
+func (ws Workspace) MarshalJSON() ([]byte, error) {
+	s := jsonWorkspace{
+		Version:       Version,
+		Members:       ws.Members,
+		LegacyImports: ws.LegacyImports,
+		Replace:       ws.Replace,
+	}
+	if s.Members == nil {
+		s.Members = []string{}
+	}
+	return json.Marshal(s)
+}
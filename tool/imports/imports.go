@@ -0,0 +1,208 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package imports checks that the imports of a project are backed by the
+// dependencies declared in its jsonnetfile
+package imports
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/tool/rewrite"
+)
+
+// Kinds of problems
+const (
+	// Undeclared is an import of a package that is only installed as a
+	// dependency of another one
+	Undeclared = "undeclared"
+	// Unresolved is an import of a file that does not exist
+	Unresolved = "unresolved"
+	// Unused is a direct dependency that is never imported
+	Unused = "unused"
+	// Unparsed is a file that is no valid Jsonnet, its imports are unknown
+	Unparsed = "unparsed"
+)
+
+// Problem is an import or dependency found by Check
+type Problem struct {
+	Kind string
+
+	// File, Line and Column of the import. File is relative to the project
+	// and empty for Unused dependencies.
+	File   string
+	Line   int
+	Column int
+
+	// Import is the imported path
+	Import string
+	// Package is the name of the imported or unused package
+	Package string
+
+	// Error is why an Unparsed file could not be parsed
+	Error string
+}
+
+func (p Problem) String() string {
+	var msg string
+	switch p.Kind {
+	case Undeclared:
+		msg = fmt.Sprintf("`%s` imports %s, which is not a direct dependency", p.Import, p.Package)
+	case Unresolved:
+		msg = fmt.Sprintf("`%s` cannot be resolved", p.Import)
+	case Unused:
+		msg = fmt.Sprintf("dependency %s is never imported", p.Package)
+	case Unparsed:
+		msg = fmt.Sprintf("cannot be parsed: %s", p.Error)
+	}
+
+	switch {
+	case p.File == "":
+		return msg
+	case p.Line == 0:
+		return fmt.Sprintf("%s: %s", p.File, msg)
+	}
+	return fmt.Sprintf("%s:%d:%d: %s", p.File, p.Line, p.Column, msg)
+}
+
+// Check parses the Jsonnet files of the project in dir, except those in
+// vendorDir, and maps each import to a package of the lockfile. Imports are
+// resolved like the Jsonnet interpreter does with the library paths vendorDir
+// and jpath: relative to the importing file first, then in the library paths.
+// Files that cannot be parsed are reported as Unparsed, unused dependencies
+// are not reported then.
+func Check(dir, vendorDir string, jpath []string, jsonnetFile, lockFile v1.JsonnetFile) ([]Problem, error) {
+	files, err := rewrite.Files(dir, vendorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	r := resolver{
+		packages: make(map[string]string),
+		paths:    []string{filepath.Join(dir, vendorDir)},
+	}
+	for name, d := range lockFile.Dependencies {
+		r.packages[name] = name
+		if jsonnetFile.LegacyImports && d.LegacyName() != name {
+			r.packages[d.LegacyName()] = name
+		}
+	}
+	for _, p := range jpath {
+		if !filepath.IsAbs(p) {
+			p = filepath.Join(dir, p)
+		}
+		r.paths = append(r.paths, p)
+	}
+
+	var problems []Problem
+	unparsed := false
+	imported := make(map[string]bool)
+	for _, f := range files {
+		data, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+
+		rel, err := filepath.Rel(dir, f)
+		if err != nil {
+			rel = f
+		}
+
+		found, err := rewrite.Imports(rel, data)
+		if err != nil {
+			problems = append(problems, Problem{Kind: Unparsed, File: rel, Error: err.Error()})
+			unparsed = true
+			continue
+		}
+
+		for _, imp := range found {
+			pkg, ok := r.resolve(filepath.Dir(f), imp.Path)
+			if pkg != "" {
+				imported[pkg] = true
+			}
+
+			_, declared := jsonnetFile.Dependencies[pkg]
+
+			p := Problem{File: rel, Line: imp.Line, Column: imp.Column, Import: imp.Path, Package: pkg}
+			switch {
+			case !ok:
+				p.Kind = Unresolved
+			case pkg != "" && !declared:
+				p.Kind = Undeclared
+			default:
+				continue
+			}
+			problems = append(problems, p)
+		}
+	}
+
+	// dependencies might be imported by the files that could not be parsed
+	var unused []Problem
+	for name := range jsonnetFile.Dependencies {
+		if !imported[name] && !unparsed {
+			unused = append(unused, Problem{Kind: Unused, Package: name})
+		}
+	}
+	sort.Slice(unused, func(i, j int) bool {
+		return unused[i].Package < unused[j].Package
+	})
+
+	return append(problems, unused...), nil
+}
+
+// resolver finds the package of imports
+type resolver struct {
+	// packages are the names of the locked packages by their vendor path,
+	// including legacy names
+	packages map[string]string
+	// paths are the library paths, vendor first
+	paths []string
+}
+
+// resolve returns the package file is imported from. It is empty if the
+// file is not part of a package. ok is false if the file does not exist.
+func (r resolver) resolve(dir, file string) (pkg string, ok bool) {
+	if path.IsAbs(file) {
+		return "", exists(file)
+	}
+	if exists(filepath.Join(dir, file)) {
+		return "", true
+	}
+
+	// the longest vendor path that is a prefix of the import
+	for prefix := path.Dir(file); prefix != "."; prefix = path.Dir(prefix) {
+		if name, ok := r.packages[prefix]; ok {
+			// legacy names are symlinks to the vendor path of the package
+			return name, exists(filepath.Join(r.paths[0], name, file[len(prefix):]))
+		}
+	}
+
+	for _, p := range r.paths {
+		if exists(filepath.Join(p, file)) {
+			return "", true
+		}
+	}
+	return "", false
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
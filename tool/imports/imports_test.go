@@ -0,0 +1,105 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package imports
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	v1 "github.com/jsonnet-bundler/jsonnet-bundler/spec/v1"
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+const main = `local util = import 'util.libsonnet';
+local a = import 'github.com/example/a/main.libsonnet';
+local legacy = import 'a/main.libsonnet';
+local b = import 'github.com/example/b/main.libsonnet';
+local lib = importstr 'lib.txt';
+[
+  import 'github.com/example/a/missing.libsonnet',
+  import 'unknown/file.libsonnet',
+  'import "github.com/example/c/main.libsonnet"',
+]
+`
+
+func TestCheck(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jbimports")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for name, content := range map[string]string{
+		"main.jsonnet":   "",
+		"util.libsonnet": "{}",
+		"lib/lib.txt":    "",
+		"vendor/github.com/example/a/main.libsonnet": "{}",
+		"vendor/github.com/example/b/main.libsonnet": "{}",
+		"vendor/github.com/example/b/other.jsonnet":  "import 'unknown.libsonnet'",
+		"vendor/github.com/example/c/main.libsonnet": "{}",
+	} {
+		if name == "main.jsonnet" {
+			content = main
+		}
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), os.ModePerm))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+
+	jsonnetFile := v1.New()
+	lockFile := v1.New()
+	for _, name := range []string{"a", "b", "c"} {
+		d, err := deps.Parse("", "github.com/example/"+name)
+		require.NoError(t, err)
+		if name != "b" {
+			jsonnetFile.Dependencies[d.Name()] = *d
+		}
+		lockFile.Dependencies[d.Name()] = *d
+	}
+
+	problems, err := Check(dir, "vendor", []string{"lib"}, jsonnetFile, lockFile)
+	require.NoError(t, err)
+
+	assert.Equal(t, []Problem{
+		{Kind: Undeclared, File: "main.jsonnet", Line: 4, Column: 18, Import: "github.com/example/b/main.libsonnet", Package: "github.com/example/b"},
+		{Kind: Unresolved, File: "main.jsonnet", Line: 7, Column: 10, Import: "github.com/example/a/missing.libsonnet", Package: "github.com/example/a"},
+		{Kind: Unresolved, File: "main.jsonnet", Line: 8, Column: 10, Import: "unknown/file.libsonnet"},
+		{Kind: Unused, Package: "github.com/example/c"},
+	}, problems)
+
+	assert.Equal(t, "main.jsonnet:4:18: `github.com/example/b/main.libsonnet` imports github.com/example/b, which is not a direct dependency", problems[0].String())
+	assert.Equal(t, "dependency github.com/example/c is never imported", problems[3].String())
+
+	// legacy names are only resolved if enabled
+	jsonnetFile.LegacyImports = false
+	problems, err = Check(dir, "vendor", []string{"lib"}, jsonnetFile, lockFile)
+	require.NoError(t, err)
+	assert.Len(t, problems, 5)
+
+	// broken files are reported, but don't stop the check
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "broken.jsonnet"), []byte("{"), 0644))
+	problems, err = Check(dir, "vendor", []string{"lib"}, jsonnetFile, lockFile)
+	require.NoError(t, err)
+	require.NotEmpty(t, problems)
+	assert.Equal(t, Unparsed, problems[0].Kind)
+	assert.Equal(t, "broken.jsonnet", problems[0].File)
+	assert.Contains(t, problems[0].String(), "broken.jsonnet: cannot be parsed: broken.jsonnet:")
+	for _, p := range problems {
+		assert.NotEqual(t, Unused, p.Kind)
+	}
+}
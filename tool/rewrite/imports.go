@@ -0,0 +1,145 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package rewrite
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	jsonnet "github.com/google/go-jsonnet"
+	"github.com/google/go-jsonnet/ast"
+)
+
+// Kinds of imports
+const (
+	KindImport    = "import"
+	KindImportStr = "importstr"
+	KindImportBin = "importbin"
+)
+
+// Import is an import expression of a Jsonnet file
+type Import struct {
+	// Kind is one of KindImport, KindImportStr and KindImportBin
+	Kind string
+	// Path is the imported path, with escape sequences resolved
+	Path string
+
+	// Line and Column of the path literal, starting at 1
+	Line   int
+	Column int
+
+	// offsets of the path literal, including its quotes
+	begin, end int
+}
+
+// Imports returns the imports of the Jsonnet file name with the contents data,
+// in the order they appear in
+func Imports(name string, data []byte) ([]Import, error) {
+	node, err := jsonnet.SnippetToAST(name, string(data))
+	if err != nil {
+		return nil, err
+	}
+
+	// offsets of the beginning of each line
+	lines := []int{0}
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	offset := func(l ast.Location) int {
+		// columns count bytes
+		return lines[l.Line-1] + l.Column - 1
+	}
+
+	seen := make(map[int]bool)
+	var imports []Import
+	walk(reflect.ValueOf(node), func(kind string, lit *ast.LiteralString) {
+		loc := lit.Loc()
+		imp := Import{
+			Kind:   kind,
+			Path:   lit.Value,
+			Line:   loc.Begin.Line,
+			Column: loc.Begin.Column,
+			begin:  offset(loc.Begin),
+			end:    offset(loc.End),
+		}
+
+		// desugaring copies object locals into every field
+		if seen[imp.begin] {
+			return
+		}
+		seen[imp.begin] = true
+		imports = append(imports, imp)
+	})
+
+	sort.Slice(imports, func(i, j int) bool {
+		return imports[i].begin < imports[j].begin
+	})
+	return imports, nil
+}
+
+var locationRange = reflect.TypeOf(ast.LocationRange{})
+
+// walk calls found for every import in the AST at v. Unlike
+// toolutils.Children, it covers all nodes of desugared ASTs, such as the
+// asserts of objects.
+func walk(v reflect.Value, found func(kind string, lit *ast.LiteralString)) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return
+		}
+		switch n := v.Interface().(type) {
+		case *ast.Import:
+			found(KindImport, n.File)
+			return
+		case *ast.ImportStr:
+			found(KindImportStr, n.File)
+			return
+		case *ast.ImportBin:
+			found(KindImportBin, n.File)
+			return
+		}
+		walk(v.Elem(), found)
+	case reflect.Struct:
+		if v.Type() == locationRange {
+			return
+		}
+		for i := 0; i < v.NumField(); i++ {
+			walk(v.Field(i), found)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			walk(v.Index(i), found)
+		}
+	}
+}
+
+// quote formats s as a string literal in the same style as the literal raw
+func quote(raw, s string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `@"`), strings.HasPrefix(raw, `@'`):
+		q := raw[1:2]
+		return "@" + q + strings.ReplaceAll(s, q, q+q) + q, nil
+	case strings.HasPrefix(raw, `"`), strings.HasPrefix(raw, `'`):
+		q := raw[:1]
+		s = strings.ReplaceAll(s, `\`, `\\`)
+		return q + strings.ReplaceAll(s, q, `\`+q) + q, nil
+	}
+	return "", fmt.Errorf("unexpected string literal %s", raw)
+}
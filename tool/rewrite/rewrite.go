@@ -17,21 +17,51 @@
 package rewrite
 
 import (
-	"fmt"
+	"bytes"
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
 
 	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
 )
 
-var expr = regexp.MustCompile(`(?mU)(import ["'])(.*)(\/.*["'])`)
-
 // Rewrite changes all imports in `dir` from legacy to absolute style
-// All files in `vendorDir` are ignored
+// All files in `vendorDir` are ignored, and so are files that can't be parsed
 func Rewrite(dir, vendorDir string, packages map[string]deps.Dependency) error {
+	changes, _, err := Changes(dir, vendorDir, packages)
+	if err != nil {
+		return err
+	}
+	return Apply(changes)
+}
+
+// Apply writes the new contents of the changed files
+func Apply(changes []Change) error {
+	for _, c := range changes {
+		if err := ioutil.WriteFile(c.File, c.New, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Change is a file whose imports are rewritten
+type Change struct {
+	File string
+	Old  []byte
+	New  []byte
+}
+
+// Skipped is a file left as is, as it could not be parsed
+type Skipped struct {
+	File string
+	Err  error
+}
+
+// Changes returns the files Rewrite would change, without writing them, and
+// those it skips
+func Changes(dir, vendorDir string, packages map[string]deps.Dependency) ([]Change, []Skipped, error) {
 	imports := make(map[string]string)
 	for _, p := range packages {
 		if p.LegacyName() == p.Name() {
@@ -41,12 +71,38 @@ func Rewrite(dir, vendorDir string, packages map[string]deps.Dependency) error {
 		imports[p.LegacyName()] = p.Name()
 	}
 
+	files, err := Files(dir, vendorDir)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var changes []Change
+	var skipped []Skipped
+	for _, f := range files {
+		old, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		new, err := replace(f, old, imports)
+		if err != nil {
+			skipped = append(skipped, Skipped{File: f, Err: err})
+			continue
+		}
+		if !bytes.Equal(old, new) {
+			changes = append(changes, Change{File: f, Old: old, New: new})
+		}
+	}
+	return changes, skipped, nil
+}
+
+// Files lists all Jsonnet files in `dir`, except those in `vendorDir`
+func Files(dir, vendorDir string) ([]string, error) {
 	vendorFi, err := os.Stat(filepath.Join(dir, vendorDir))
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	// list all Jsonnet files
 	files := []string{}
 	if err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -62,66 +118,42 @@ func Rewrite(dir, vendorDir string, packages map[string]deps.Dependency) error {
 		}
 		return nil
 	}); err != nil {
-		return err
-	}
-
-	// change the imports
-	for _, s := range files {
-		if err := replaceFile(s, imports); err != nil {
-			return err
-		}
+		return nil, err
 	}
 
-	return nil
-}
-
-func wrap(s, q string) string {
-	return fmt.Sprintf(`import %s%s`, q, s)
+	return files, nil
 }
 
-func replaceFile(name string, imports map[string]string) error {
-	raw, err := ioutil.ReadFile(name)
+// replace rewrites the imports of the Jsonnet file name whose first path
+// segment is a legacy name. Everything but the import paths is left as is.
+func replace(name string, data []byte, imports map[string]string) ([]byte, error) {
+	found, err := Imports(name, data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	out := replace(string(raw), imports)
-	return ioutil.WriteFile(name, out, 0644)
-}
-
-func replace(data string, imports map[string]string) []byte {
-	contents := strings.Split(string(data), "\n")
-
-	// try to fix imports line by line
-	buf := make([]string, 0, len(contents))
-	for _, line := range contents {
-		match := expr.FindStringSubmatch(line)
-		// no import in this line: push unmodified
-		if len(match) == 0 {
-			buf = append(buf, line)
+	var out bytes.Buffer
+	last := 0
+	for _, imp := range found {
+		i := strings.Index(imp.Path, "/")
+		if i < 0 {
 			continue
 		}
-
-		// the legacyName
-		matchedName := match[2]
-
-		replaced := false
-		for legacy, absolute := range imports {
-			// not this import
-			if matchedName != legacy {
-				continue
-			}
-
-			// fix the import
-			replaced = true
-			buf = append(buf, expr.ReplaceAllString(line, "${1}"+absolute+"${3}"))
+		absolute, ok := imports[imp.Path[:i]]
+		if !ok {
+			continue
 		}
 
-		// no matching known import found? push unmodified
-		if !replaced {
-			buf = append(buf, line)
+		lit, err := quote(string(data[imp.begin:imp.end]), absolute+imp.Path[i:])
+		if err != nil {
+			return nil, err
 		}
+
+		out.Write(data[last:imp.begin])
+		out.WriteString(lit)
+		last = imp.end
 	}
+	out.Write(data[last:])
 
-	return []byte(strings.Join(buf, "\n"))
+	return out.Bytes(), nil
 }
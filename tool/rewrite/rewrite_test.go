@@ -82,7 +82,109 @@ func testRewriteWithJsonnetHome(t *testing.T, jsonnetHome string) {
 }
 
 var locks = map[string]deps.Dependency{
-	"ksonnet":        *deps.Parse("", "github.com/ksonnet/ksonnet"),
-	"ksonnet.beta.4": *deps.Parse("", "github.com/ksonnet/ksonnet-lib/ksonnet.beta.4"),
-	"prometheus":     *deps.Parse("", "github.com/prometheus/prometheus"),
+	"ksonnet":        mustParse("github.com/ksonnet/ksonnet"),
+	"ksonnet.beta.4": mustParse("github.com/ksonnet/ksonnet-lib/ksonnet.beta.4"),
+	"prometheus":     mustParse("github.com/prometheus/prometheus"),
+}
+
+func mustParse(uri string) deps.Dependency {
+	d, err := deps.Parse("", uri)
+	if err != nil {
+		panic(err)
+	}
+	return *d
+}
+
+func TestReplace(t *testing.T) {
+	imports := map[string]string{
+		"ksonnet":    "github.com/ksonnet/ksonnet",
+		"prometheus": "github.com/prometheus/prometheus",
+	}
+
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "kinds",
+			in:   `[importstr "ksonnet/a.txt", importbin 'ksonnet/b.bin', import @"ksonnet/c.libsonnet"]`,
+			want: `[importstr "github.com/ksonnet/ksonnet/a.txt", importbin 'github.com/ksonnet/ksonnet/b.bin', import @"github.com/ksonnet/ksonnet/c.libsonnet"]`,
+		},
+		{
+			name: "several per line",
+			in:   `(import "ksonnet/a.libsonnet") + (import "prometheus/b.libsonnet")`,
+			want: `(import "github.com/ksonnet/ksonnet/a.libsonnet") + (import "github.com/prometheus/prometheus/b.libsonnet")`,
+		},
+		{
+			name: "split over lines",
+			in:   "local a = import\n  // the library\n  'ksonnet/a.libsonnet';\na",
+			want: "local a = import\n  // the library\n  'github.com/ksonnet/ksonnet/a.libsonnet';\na",
+		},
+		{
+			name: "strings looking like imports",
+			in:   "{\n  a: 'import \"ksonnet/a.libsonnet\"',\n  b: |||\n    import \"ksonnet/b.libsonnet\"\n  |||,\n  // import \"ksonnet/c.libsonnet\"\n}\n",
+			want: "{\n  a: 'import \"ksonnet/a.libsonnet\"',\n  b: |||\n    import \"ksonnet/b.libsonnet\"\n  |||,\n  // import \"ksonnet/c.libsonnet\"\n}\n",
+		},
+		{
+			name: "object locals and asserts",
+			in:   "{\n  local k = import 'ksonnet/k.libsonnet',\n  assert import 'prometheus/check.libsonnet',\n  a: k, b: k,\n}\n",
+			want: "{\n  local k = import 'github.com/ksonnet/ksonnet/k.libsonnet',\n  assert import 'github.com/prometheus/prometheus/check.libsonnet',\n  a: k, b: k,\n}\n",
+		},
+		{
+			name: "escapes",
+			in:   `import "ksonnet/é.libsonnet"`,
+			want: `import "github.com/ksonnet/ksonnet/é.libsonnet"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := replace("test.jsonnet", []byte(tc.in), imports)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, string(got))
+		})
+	}
+
+	_, err := replace("test.jsonnet", []byte(`import "ksonnet/a.libsonnet" +`), imports)
+	assert.Error(t, err)
+}
+
+func TestImports(t *testing.T) {
+	imports, err := Imports("test.jsonnet", []byte("local a = importstr 'a.txt';\n[a, import\n  \"b/c.libsonnet\"]\n"))
+	require.NoError(t, err)
+
+	require.Len(t, imports, 2)
+	assert.Equal(t, Import{Kind: KindImportStr, Path: "a.txt", Line: 1, Column: 21, begin: 20, end: 27}, imports[0])
+	assert.Equal(t, Import{Kind: KindImport, Path: "b/c.libsonnet", Line: 3, Column: 3, begin: 42, end: 57}, imports[1])
+}
+
+func TestRewriteSkipsBrokenFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "jbrewrite")
+	require.Nil(t, err)
+	defer os.RemoveAll(dir)
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "vendor"), os.ModePerm))
+
+	name := filepath.Join(dir, "test.jsonnet")
+	broken := filepath.Join(dir, "broken.jsonnet")
+	require.NoError(t, ioutil.WriteFile(name, []byte(sample), 0644))
+	require.NoError(t, ioutil.WriteFile(broken, []byte(`import "ksonnet/a.libsonnet" +`), 0644))
+
+	changes, skipped, err := Changes(dir, "vendor", locks)
+	require.NoError(t, err)
+	require.Len(t, changes, 1)
+	assert.Equal(t, name, changes[0].File)
+	require.Len(t, skipped, 1)
+	assert.Equal(t, broken, skipped[0].File)
+	assert.Error(t, skipped[0].Err)
+
+	// the others are rewritten regardless
+	require.NoError(t, Rewrite(dir, "vendor", locks))
+
+	content, err := ioutil.ReadFile(name)
+	require.NoError(t, err)
+	assert.Equal(t, want, string(content))
+	content, err = ioutil.ReadFile(broken)
+	require.NoError(t, err)
+	assert.Equal(t, `import "ksonnet/a.libsonnet" +`, string(content))
 }
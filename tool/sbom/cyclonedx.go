@@ -0,0 +1,148 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import "time"
+
+// CycloneDX is a CycloneDX 1.5 document, as far as it is generated
+type CycloneDX struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string       `json:"timestamp"`
+	Tools     cdxTools     `json:"tools"`
+	Component cdxComponent `json:"component"`
+}
+
+type cdxTools struct {
+	Components []cdxComponent `json:"components"`
+}
+
+type cdxComponent struct {
+	Type               string        `json:"type"`
+	BOMRef             string        `json:"bom-ref,omitempty"`
+	Name               string        `json:"name"`
+	Version            string        `json:"version,omitempty"`
+	PURL               string        `json:"purl,omitempty"`
+	Hashes             []cdxHash     `json:"hashes,omitempty"`
+	Licenses           []cdxLicense  `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternal `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty `json:"properties,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxLicense struct {
+	License cdxLicenseID `json:"license"`
+}
+
+type cdxLicenseID struct {
+	ID string `json:"id"`
+}
+
+type cdxExternal struct {
+	Type   string    `json:"type"`
+	URL    string    `json:"url"`
+	Hashes []cdxHash `json:"hashes,omitempty"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+// cycloneDX describes the components as CycloneDX document. Components are
+// referenced by their name, the project by `.`, as in the lockfile.
+func cycloneDX(components []Component, opts Options) CycloneDX {
+	bom := CycloneDX{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Metadata: cdxMetadata{
+			Timestamp: opts.Created.UTC().Format(time.RFC3339),
+			Tools: cdxTools{Components: []cdxComponent{
+				{Type: "application", Name: "jb", Version: opts.ToolVersion},
+			}},
+			Component: cdxComponent{Type: "application", BOMRef: ".", Name: opts.Name},
+		},
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+
+	dependsOn := map[string][]string{".": {}}
+	for _, c := range components {
+		dependsOn[c.Name] = []string{}
+	}
+	for _, c := range components {
+		cc := cdxComponent{
+			Type:    "library",
+			BOMRef:  c.Name,
+			Name:    c.Name,
+			Version: c.Version,
+			PURL:    c.PURL,
+		}
+		// the sum of jb is no hash of any artifact
+		if c.ArchiveSHA256 != "" {
+			cc.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.ArchiveSHA256}}
+		}
+		if c.Sum != "" {
+			cc.Properties = []cdxProperty{{Name: "jb:sum", Value: c.Sum}}
+		}
+		for _, id := range c.Licenses {
+			cc.Licenses = append(cc.Licenses, cdxLicense{License: cdxLicenseID{ID: id}})
+		}
+
+		switch {
+		case c.VCS != "":
+			cc.ExternalReferences = []cdxExternal{{Type: "vcs", URL: c.VCS}}
+		case c.Location != "":
+			ref := cdxExternal{Type: "distribution", URL: c.Location}
+			if c.ArchiveSHA256 != "" {
+				ref.Hashes = []cdxHash{{Alg: "SHA-256", Content: c.ArchiveSHA256}}
+			}
+			cc.ExternalReferences = []cdxExternal{ref}
+		}
+		bom.Components = append(bom.Components, cc)
+
+		for _, p := range c.Parents {
+			if _, ok := dependsOn[p]; ok {
+				dependsOn[p] = append(dependsOn[p], c.Name)
+			}
+		}
+	}
+
+	// the project first, then the components in their order
+	bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: ".", DependsOn: dependsOn["."]})
+	for _, c := range components {
+		bom.Dependencies = append(bom.Dependencies, cdxDependency{Ref: c.Name, DependsOn: dependsOn[c.Name]})
+	}
+	return bom
+}
@@ -0,0 +1,103 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// licenseFiles are the names of the files licenses are detected in
+var licenseFiles = regexp.MustCompile(`(?i)^(licen[cs]e|copying)([.\-_].*)?$`)
+
+// spdxIdentifier is the tag of files declaring their license
+var spdxIdentifier = regexp.MustCompile(`SPDX-License-Identifier:\s*([A-Za-z0-9.+\-]+)`)
+
+// licenseTexts identify common licenses by phrases of their text, with
+// whitespace collapsed. All phrases of a license must be present. The more
+// specific ones come first.
+var licenseTexts = []struct {
+	id      string
+	phrases []string
+}{
+	{"Apache-2.0", []string{"Apache License", "Version 2.0"}},
+	{"MPL-2.0", []string{"Mozilla Public License", "2.0"}},
+	{"MIT", []string{"Permission is hereby granted, free of charge"}},
+	{"BSD-3-Clause", []string{"Redistribution and use in source and binary forms", "Neither the name"}},
+	{"BSD-2-Clause", []string{"Redistribution and use in source and binary forms"}},
+	{"ISC", []string{"Permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"Unlicense", []string{"This is free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"CC0 1.0 Universal"}},
+}
+
+// detectLicenses returns the SPDX identifiers of the licenses found in the
+// license files at the top of dir, sorted. Unknown licenses are left out.
+func detectLicenses(dir string) ([]string, error) {
+	files, err := ioutil.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	for _, f := range files {
+		if f.IsDir() || !licenseFiles.MatchString(f.Name()) {
+			continue
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+		if id := identifyLicense(string(data)); id != "" {
+			found[id] = true
+		}
+	}
+
+	ids := make([]string, 0, len(found))
+	for id := range found {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// identifyLicense returns the SPDX identifier of the license text, if known
+func identifyLicense(text string) string {
+	if m := spdxIdentifier.FindStringSubmatch(text); m != nil {
+		return m[1]
+	}
+
+	text = strings.Join(strings.Fields(text), " ")
+	for _, l := range licenseTexts {
+		matches := true
+		for _, p := range l.phrases {
+			if !strings.Contains(text, p) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			return l.id
+		}
+	}
+	return ""
+}
@@ -0,0 +1,232 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package sbom describes the packages of a lockfile as software bill of
+// materials, in the CycloneDX or SPDX format
+package sbom
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+// Formats of Generate
+const (
+	FormatCycloneDX = "cyclonedx"
+	FormatSPDX      = "spdx"
+)
+
+// Options describe the document
+type Options struct {
+	// Name of the project the lockfile belongs to
+	Name string
+	// ToolVersion is the version of jb
+	ToolVersion string
+	// Created is the time of creation
+	Created time.Time
+	// VendorDir holds the installed packages, whose licenses are detected.
+	// Licenses are left out if it is empty.
+	VendorDir string
+}
+
+// Generate returns the document describing the packages of locks in format,
+// one of FormatCycloneDX and FormatSPDX
+func Generate(format string, locks map[string]deps.Dependency, opts Options) (interface{}, error) {
+	components, err := Components(locks, opts.VendorDir)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCycloneDX:
+		return cycloneDX(components, opts), nil
+	case FormatSPDX:
+		return spdx(components, opts), nil
+	}
+	return nil, fmt.Errorf("unknown format `%s`", format)
+}
+
+// Component is a locked package, as described by SBOMs
+type Component struct {
+	// Name is the vendor path of the package
+	Name string
+	// Version is the tag of git packages, if any, or the locked version
+	Version string
+
+	// PURL is the package url identifying the source and version. It is
+	// empty for local packages.
+	PURL string
+	// Location the package is retrieved from, empty for local packages
+	Location string
+	// VCS is the url of the git repository of git packages
+	VCS string
+
+	// Sum is the sum of the vendored files as recorded in the lockfile. It is
+	// specific to jb, hashing the concatenated files rather than an artifact.
+	Sum string
+	// ArchiveSHA256 is the hex encoded sha256 of the archive the files were
+	// extracted from
+	ArchiveSHA256 string
+
+	// Licenses are the SPDX identifiers detected in the license files
+	Licenses []string
+
+	// Parents are the names of the packages requiring this one, `.` being
+	// the project itself
+	Parents []string
+}
+
+// Components returns the packages of locks, sorted by name
+func Components(locks map[string]deps.Dependency, vendorDir string) ([]Component, error) {
+	names := make([]string, 0, len(locks))
+	for name := range locks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	components := make([]Component, 0, len(names))
+	for _, name := range names {
+		l := locks[name]
+		c := Component{
+			Name:          name,
+			Version:       l.Version,
+			Sum:           l.Sum,
+			ArchiveSHA256: hexSum(l.ArchiveDigest),
+			Parents:       append([]string(nil), l.Parents...),
+		}
+		if l.Tag != "" {
+			c.Version = l.Tag
+		}
+		sort.Strings(c.Parents)
+
+		src := l.FetchSource()
+		switch {
+		case src.GitSource != nil:
+			c.PURL = gitPURL(src.GitSource, l.Version)
+			c.VCS = src.GitSource.Remote()
+			c.Location = "git+" + c.VCS
+			if l.Version != "" {
+				c.Location += "@" + l.Version
+			}
+			if src.GitSource.Subdir != "" {
+				c.Location += "#" + strings.TrimPrefix(src.GitSource.Subdir, "/")
+			}
+		case src.HttpSource != nil:
+			c.Location = src.HttpSource.Url
+			c.PURL = genericPURL(src.LegacyName(), l.Version, c.Location, c.ArchiveSHA256)
+		case src.GitlabRegistrySource != nil:
+			u := src.GitlabRegistrySource.PackageURL(l.Version)
+			c.Location = u.String()
+			c.PURL = genericPURL(src.GitlabRegistrySource.Package, l.Version, c.Location, c.ArchiveSHA256)
+		}
+
+		if vendorDir != "" {
+			licenses, err := detectLicenses(filepath.Join(vendorDir, filepath.FromSlash(name)))
+			if err != nil {
+				return nil, err
+			}
+			c.Licenses = licenses
+		}
+
+		components = append(components, c)
+	}
+	return components, nil
+}
+
+// hexSum converts the base64 encoded sums of lockfiles to hex
+func hexSum(sum string) string {
+	b, err := base64.StdEncoding.DecodeString(sum)
+	if err != nil || len(b) == 0 {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
+
+// gitPURL returns the package url of a git package. Repositories of GitHub
+// and Bitbucket have types of their own, others are generic ones recording
+// the repository.
+func gitPURL(g *deps.Git, version string) string {
+	repo := strings.TrimSuffix(g.Repo, ".git")
+	subpath := strings.Trim(g.Subdir, "/")
+
+	var purl string
+	switch g.Host {
+	case "github.com", "bitbucket.org":
+		typ := strings.TrimSuffix(g.Host, path.Ext(g.Host))
+		purl = "pkg:" + typ + "/" + escapePath(strings.ToLower(g.User)+"/"+strings.ToLower(repo))
+		if version != "" {
+			purl += "@" + url.PathEscape(version)
+		}
+	default:
+		segments := append([]string{g.Host}, strings.Split(g.User, "/")...)
+		vcs := "git+" + g.Remote()
+		if version != "" {
+			vcs += "@" + version
+		}
+		purl = "pkg:generic/" + escapePath(path.Join(append(segments, repo)...))
+		if version != "" {
+			purl += "@" + url.PathEscape(version)
+		}
+		purl += "?" + url.Values{"vcs_url": {vcs}}.Encode()
+	}
+
+	if subpath != "" {
+		purl += "#" + escapePath(subpath)
+	}
+	return purl
+}
+
+// genericPURL returns the package url of a package downloaded from location
+func genericPURL(name, version, location, sha256 string) string {
+	purl := "pkg:generic/" + url.PathEscape(name)
+	if version != "" {
+		purl += "@" + url.PathEscape(version)
+	}
+
+	q := url.Values{"download_url": {location}}
+	if sha256 != "" {
+		q.Set("checksum", "sha256:"+sha256)
+	}
+	return purl + "?" + q.Encode()
+}
+
+// escapePath percent-encodes the segments of p
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// newUUID returns a random UUID, as documents are identified by
+func newUUID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
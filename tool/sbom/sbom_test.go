@@ -0,0 +1,166 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/jsonnet-bundler/jsonnet-bundler/spec/v1/deps"
+)
+
+const commit = "0123456789abcdef0123456789abcdef01234567"
+
+// sum is the base64 encoded sha256 of nothing
+const sum = "47DEQpj8HBSa+/TImW+5JCeuQeRkm5NMpJWZG3hSuFU="
+const sumHex = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+func testLocks() map[string]deps.Dependency {
+	return map[string]deps.Dependency{
+		"github.com/grafana/grafonnet/gen/grafonnet-latest": {
+			Source: deps.Source{GitSource: &deps.Git{
+				Scheme: deps.GitSchemeHTTPS, Host: "github.com", User: "grafana", Repo: "grafonnet", Subdir: "/gen/grafonnet-latest",
+			}},
+			Version: commit,
+			Tag:     "v0.1.0",
+			Sum:     sum,
+			Parents: []string{"."},
+		},
+		"git.example.com/a/b/lib": {
+			Source:  deps.Source{GitSource: &deps.Git{Scheme: deps.GitSchemeHTTPS, Host: "git.example.com", User: "a/b", Repo: "lib"}},
+			Version: commit,
+			Sum:     sum,
+			Parents: []string{"github.com/grafana/grafonnet/gen/grafonnet-latest"},
+		},
+		"example.com/archive": {
+			Source:        deps.Source{HttpSource: &deps.Http{Url: "https://example.com/archive.tar.gz"}},
+			Sum:           sum,
+			ArchiveDigest: sum,
+			Parents:       []string{"."},
+		},
+		"gitlab.com/lib": {
+			Source:  deps.Source{GitlabRegistrySource: &deps.GitlabRegistry{Project: "group/project", Package: "lib"}},
+			Version: "1.0.0",
+			Parents: []string{"."},
+		},
+		"local": {
+			Source:  deps.Source{LocalSource: &deps.Local{Directory: "local"}},
+			Parents: []string{"."},
+		},
+	}
+}
+
+func TestComponents(t *testing.T) {
+	vendorDir, err := ioutil.TempDir("", "jb-sbom")
+	require.NoError(t, err)
+	defer os.RemoveAll(vendorDir)
+
+	dir := filepath.Join(vendorDir, "github.com", "grafana", "grafonnet", "gen", "grafonnet-latest")
+	require.NoError(t, os.MkdirAll(dir, os.ModePerm))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "LICENSE"), []byte("\n  Apache License\n  Version 2.0, January 2004\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "COPYING.md"), []byte("SPDX-License-Identifier: MIT"), 0644))
+
+	components, err := Components(testLocks(), vendorDir)
+	require.NoError(t, err)
+
+	byName := make(map[string]Component)
+	for _, c := range components {
+		byName[c.Name] = c
+	}
+	require.Len(t, byName, 5)
+	assert.Equal(t, "example.com/archive", components[0].Name)
+
+	g := byName["github.com/grafana/grafonnet/gen/grafonnet-latest"]
+	assert.Equal(t, "v0.1.0", g.Version)
+	assert.Equal(t, "pkg:github/grafana/grafonnet@"+commit+"#gen/grafonnet-latest", g.PURL)
+	assert.Equal(t, "git+https://github.com/grafana/grafonnet.git@"+commit+"#gen/grafonnet-latest", g.Location)
+	assert.Equal(t, "https://github.com/grafana/grafonnet.git", g.VCS)
+	assert.Equal(t, sum, g.Sum)
+	assert.Empty(t, g.ArchiveSHA256)
+	assert.Equal(t, []string{"Apache-2.0", "MIT"}, g.Licenses)
+
+	assert.Equal(t, "pkg:generic/git.example.com/a/b/lib@"+commit+"?vcs_url=git%2Bhttps%3A%2F%2Fgit.example.com%2Fa%2Fb%2Flib.git%40"+commit, byName["git.example.com/a/b/lib"].PURL)
+	assert.Equal(t, "pkg:generic/archive?checksum=sha256%3A"+sumHex+"&download_url=https%3A%2F%2Fexample.com%2Farchive.tar.gz", byName["example.com/archive"].PURL)
+	assert.Equal(t, "https://gitlab.com/api/v4/projects/group%2Fproject/packages/generic/lib/1.0.0/package.tar.gz", byName["gitlab.com/lib"].Location)
+	assert.Empty(t, byName["local"].PURL)
+	assert.Empty(t, byName["local"].Licenses)
+}
+
+func TestIdentifyLicense(t *testing.T) {
+	for text, id := range map[string]string{
+		"Permission is hereby granted, free of charge, to any person":                                          "MIT",
+		"Redistribution and use in source and binary forms, with or without modification\n3. Neither the name": "BSD-3-Clause",
+		"Redistribution and use in source\n and binary forms":                                                  "BSD-2-Clause",
+		"Mozilla Public License Version 2.0":                                                                   "MPL-2.0",
+		"All rights reserved.":                                                                                 "",
+	} {
+		assert.Equal(t, id, identifyLicense(text), text)
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	opts := Options{Name: "project", ToolVersion: "v1.0.0", Created: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)}
+
+	doc, err := Generate(FormatCycloneDX, testLocks(), opts)
+	require.NoError(t, err)
+	bom := doc.(CycloneDX)
+	assert.Equal(t, "2024-01-02T03:04:05Z", bom.Metadata.Timestamp)
+	assert.Regexp(t, `^urn:uuid:[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`, bom.SerialNumber)
+	assert.Len(t, bom.Components, 5)
+	assert.Equal(t, []cdxDependency{
+		{Ref: ".", DependsOn: []string{"example.com/archive", "github.com/grafana/grafonnet/gen/grafonnet-latest", "gitlab.com/lib", "local"}},
+		{Ref: "example.com/archive", DependsOn: []string{}},
+		{Ref: "git.example.com/a/b/lib", DependsOn: []string{}},
+		{Ref: "github.com/grafana/grafonnet/gen/grafonnet-latest", DependsOn: []string{"git.example.com/a/b/lib"}},
+		{Ref: "gitlab.com/lib", DependsOn: []string{}},
+		{Ref: "local", DependsOn: []string{}},
+	}, bom.Dependencies)
+	assert.Equal(t, []cdxExternal{{
+		Type: "distribution", URL: "https://example.com/archive.tar.gz", Hashes: []cdxHash{{Alg: "SHA-256", Content: sumHex}},
+	}}, bom.Components[0].ExternalReferences)
+	assert.Equal(t, []cdxHash{{Alg: "SHA-256", Content: sumHex}}, bom.Components[0].Hashes)
+
+	// only archives have a sha256, the sum of jb is a property
+	assert.Empty(t, bom.Components[1].Hashes)
+	assert.Equal(t, []cdxProperty{{Name: "jb:sum", Value: sum}}, bom.Components[1].Properties)
+
+	doc, err = Generate(FormatSPDX, testLocks(), opts)
+	require.NoError(t, err)
+	spdx := doc.(SPDX)
+	assert.Equal(t, "SPDX-2.3", spdx.SPDXVersion)
+	assert.Len(t, spdx.Packages, 6)
+	assert.Equal(t, "SPDXRef-Package-example.com-archive", spdx.Packages[1].SPDXID)
+	assert.Equal(t, []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: sumHex}}, spdx.Packages[1].Checksums)
+	assert.Empty(t, spdx.Packages[2].Checksums)
+	assert.Equal(t, []spdxAnnotation{{
+		AnnotationType: "OTHER", Annotator: "Tool: jb-v1.0.0", AnnotationDate: "2024-01-02T03:04:05Z", Comment: "jb:sum=" + sum,
+	}}, spdx.Packages[2].Annotations)
+	assert.Equal(t, noAssertion, spdx.Packages[5].DownloadLocation)
+	assert.Contains(t, spdx.Relationships, spdxRelationship{
+		SPDXElementID: "SPDXRef-Package-github.com-grafana-grafonnet-gen-grafonnet-latest", RelationshipType: "DEPENDS_ON", RelatedSPDXElement: "SPDXRef-Package-git.example.com-a-b-lib",
+	})
+	assert.Contains(t, spdx.Relationships, spdxRelationship{
+		SPDXElementID: "SPDXRef-DOCUMENT", RelationshipType: "DESCRIBES", RelatedSPDXElement: "SPDXRef-Project",
+	})
+
+	_, err = Generate("xml", testLocks(), opts)
+	assert.Error(t, err)
+}
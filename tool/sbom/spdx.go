@@ -0,0 +1,170 @@
+// Copyright 2018 jsonnet-bundler authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sbom
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// noAssertion marks SPDX fields without information
+const noAssertion = "NOASSERTION"
+
+// SPDX is an SPDX 2.3 document, as far as it is generated
+type SPDX struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	Checksums        []spdxChecksum    `json:"checksums,omitempty"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+	Annotations      []spdxAnnotation  `json:"annotations,omitempty"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxAnnotation struct {
+	AnnotationType string `json:"annotationType"`
+	Annotator      string `json:"annotator"`
+	AnnotationDate string `json:"annotationDate"`
+	Comment        string `json:"comment"`
+}
+
+type spdxRelationship struct {
+	SPDXElementID      string `json:"spdxElementId"`
+	RelationshipType   string `json:"relationshipType"`
+	RelatedSPDXElement string `json:"relatedSpdxElement"`
+}
+
+// spdxInvalid are the characters not allowed in SPDX identifiers
+var spdxInvalid = regexp.MustCompile(`[^A-Za-z0-9.\-]+`)
+
+// spdx describes the components as SPDX document. The project is the package
+// the document describes.
+func spdx(components []Component, opts Options) SPDX {
+	doc := SPDX{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              opts.Name,
+		DocumentNamespace: "urn:uuid:" + newUUID(),
+		CreationInfo: spdxCreationInfo{
+			Created:  opts.Created.UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: jb-" + opts.ToolVersion},
+		},
+	}
+
+	const root = "SPDXRef-Project"
+	doc.Packages = append(doc.Packages, spdxPackage{
+		Name:             opts.Name,
+		SPDXID:           root,
+		DownloadLocation: noAssertion,
+		LicenseConcluded: noAssertion,
+		LicenseDeclared:  noAssertion,
+		CopyrightText:    noAssertion,
+	})
+	doc.Relationships = append(doc.Relationships, spdxRelationship{
+		SPDXElementID: doc.SPDXID, RelationshipType: "DESCRIBES", RelatedSPDXElement: root,
+	})
+
+	// identifiers are derived from names, which may collide once sanitized
+	ids := map[string]string{".": root}
+	taken := map[string]bool{root: true}
+	for _, c := range components {
+		base := "SPDXRef-Package-" + strings.Trim(spdxInvalid.ReplaceAllString(c.Name, "-"), "-")
+		id := base
+		for i := 2; taken[id]; i++ {
+			id = fmt.Sprintf("%s-%d", base, i)
+		}
+		taken[id] = true
+		ids[c.Name] = id
+	}
+
+	for _, c := range components {
+		p := spdxPackage{
+			Name:             c.Name,
+			SPDXID:           ids[c.Name],
+			VersionInfo:      c.Version,
+			DownloadLocation: c.Location,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  noAssertion,
+			CopyrightText:    noAssertion,
+		}
+		if p.DownloadLocation == "" {
+			p.DownloadLocation = noAssertion
+		}
+		if len(c.Licenses) > 0 {
+			p.LicenseDeclared = strings.Join(c.Licenses, " AND ")
+		}
+		// the sum of jb is no checksum of any artifact
+		if c.ArchiveSHA256 != "" {
+			p.Checksums = []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: c.ArchiveSHA256}}
+		}
+		if c.Sum != "" {
+			p.Annotations = []spdxAnnotation{{
+				AnnotationType: "OTHER",
+				Annotator:      doc.CreationInfo.Creators[0],
+				AnnotationDate: doc.CreationInfo.Created,
+				Comment:        "jb:sum=" + c.Sum,
+			}}
+		}
+		if c.PURL != "" {
+			p.ExternalRefs = []spdxExternalRef{{
+				ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: c.PURL,
+			}}
+		}
+		doc.Packages = append(doc.Packages, p)
+
+		for _, parent := range c.Parents {
+			if id, ok := ids[parent]; ok {
+				doc.Relationships = append(doc.Relationships, spdxRelationship{
+					SPDXElementID: id, RelationshipType: "DEPENDS_ON", RelatedSPDXElement: ids[c.Name],
+				})
+			}
+		}
+	}
+	return doc
+}